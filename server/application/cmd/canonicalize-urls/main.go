@@ -0,0 +1,69 @@
+// Command canonicalize-urls rewrites the URLs of saved conversations to the
+// canonical form of the source registry, merging conversations that turn out
+// to be saved from the same URL, and keeps their former URLs as aliases.
+// Run it once after upgrading to a server with the source registry, and again
+// after a change of the registry rules. It can run while the server is
+// serving requests.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/config"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/database"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/tokenizer"
+)
+
+func main() {
+	batchSize := flag.Int("batch-size", 500, "number of conversations read per batch")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Merging needs the content of encrypted conversations
+	keyring, err := encryption.LoadKeyring(cfg.EncryptionKeys, cfg.EncryptionKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
+	// Merging counts the tokens of the merged content
+	tokenizers, err := tokenizer.Load(cfg.TokenizerDir, cfg.TokenizerSources)
+	if err != nil {
+		log.Fatalf("Failed to load tokenizers: %v", err)
+	}
+
+	db, err := database.New(cfg.DatabaseURL())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	conversationRepo := repository.NewConversationRepository(db.Pool, cfg.DBSchema, keyring, tokenizers)
+	messageRepo := repository.NewMessageRepository(db.Pool, cfg.DBSchema, keyring, tokenizers)
+	versionRepo := repository.NewConversationVersionRepository(db.Pool, cfg.DBSchema, keyring)
+	snippetRepo := repository.NewSnippetRepository(db.Pool, cfg.DBSchema, keyring)
+	relationRepo := repository.NewRelationRepository(db.Pool, cfg.DBSchema)
+	annotationRepo := repository.NewAnnotationRepository(db.Pool, cfg.DBSchema, keyring)
+	workspaceRepo := repository.NewWorkspaceRepository(db.Pool, cfg.DBSchema)
+	invitationRepo := repository.NewWorkspaceInvitationRepository(db.Pool, cfg.DBSchema)
+	auditService := service.NewAuditService(repository.NewAuditRepository(db.Pool, cfg.DBSchema))
+	workspaceService := service.NewWorkspaceService(db.Pool, workspaceRepo, invitationRepo, auditService)
+	conversationService := service.NewConversationService(db.Pool, conversationRepo, messageRepo, versionRepo, snippetRepo, relationRepo, annotationRepo,
+		auditService, workspaceService, service.ShrinkGuardConfig{})
+
+	result, err := conversationService.CanonicalizeURLs(context.Background(), *batchSize)
+	if result != nil {
+		log.Printf("%d conversations rewritten, %d merged into a conversation with the same URL", result.Rewritten, result.Merged)
+	}
+	if err != nil {
+		log.Fatalf("Failed to canonicalize conversation URLs: %v", err)
+	}
+}
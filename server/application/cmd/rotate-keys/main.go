@@ -0,0 +1,52 @@
+// Command rotate-keys re-wraps the data keys of encrypted conversations, their
+// messages, message segments and past versions, and snippets with the active
+// master key, and encrypts rows still stored in clear.
+// It can run while the server is serving requests.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/config"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/database"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
+)
+
+func main() {
+	batchSize := flag.Int("batch-size", 500, "number of rows read per batch")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	keyring, err := encryption.LoadKeyring(cfg.EncryptionKeys, cfg.EncryptionKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Fatal("No encryption keys configured, set ENCRYPTION_KEYS or ENCRYPTION_KEY_FILE")
+	}
+
+	db, err := database.New(cfg.DatabaseURL())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	rotation := repository.NewKeyRotationRepository(db.Pool, cfg.DBSchema, keyring)
+	for _, table := range []string{"conversations", "conversation_versions", "messages", "message_segments", "snippets", "annotations"} {
+		result, err := rotation.Rotate(ctx, table, *batchSize)
+		if err != nil {
+			log.Fatalf("Failed to rotate keys of %s: %v", table, err)
+		}
+		log.Printf("%s: %d data keys re-wrapped, %d rows encrypted, %d rows skipped (changed concurrently)",
+			table, result.Rewrapped, result.Encrypted, result.Skipped)
+	}
+	log.Printf("All data keys are wrapped by master key %s", keyring.ActiveKeyID())
+}
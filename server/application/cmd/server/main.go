@@ -13,10 +13,16 @@ import (
 	"github.com/mindflight/save-my-chat-llm/server/application/config"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/api"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/api/handlers"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/api/middleware"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/blobstore"
 	"github.com/mindflight/save-my-chat-llm/server/application/pkg/database"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
 	"github.com/mindflight/save-my-chat-llm/server/application/pkg/migrations"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/pricing"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/tokenizer"
 )
 
 func main() {
@@ -43,23 +49,99 @@ func main() {
 	}
 	log.Println("Migrations completed successfully")
 
+	// Load encryption keys; content is stored in clear when none are configured
+	keyring, err := encryption.LoadKeyring(cfg.EncryptionKeys, cfg.EncryptionKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	if keyring != nil {
+		log.Printf("Content encryption enabled with master key %s", keyring.ActiveKeyID())
+	}
+
+	// Load tokenizers and prices; costs are not estimated without a price table
+	tokenizers, err := tokenizer.Load(cfg.TokenizerDir, cfg.TokenizerSources)
+	if err != nil {
+		log.Fatalf("Failed to load tokenizers: %v", err)
+	}
+	prices, err := pricing.Load(cfg.TokenPricesFile)
+	if err != nil {
+		log.Fatalf("Failed to load token prices: %v", err)
+	}
+
 	// Initialize repositories
-	conversationRepo := repository.NewConversationRepository(db.Pool, cfg.DBSchema)
-	snippetRepo := repository.NewSnippetRepository(db.Pool, cfg.DBSchema)
+	conversationRepo := repository.NewConversationRepository(db.Pool, cfg.DBSchema, keyring, tokenizers)
+	messageRepo := repository.NewMessageRepository(db.Pool, cfg.DBSchema, keyring, tokenizers)
+	versionRepo := repository.NewConversationVersionRepository(db.Pool, cfg.DBSchema, keyring)
+	snippetRepo := repository.NewSnippetRepository(db.Pool, cfg.DBSchema, keyring)
 	collectionRepo := repository.NewCollectionRepository(db.Pool, cfg.DBSchema)
 	settingsRepo := repository.NewSettingsRepository(db.Pool, cfg.DBSchema)
+	userRepo := repository.NewUserRepository(db.Pool, cfg.DBSchema)
+	apiKeyRepo := repository.NewAPIKeyRepository(db.Pool, cfg.DBSchema)
+	sessionRepo := repository.NewAuthSessionRepository(db.Pool, cfg.DBSchema)
+	auditRepo := repository.NewAuditRepository(db.Pool, cfg.DBSchema)
+	shareLinkRepo := repository.NewShareLinkRepository(db.Pool, cfg.DBSchema)
+	workspaceRepo := repository.NewWorkspaceRepository(db.Pool, cfg.DBSchema)
+	invitationRepo := repository.NewWorkspaceInvitationRepository(db.Pool, cfg.DBSchema)
+	attachmentRepo := repository.NewAttachmentRepository(db.Pool, cfg.DBSchema)
+	relationRepo := repository.NewRelationRepository(db.Pool, cfg.DBSchema)
+	annotationRepo := repository.NewAnnotationRepository(db.Pool, cfg.DBSchema, keyring)
+	statsRepo := repository.NewStatsRepository(db.Pool, cfg.DBSchema)
+
+	blobs, err := blobstore.New(cfg.AttachmentsDir)
+	if err != nil {
+		log.Fatalf("Failed to open attachment storage: %v", err)
+	}
 
 	// Initialize services
-	conversationService := service.NewConversationService(conversationRepo)
-	snippetService := service.NewSnippetService(snippetRepo)
-	collectionService := service.NewCollectionService(collectionRepo)
-	settingsService := service.NewSettingsService(settingsRepo)
+	auditService := service.NewAuditService(auditRepo)
+	workspaceService := service.NewWorkspaceService(db.Pool, workspaceRepo, invitationRepo, auditService)
+	conversationService := service.NewConversationService(db.Pool, conversationRepo, messageRepo, versionRepo, snippetRepo, relationRepo, annotationRepo, auditService, workspaceService, service.ShrinkGuardConfig{
+		Enabled:      cfg.ShrinkGuardEnabled,
+		MaxDropRatio: cfg.ShrinkGuardMaxDrop,
+		MinDropBytes: cfg.ShrinkGuardMinBytes,
+		CheckTurns:   cfg.ShrinkGuardCheckTurns,
+	})
+	snippetService := service.NewSnippetService(db.Pool, snippetRepo, conversationRepo, auditService, workspaceService)
+	collectionService := service.NewCollectionService(db.Pool, collectionRepo, auditService, workspaceService)
+	settingsService := service.NewSettingsService(db.Pool, settingsRepo, auditService)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
+	shareService := service.NewShareService(shareLinkRepo, conversationRepo, snippetRepo, workspaceService)
+	trashService := service.NewTrashService(
+		db.Pool,
+		conversationRepo,
+		snippetRepo,
+		collectionRepo,
+		auditService,
+		workspaceService,
+		cfg.TrashRetention,
+	)
+	attachmentService := service.NewAttachmentService(
+		db.Pool,
+		attachmentRepo,
+		conversationRepo,
+		messageRepo,
+		workspaceService,
+		auditService,
+		blobs,
+		int64(cfg.AttachmentMaxSize),
+		cfg.AttachmentUploadTTL,
+	)
+	relationService := service.NewRelationService(db.Pool, relationRepo, conversationRepo, auditService, workspaceService)
+	annotationService := service.NewAnnotationService(db.Pool, annotationRepo, conversationRepo, auditService)
+	statsService := service.NewStatsService(db.Pool, statsRepo, conversationRepo, messageRepo, tokenizers, prices)
 	backupService := service.NewBackupService(
 		db.Pool,
 		conversationRepo,
+		messageRepo,
+		versionRepo,
 		snippetRepo,
+		annotationRepo,
 		collectionRepo,
 		settingsRepo,
+		attachmentService,
+		relationService,
+		auditService,
+		workspaceService,
 	)
 
 	// Initialize handlers
@@ -70,25 +152,114 @@ func main() {
 		Settings:      handlers.NewSettingsHandler(settingsService),
 		Backup:        handlers.NewBackupHandler(backupService),
 		Health:        handlers.NewHealthHandler(db.Pool),
+		APIKeys:       handlers.NewAPIKeysHandler(apiKeyService),
+		Audit:         handlers.NewAuditHandler(auditService),
+		Shares:        handlers.NewSharesHandler(shareService),
+		Workspaces:    handlers.NewWorkspacesHandler(workspaceService),
+		Trash:         handlers.NewTrashHandler(trashService),
+		Sources:       handlers.NewSourcesHandler(),
+		Attachments:   handlers.NewAttachmentsHandler(attachmentService),
+		Relations:     handlers.NewRelationsHandler(relationService),
+		Annotations:   handlers.NewAnnotationsHandler(annotationService),
+		Stats:         handlers.NewStatsHandler(statsService),
+	}
+
+	authService := service.NewAuthService(userRepo, sessionRepo, service.AuthConfig{
+		JWTSecret:       cfg.JWTSecret,
+		AccessTokenTTL:  cfg.AccessTokenTTL,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+		SessionTTL:      cfg.SessionTTL,
+	})
+	h.Auth = handlers.NewAuthHandler(authService, cfg.AllowRegistration, handlers.CookieConfig{
+		Name:     cfg.SessionCookieName,
+		Secure:   cfg.SessionCookieSecure,
+		SameSite: cfg.SessionCookieSameSite,
+	})
+	if cfg.JWTSecret == "" {
+		log.Println("JWT_SECRET not set, token login endpoints are disabled")
+	}
+
+	// Initialize OIDC verification if an identity provider is configured
+	var oidcVerifier *auth.OIDCVerifier
+	if cfg.OIDCIssuer != "" {
+		oidcVerifier, err = auth.NewOIDCVerifier(ctx, auth.OIDCConfig{
+			Issuer:             cfg.OIDCIssuer,
+			Audience:           cfg.OIDCAudience,
+			JWKSURL:            cfg.OIDCJWKSURL,
+			UsernameClaim:      cfg.OIDCUsernameClaim,
+			GroupsClaim:        cfg.OIDCGroupsClaim,
+			KeyRefreshInterval: cfg.OIDCKeyRefreshInterval,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize OIDC verification: %v", err)
+		}
+		log.Printf("OIDC verification enabled for issuer %s", cfg.OIDCIssuer)
 	}
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
 		AppName:      "AI Saver Backend",
+		ErrorHandler: middleware.ErrorHandler,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	})
+	// Attachment downloads, exports and imports may outlast the timeouts and
+	// body limit above; the form around an imported file gets 1 MB more
+	app.Server().HeaderReceived = api.StreamLimits{
+		Timeout:     cfg.StreamTimeout,
+		MaxBodySize: cfg.AttachmentMaxSize + 1<<20,
+	}.HeaderReceived
 
 	// Setup routes
 	mwConfig := api.MiddlewareConfig{
-		JWTSecret:    cfg.JWTSecret,
-		APIKeySecret: cfg.APIKeySecret,
-		CORSOrigins:  cfg.CORSOrigins,
-		RateLimitMax: cfg.RateLimitMax,
+		JWTSecret:         cfg.JWTSecret,
+		APIKeySecret:      cfg.APIKeySecret,
+		CORSOrigins:       cfg.CORSOrigins,
+		RateLimitMax:      cfg.RateLimitMax,
+		Users:             userRepo,
+		APIKeys:           apiKeyRepo,
+		Sessions:          sessionRepo,
+		OIDC:              oidcVerifier,
+		OIDCRequiredRole:  cfg.OIDCRequiredRole,
+		SessionCookieName: cfg.SessionCookieName,
 	}
 	api.SetupRoutes(app, h, mwConfig)
 
+	// Purge the trash in the background; a zero retention keeps deleted items until restored
+	if cfg.TrashRetention > 0 && cfg.TrashPurgeInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.TrashPurgeInterval)
+			defer ticker.Stop()
+			for {
+				purged, err := trashService.Purge(ctx)
+				if err != nil {
+					log.Printf("Failed to purge trash: %v", err)
+				} else if purged > 0 {
+					log.Printf("Purged %d items deleted more than %s ago", purged, cfg.TrashRetention)
+				}
+				<-ticker.C
+			}
+		}()
+	}
+
+	// Drop expired uploads and the blobs no attachment refers to anymore
+	if cfg.TrashPurgeInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.TrashPurgeInterval)
+			defer ticker.Stop()
+			for {
+				removed, err := attachmentService.PurgeBlobs(ctx)
+				if err != nil {
+					log.Printf("Failed to purge attachment blobs: %v", err)
+				} else if removed > 0 {
+					log.Printf("Removed %d unused attachment blobs", removed)
+				}
+				<-ticker.C
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -108,4 +279,3 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
-
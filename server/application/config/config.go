@@ -5,23 +5,53 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port        string
-	DBHost      string
-	DBPort      string
-	DBUser      string
-	DBPassword  string
-	DBName      string
-	DBSchema    string
-	DBSSLMode   string
-	JWTSecret   string
-	APIKeySecret string
-	CORSOrigins []string
-	RateLimitMax int
+	Port                   string
+	DBHost                 string
+	DBPort                 string
+	DBUser                 string
+	DBPassword             string
+	DBName                 string
+	DBSchema               string
+	DBSSLMode              string
+	JWTSecret              string
+	APIKeySecret           string
+	CORSOrigins            []string
+	RateLimitMax           int
+	AccessTokenTTL         time.Duration
+	RefreshTokenTTL        time.Duration
+	AllowRegistration      bool
+	OIDCIssuer             string
+	OIDCAudience           string
+	OIDCJWKSURL            string
+	OIDCUsernameClaim      string
+	OIDCGroupsClaim        string
+	OIDCRequiredRole       string
+	OIDCKeyRefreshInterval time.Duration
+	SessionTTL             time.Duration
+	SessionCookieName      string
+	SessionCookieSecure    bool
+	SessionCookieSameSite  string
+	EncryptionKeys         string
+	EncryptionKeyFile      string
+	ShrinkGuardEnabled     bool
+	ShrinkGuardMaxDrop     float64
+	ShrinkGuardMinBytes    int
+	ShrinkGuardCheckTurns  bool
+	TrashRetention         time.Duration
+	TrashPurgeInterval     time.Duration
+	AttachmentsDir         string
+	AttachmentMaxSize      int
+	AttachmentUploadTTL    time.Duration
+	StreamTimeout          time.Duration
+	TokenizerDir           string
+	TokenizerSources       string
+	TokenPricesFile        string
 }
 
 func Load() (*Config, error) {
@@ -29,17 +59,46 @@ func Load() (*Config, error) {
 	_ = godotenv.Load()
 
 	cfg := &Config{
-		Port:        getEnv("PORT", "8080"),
-		DBHost:      getEnv("DB_HOST", "localhost"),
-		DBPort:      getEnv("DB_PORT", "5432"),
-		DBUser:      getEnv("DB_USER", "mfoserver"),
-		DBPassword:  getEnv("DB_PASSWORD", "mfoserver"),
-		DBName:      getEnv("DB_NAME", "mfo"),
-		DBSchema:    getEnv("DB_SCHEMA", "mfo-server"),
-		DBSSLMode:   getEnv("DB_SSL_MODE", "disable"),
-		JWTSecret:   getEnv("JWT_SECRET", ""),
-		APIKeySecret: getEnv("API_KEY_SECRET", ""),
-		RateLimitMax: getEnvAsInt("RATE_LIMIT_MAX", 100),
+		Port:                   getEnv("PORT", "8080"),
+		DBHost:                 getEnv("DB_HOST", "localhost"),
+		DBPort:                 getEnv("DB_PORT", "5432"),
+		DBUser:                 getEnv("DB_USER", "mfoserver"),
+		DBPassword:             getEnv("DB_PASSWORD", "mfoserver"),
+		DBName:                 getEnv("DB_NAME", "mfo"),
+		DBSchema:               getEnv("DB_SCHEMA", "mfo-server"),
+		DBSSLMode:              getEnv("DB_SSL_MODE", "disable"),
+		JWTSecret:              getEnv("JWT_SECRET", ""),
+		APIKeySecret:           getEnv("API_KEY_SECRET", ""),
+		RateLimitMax:           getEnvAsInt("RATE_LIMIT_MAX", 100),
+		AccessTokenTTL:         getEnvAsDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:        getEnvAsDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		AllowRegistration:      getEnvAsBool("ALLOW_REGISTRATION", false),
+		OIDCIssuer:             getEnv("OIDC_ISSUER", ""),
+		OIDCAudience:           getEnv("OIDC_AUDIENCE", ""),
+		OIDCJWKSURL:            getEnv("OIDC_JWKS_URL", ""),
+		OIDCUsernameClaim:      getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		OIDCGroupsClaim:        getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCRequiredRole:       getEnv("OIDC_REQUIRED_ROLE", ""),
+		OIDCKeyRefreshInterval: getEnvAsDuration("OIDC_KEY_REFRESH_INTERVAL", time.Hour),
+		SessionTTL:             getEnvAsDuration("SESSION_TTL", 7*24*time.Hour),
+		SessionCookieName:      getEnv("SESSION_COOKIE_NAME", "ai_saver_session"),
+		SessionCookieSecure:    getEnvAsBool("SESSION_COOKIE_SECURE", true),
+		SessionCookieSameSite:  getEnv("SESSION_COOKIE_SAMESITE", "Lax"),
+		EncryptionKeys:         getEnv("ENCRYPTION_KEYS", ""),
+		EncryptionKeyFile:      getEnv("ENCRYPTION_KEY_FILE", ""),
+		ShrinkGuardEnabled:     getEnvAsBool("SHRINK_GUARD_ENABLED", true),
+		ShrinkGuardMaxDrop:     getEnvAsFloat("SHRINK_GUARD_MAX_DROP", 0.5),
+		ShrinkGuardMinBytes:    getEnvAsInt("SHRINK_GUARD_MIN_BYTES", 2048),
+		ShrinkGuardCheckTurns:  getEnvAsBool("SHRINK_GUARD_CHECK_TURNS", false),
+		TrashRetention:         getEnvAsDuration("TRASH_RETENTION", 30*24*time.Hour),
+		TrashPurgeInterval:     getEnvAsDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		AttachmentsDir:         getEnv("ATTACHMENTS_DIR", "data/attachments"),
+		AttachmentMaxSize:      getEnvAsInt("ATTACHMENT_MAX_SIZE", 100<<20),
+		AttachmentUploadTTL:    getEnvAsDuration("ATTACHMENT_UPLOAD_TTL", 24*time.Hour),
+		StreamTimeout:          getEnvAsDuration("STREAM_TIMEOUT", time.Hour),
+		TokenizerDir:           getEnv("TOKENIZER_DIR", ""),
+		TokenizerSources:       getEnv("TOKENIZER_SOURCES", ""),
+		TokenPricesFile:        getEnv("TOKEN_PRICES_FILE", ""),
 	}
 
 	// Parse CORS origins
@@ -82,3 +141,26 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(key, "")
+	if value, err := time.ParseDuration(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
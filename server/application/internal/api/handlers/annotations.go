@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+type AnnotationsHandler struct {
+	service *service.AnnotationService
+}
+
+func NewAnnotationsHandler(service *service.AnnotationService) *AnnotationsHandler {
+	return &AnnotationsHandler{service: service}
+}
+
+// ListByConversation returns the user's annotations of a conversation
+func (h *AnnotationsHandler) ListByConversation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	annotations, err := h.service.ListByConversation(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return annotationError(c, err, "Conversation", "Failed to list annotations")
+	}
+
+	return c.JSON(annotations)
+}
+
+// Create highlights a range of the conversation
+func (h *AnnotationsHandler) Create(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	var req models.CreateAnnotationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	annotation, err := h.service.Create(c.Context(), currentActor(c), id, &req)
+	if err != nil {
+		return annotationError(c, err, "Conversation", "Failed to create annotation")
+	}
+
+	return c.Status(201).JSON(annotation)
+}
+
+// List returns a page of the user's annotations across the archive
+func (h *AnnotationsHandler) List(c *fiber.Ctx) error {
+	filters := models.AnnotationFilters{
+		Query:  c.Query("q"),
+		Color:  c.Query("color"),
+		Limit:  c.QueryInt("limit"),
+		Offset: c.QueryInt("offset"),
+	}
+
+	if tagsStr := c.Query("tags"); tagsStr != "" {
+		for _, tag := range splitCommaSeparated(tagsStr) {
+			if tag != "" {
+				filters.Tags = append(filters.Tags, tag)
+			}
+		}
+	}
+
+	if conversationIDStr := c.Query("conversation_id"); conversationIDStr != "" {
+		conversationID, err := strconv.Atoi(conversationIDStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation_id"})
+		}
+		filters.ConversationID = &conversationID
+	}
+
+	if orphanedStr := c.Query("orphaned"); orphanedStr != "" {
+		orphaned, err := strconv.ParseBool(orphanedStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid orphaned"})
+		}
+		filters.Orphaned = &orphaned
+	}
+
+	page, err := h.service.List(c.Context(), currentUserID(c), filters)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to list annotations"})
+	}
+
+	return c.JSON(page)
+}
+
+func (h *AnnotationsHandler) Get(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid annotation ID"})
+	}
+
+	annotation, err := h.service.Get(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return annotationError(c, err, "Annotation", "Failed to get annotation")
+	}
+
+	return c.JSON(annotation)
+}
+
+// Update changes the color, note and tags of an annotation
+func (h *AnnotationsHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid annotation ID"})
+	}
+
+	var req models.UpdateAnnotationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	annotation, err := h.service.Update(c.Context(), currentActor(c), id, &req)
+	if err != nil {
+		return annotationError(c, err, "Annotation", "Failed to update annotation")
+	}
+
+	return c.JSON(annotation)
+}
+
+func (h *AnnotationsHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid annotation ID"})
+	}
+
+	if err := h.service.Delete(c.Context(), currentActor(c), id); err != nil {
+		return annotationError(c, err, "Annotation", "Failed to delete annotation")
+	}
+
+	return c.SendStatus(204)
+}
+
+// annotationError maps errors of the annotation service to responses; entity
+// names what was not found
+func annotationError(c *fiber.Ctx, err error, entity, message string) error {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": entity + " not found"})
+	case errors.Is(err, service.ErrInvalidAnnotation), errors.Is(err, service.ErrInvalidAnchor):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": message})
+}
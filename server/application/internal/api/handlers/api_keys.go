@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+type APIKeysHandler struct {
+	service *service.APIKeyService
+}
+
+func NewAPIKeysHandler(service *service.APIKeyService) *APIKeysHandler {
+	return &APIKeysHandler{service: service}
+}
+
+func (h *APIKeysHandler) List(c *fiber.Ctx) error {
+	keys, err := h.service.List(c.Context(), currentUserID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to list API keys"})
+	}
+
+	return c.JSON(keys)
+}
+
+func (h *APIKeysHandler) Create(c *fiber.Ctx) error {
+	var req models.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	response, err := h.service.Create(c.Context(), currentUserID(c), &req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(response)
+}
+
+func (h *APIKeysHandler) Revoke(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+
+	revoked, err := h.service.Revoke(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke API key"})
+	}
+	if !revoked {
+		return c.Status(404).JSON(fiber.Map{"error": "API key not found"})
+	}
+
+	return c.Status(204).Send(nil)
+}
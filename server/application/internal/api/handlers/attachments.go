@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+// UploadOffsetHeader carries the number of bytes an upload has received: the
+// offset a part starts at in requests, and the offset of the next part in responses
+const UploadOffsetHeader = "Upload-Offset"
+
+type AttachmentsHandler struct {
+	service *service.AttachmentService
+}
+
+func NewAttachmentsHandler(service *service.AttachmentService) *AttachmentsHandler {
+	return &AttachmentsHandler{service: service}
+}
+
+// List returns the attachments of a conversation
+func (h *AttachmentsHandler) List(c *fiber.Ctx) error {
+	conversationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	attachments, err := h.service.List(c.Context(), currentUserID(c), conversationID)
+	if err != nil {
+		return attachmentError(c, err, "Conversation", "Failed to list attachments")
+	}
+
+	return c.JSON(attachments)
+}
+
+// Upload attaches the file of a multipart form to a conversation in one
+// request. Larger files go through CreateUpload.
+func (h *AttachmentsHandler) Upload(c *fiber.Ctx) error {
+	conversationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Missing file"})
+	}
+	req := models.CreateAttachmentUploadRequest{
+		Filename:    file.Filename,
+		ContentType: file.Header.Get(fiber.HeaderContentType),
+	}
+	if ordinal := c.FormValue("message_ordinal"); ordinal != "" {
+		n, err := strconv.Atoi(ordinal)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid message_ordinal"})
+		}
+		req.MessageOrdinal = &n
+	}
+	if sourceURL := c.FormValue("source_url"); sourceURL != "" {
+		req.SourceURL = &sourceURL
+	}
+
+	content, err := file.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid file"})
+	}
+	defer content.Close()
+
+	attachment, err := h.service.Upload(c.Context(), currentActor(c), conversationID, &req, content)
+	if err != nil {
+		return attachmentError(c, err, "Conversation", "Failed to upload attachment")
+	}
+
+	return c.Status(201).JSON(attachment)
+}
+
+// CreateUpload starts the upload of a file in parts
+func (h *AttachmentsHandler) CreateUpload(c *fiber.Ctx) error {
+	conversationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	var req models.CreateAttachmentUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	upload, err := h.service.CreateUpload(c.Context(), currentActor(c), conversationID, &req)
+	if err != nil {
+		return attachmentError(c, err, "Conversation", "Failed to create upload")
+	}
+
+	c.Set(UploadOffsetHeader, strconv.FormatInt(upload.Received, 10))
+	return c.Status(201).JSON(upload)
+}
+
+// GetUpload reports how much of an upload was received, to resume it
+func (h *AttachmentsHandler) GetUpload(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("uploadId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid upload ID"})
+	}
+
+	upload, err := h.service.GetUpload(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return attachmentError(c, err, "Upload", "Failed to get upload")
+	}
+
+	c.Set(UploadOffsetHeader, strconv.FormatInt(upload.Received, 10))
+	return c.JSON(upload)
+}
+
+// AppendUpload adds the request body to an upload at the offset given by the
+// Upload-Offset header. A mismatched offset answers 409 with the offset to
+// resume from.
+func (h *AttachmentsHandler) AppendUpload(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("uploadId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid upload ID"})
+	}
+	offset, err := strconv.ParseInt(c.Get(UploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Missing or invalid " + UploadOffsetHeader + " header"})
+	}
+
+	response, err := h.service.AppendUpload(c.Context(), currentActor(c), id, offset, bytes.NewReader(c.Body()))
+	if errors.Is(err, service.ErrUploadOffset) {
+		upload, getErr := h.service.GetUpload(c.Context(), currentUserID(c), id)
+		if getErr != nil {
+			return attachmentError(c, getErr, "Upload", "Failed to get upload")
+		}
+		c.Set(UploadOffsetHeader, strconv.FormatInt(upload.Received, 10))
+		return c.Status(409).JSON(fiber.Map{"error": err.Error(), "upload": upload})
+	}
+	if err != nil {
+		return attachmentError(c, err, "Upload", "Failed to upload part")
+	}
+
+	c.Set(UploadOffsetHeader, strconv.FormatInt(response.Upload.Received, 10))
+	if response.Attachment != nil {
+		return c.Status(201).JSON(response)
+	}
+	return c.JSON(response)
+}
+
+// CancelUpload drops an upload
+func (h *AttachmentsHandler) CancelUpload(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("uploadId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid upload ID"})
+	}
+
+	if err := h.service.CancelUpload(c.Context(), currentUserID(c), id); err != nil {
+		return attachmentError(c, err, "Upload", "Failed to cancel upload")
+	}
+
+	return c.SendStatus(204)
+}
+
+// Get returns the metadata of an attachment
+func (h *AttachmentsHandler) Get(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid attachment ID"})
+	}
+
+	attachment, err := h.service.Get(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return attachmentError(c, err, "Attachment", "Failed to get attachment")
+	}
+
+	return c.JSON(attachment)
+}
+
+// Download sends the content of an attachment, or the single byte range asked
+// for by a Range header. The SHA-256 of the content is its ETag.
+func (h *AttachmentsHandler) Download(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid attachment ID"})
+	}
+
+	attachment, f, err := h.service.Open(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return attachmentError(c, err, "Attachment", "Failed to read attachment")
+	}
+
+	etag := `"` + attachment.SHA256 + `"`
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		f.Close()
+		return c.SendStatus(304)
+	}
+
+	start, end := int64(0), attachment.Size-1
+	if header := c.Get(fiber.HeaderRange); header != "" && attachment.Size > 0 {
+		// A range for another version of the content is ignored, per If-Range
+		if ifRange := c.Get(fiber.HeaderIfRange); ifRange == "" || ifRange == etag {
+			var ok bool
+			start, end, ok = parseRange(header, attachment.Size)
+			if !ok {
+				f.Close()
+				c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", attachment.Size))
+				return c.Status(416).JSON(fiber.Map{"error": "Invalid range"})
+			}
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, attachment.Size))
+			c.Status(206)
+		}
+	}
+
+	// SendStream closes the file once the response is written
+	length := end - start + 1
+	body := struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, start, length), f}
+	return c.SendStream(body, int(length))
+}
+
+// Delete removes an attachment
+func (h *AttachmentsHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid attachment ID"})
+	}
+
+	if err := h.service.Delete(c.Context(), currentActor(c), id); err != nil {
+		return attachmentError(c, err, "Attachment", "Failed to delete attachment")
+	}
+
+	return c.SendStatus(204)
+}
+
+// parseRange returns the first and last byte of the single range of a Range
+// header, "bytes=first-last", "bytes=first-" or "bytes=-suffixLength", within
+// content of the given size
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false
+		}
+		return max(size-suffix, 0), size - 1, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// attachmentError maps errors of the attachment service to responses; entity
+// names what was not found
+func attachmentError(c *fiber.Ctx, err error, entity, message string) error {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": entity + " not found"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+	case errors.Is(err, service.ErrAttachmentTooLarge):
+		return c.Status(413).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidAttachment), errors.Is(err, service.ErrNoSuchMessage):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": message})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+type AuditHandler struct {
+	service *service.AuditService
+}
+
+func NewAuditHandler(service *service.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+func (h *AuditHandler) List(c *fiber.Ctx) error {
+	filters := models.AuditFilters{
+		EntityType: c.Query("entity_type"),
+		Action:     c.Query("action"),
+		Limit:      c.QueryInt("limit"),
+		Offset:     c.QueryInt("offset"),
+	}
+
+	if entityIDStr := c.Query("entity_id"); entityIDStr != "" {
+		entityID, err := strconv.Atoi(entityIDStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid entity_id"})
+		}
+		filters.EntityID = &entityID
+	}
+
+	if apiKeyIDStr := c.Query("api_key_id"); apiKeyIDStr != "" {
+		apiKeyID, err := strconv.Atoi(apiKeyIDStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid api_key_id"})
+		}
+		filters.APIKeyID = &apiKeyID
+	}
+
+	// Time bounds are RFC 3339 timestamps, e.g. 2026-01-06T00:00:00Z
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid since, expected RFC 3339 timestamp"})
+		}
+		filters.Since = &since
+	}
+
+	if untilStr := c.Query("until"); untilStr != "" {
+		until, err := time.Parse(time.RFC3339, untilStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid until, expected RFC 3339 timestamp"})
+		}
+		filters.Until = &until
+	}
+
+	page, err := h.service.List(c.Context(), currentUserID(c), filters)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to list audit events"})
+	}
+
+	return c.JSON(page)
+}
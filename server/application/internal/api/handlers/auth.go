@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+// CookieConfig controls the browser session cookies set by the session endpoints
+type CookieConfig struct {
+	Name     string
+	Secure   bool
+	SameSite string
+}
+
+type AuthHandler struct {
+	service           *service.AuthService
+	allowRegistration bool
+	cookie            CookieConfig
+}
+
+func NewAuthHandler(service *service.AuthService, allowRegistration bool, cookie CookieConfig) *AuthHandler {
+	return &AuthHandler{service: service, allowRegistration: allowRegistration, cookie: cookie}
+}
+
+func (h *AuthHandler) Register(c *fiber.Ctx) error {
+	if !h.allowRegistration {
+		return c.Status(403).JSON(fiber.Map{"error": "Registration is disabled", "code": "FORBIDDEN"})
+	}
+
+	var req models.RegisterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	user, err := h.service.Register(c.Context(), &req)
+	if errors.Is(err, service.ErrUsernameTaken) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error(), "code": "CONFLICT"})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(user)
+}
+
+func (h *AuthHandler) Login(c *fiber.Ctx) error {
+	var req models.LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	tokens, err := h.service.Login(c.Context(), &req)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error(), "code": "UNAUTHORIZED"})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(tokens)
+}
+
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	tokens, err := h.service.Refresh(c.Context(), req.RefreshToken)
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error(), "code": "UNAUTHORIZED"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to refresh token"})
+	}
+
+	return c.JSON(tokens)
+}
+
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	err := h.service.Logout(c.Context(), req.RefreshToken)
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		// Logging out of an already closed session is not an error
+		return c.Status(204).Send(nil)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to log out"})
+	}
+
+	return c.Status(204).Send(nil)
+}
+
+// CreateSession logs in and sets a session cookie for browser clients.
+// The CSRF token is returned in the body and in a cookie readable by scripts.
+func (h *AuthHandler) CreateSession(c *fiber.Ctx) error {
+	var req models.LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	session, err := h.service.LoginCookie(c.Context(), &req)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error(), "code": "UNAUTHORIZED"})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.setCookies(c, session.Token, session.CSRFToken, session.ExpiresAt)
+	return c.JSON(session)
+}
+
+// DeleteSession revokes the browser session and clears its cookies
+func (h *AuthHandler) DeleteSession(c *fiber.Ctx) error {
+	if err := h.service.LogoutCookie(c.Context(), c.Cookies(h.cookie.Name)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to log out"})
+	}
+
+	h.setCookies(c, "", "", time.Unix(0, 0))
+	return c.Status(204).Send(nil)
+}
+
+func (h *AuthHandler) setCookies(c *fiber.Ctx, token, csrfToken string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     h.cookie.Name,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   h.cookie.Secure,
+		HTTPOnly: true,
+		SameSite: h.cookie.SameSite,
+	})
+	c.Cookie(&fiber.Cookie{
+		Name:     h.cookie.Name + "_csrf",
+		Value:    csrfToken,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   h.cookie.Secure,
+		HTTPOnly: false,
+		SameSite: h.cookie.SameSite,
+	})
+}
+
+func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
+	var req models.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	err := h.service.ChangePassword(c.Context(), currentUserID(c), &req)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		return c.Status(401).JSON(fiber.Map{"error": "Current password is incorrect", "code": "UNAUTHORIZED"})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(204).Send(nil)
+}
@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
@@ -20,7 +24,7 @@ func (h *BackupHandler) Import(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	response, err := h.service.Import(c.Context(), &req)
+	response, err := h.service.Import(c.Context(), currentActor(c), &req)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to import backup"})
 	}
@@ -28,3 +32,67 @@ func (h *BackupHandler) Import(c *fiber.Ctx) error {
 	return c.JSON(response)
 }
 
+// ExportAttachments returns the user's attachments with their content, for the
+// extension to include in its backups
+func (h *BackupHandler) ExportAttachments(c *fiber.Ctx) error {
+	export, err := h.service.ExportAttachments(c.Context(), currentUserID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to export attachments"})
+	}
+
+	// SendStream closes the export once the response is written. An error
+	// past this point cuts the response short.
+	c.Type("json")
+	return c.SendStream(export)
+}
+
+// ImportAttachment restores one attachment of a backup from a multipart form:
+// its content as file, and its conversation_url, with optional
+// message_ordinal, sha256, source_url and created_at, as in ExportAttachments
+func (h *BackupHandler) ImportAttachment(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Missing file"})
+	}
+	item := models.BackupAttachment{
+		ConversationURL: c.FormValue("conversation_url"),
+		Filename:        file.Filename,
+		ContentType:     file.Header.Get(fiber.HeaderContentType),
+		SHA256:          c.FormValue("sha256"),
+	}
+	if item.ConversationURL == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "conversation_url is required"})
+	}
+	if ordinal := c.FormValue("message_ordinal"); ordinal != "" {
+		n, err := strconv.Atoi(ordinal)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid message_ordinal"})
+		}
+		item.MessageOrdinal = &n
+	}
+	if sourceURL := c.FormValue("source_url"); sourceURL != "" {
+		item.SourceURL = &sourceURL
+	}
+	if createdAt := c.FormValue("created_at"); createdAt != "" {
+		item.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid created_at"})
+		}
+	}
+
+	content, err := file.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid file"})
+	}
+	defer content.Close()
+
+	response, err := h.service.ImportAttachment(c.Context(), currentActor(c), &item, content)
+	if errors.Is(err, service.ErrAttachmentChecksum) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return attachmentError(c, err, "Conversation", "Failed to import attachment")
+	}
+
+	return c.JSON(response)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -17,7 +18,7 @@ func NewCollectionsHandler(service *service.CollectionService) *CollectionsHandl
 }
 
 func (h *CollectionsHandler) List(c *fiber.Ctx) error {
-	collections, err := h.service.List(c.Context())
+	collections, err := h.service.List(c.Context(), currentUserID(c))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to list collections"})
 	}
@@ -31,10 +32,14 @@ func (h *CollectionsHandler) Create(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	if err := h.service.Create(c.Context(), &collection); err != nil {
+	if err := h.service.Create(c.Context(), currentActor(c), &collection); err != nil {
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	c.Set(fiber.HeaderETag, collection.ETag())
 	return c.Status(201).JSON(collection)
 }
 
@@ -50,10 +55,47 @@ func (h *CollectionsHandler) Update(c *fiber.Ctx) error {
 	}
 
 	collection.ID = &id
-	if err := h.service.Update(c.Context(), &collection); err != nil {
+	if err := h.service.Update(c.Context(), currentActor(c), &collection, ifMatch(c)); err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		if errors.Is(err, service.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Collection not found"})
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	c.Set(fiber.HeaderETag, collection.ETag())
+	return c.JSON(collection)
+}
+
+// Patch applies the JSON Merge Patch (RFC 7386) in the request body to a collection
+func (h *CollectionsHandler) Patch(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+
+	collection, err := h.service.Patch(c.Context(), currentActor(c), id, c.Body(), ifMatch(c))
+	if err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		if errors.Is(err, service.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Collection not found"})
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderETag, collection.ETag())
 	return c.JSON(collection)
 }
 
@@ -63,7 +105,14 @@ func (h *CollectionsHandler) Delete(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid collection ID"})
 	}
 
-	if err := h.service.Delete(c.Context(), id); err != nil {
+	if err := h.service.Delete(c.Context(), currentActor(c), id, ifMatch(c)); err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete collection"})
 	}
 
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"mime"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
@@ -22,7 +25,7 @@ func (h *ConversationsHandler) GetByID(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
 	}
 
-	conv, err := h.service.GetByID(c.Context(), id)
+	conv, err := h.service.GetByID(c.Context(), currentUserID(c), id)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to get conversation"})
 	}
@@ -30,6 +33,7 @@ func (h *ConversationsHandler) GetByID(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
 	}
 
+	c.Set(fiber.HeaderETag, conv.ETag())
 	return c.JSON(conv)
 }
 
@@ -39,7 +43,7 @@ func (h *ConversationsHandler) GetByURL(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "URL parameter is required"})
 	}
 
-	conv, err := h.service.GetByCanonicalURL(c.Context(), url)
+	conv, err := h.service.GetByCanonicalURL(c.Context(), currentUserID(c), url)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to get conversation"})
 	}
@@ -47,6 +51,7 @@ func (h *ConversationsHandler) GetByURL(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
 	}
 
+	c.Set(fiber.HeaderETag, conv.ETag())
 	return c.JSON(conv)
 }
 
@@ -69,11 +74,55 @@ func (h *ConversationsHandler) Create(c *fiber.Ctx) error {
 		Version:      1,
 	}
 
-	if err := h.service.Upsert(c.Context(), conv); err != nil {
+	report, err := h.service.Upsert(c.Context(), currentActor(c), conv, req.MergeMode, req.Force, ifMatch(c))
+	if err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		var shrink *service.ShrinkError
+		if errors.As(err, &shrink) {
+			return c.Status(422).JSON(fiber.Map{
+				"error":           err.Error(),
+				"code":            "CONTENT_SHRINK",
+				"reason":          shrink.Reason,
+				"stored_length":   shrink.StoredLength,
+				"length":          shrink.Length,
+				"stored_messages": shrink.StoredMessages,
+				"messages":        shrink.Messages,
+			})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderETag, conv.ETag())
+	return c.Status(201).JSON(models.SaveConversationResponse{Conversation: *conv, Merge: report})
+}
+
+// Patch applies the JSON Merge Patch (RFC 7386) in the request body to a conversation
+func (h *ConversationsHandler) Patch(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	conv, err := h.service.Patch(c.Context(), currentActor(c), id, c.Body(), ifMatch(c))
+	if err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		if errors.Is(err, service.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(201).JSON(conv)
+	c.Set(fiber.HeaderETag, conv.ETag())
+	return c.JSON(conv)
 }
 
 func (h *ConversationsHandler) Delete(c *fiber.Ctx) error {
@@ -82,13 +131,305 @@ func (h *ConversationsHandler) Delete(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
 	}
 
-	if err := h.service.Delete(c.Context(), id); err != nil {
+	if err := h.service.Delete(c.Context(), currentActor(c), id, ifMatch(c)); err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete conversation"})
 	}
 
 	return c.Status(204).Send(nil)
 }
 
+// Messages returns the messages of a conversation. The optional from and to
+// query parameters select an inclusive range of 1-based ordinals, and role
+// keeps the messages of one role.
+func (h *ConversationsHandler) Messages(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	filters := models.MessageFilters{
+		Role: c.Query("role"),
+	}
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := strconv.Atoi(fromStr)
+		if err != nil || from < 1 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid from"})
+		}
+		filters.From = &from
+	}
+
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := strconv.Atoi(toStr)
+		if err != nil || to < 1 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid to"})
+		}
+		filters.To = &to
+	}
+
+	if filters.From != nil && filters.To != nil && *filters.To < *filters.From {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid range: to is before from"})
+	}
+	if filters.Role != "" && !models.IsValidMessageRole(filters.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid role"})
+	}
+
+	excludeReasoning, ok := reasoningQuery(c)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid reasoning, expected include or exclude"})
+	}
+	filters.ExcludeReasoning = excludeReasoning
+
+	list, err := h.service.Messages(c.Context(), currentUserID(c), id, filters)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to get messages"})
+	}
+	if list == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+
+	return c.JSON(list)
+}
+
+// Segments returns the answers, reasoning traces, tool calls and citations of
+// the messages of a conversation
+func (h *ConversationsHandler) Segments(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	filters := models.SegmentFilters{
+		Kinds: splitCommaSeparated(c.Query("kind")),
+	}
+	for _, kind := range filters.Kinds {
+		if !models.IsValidSegmentKind(kind) {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid kind"})
+		}
+	}
+
+	list, err := h.service.Segments(c.Context(), currentUserID(c), id, filters)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to get message segments"})
+	}
+	if list == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+
+	return c.JSON(list)
+}
+
+// Export downloads a conversation as a Markdown document
+func (h *ConversationsHandler) Export(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	excludeReasoning, ok := reasoningQuery(c)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid reasoning, expected include or exclude"})
+	}
+
+	conv, document, err := h.service.Export(c.Context(), currentUserID(c), id, excludeReasoning)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to export conversation"})
+	}
+	if conv == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": "conversation-" + strconv.Itoa(id) + ".md"}))
+	c.Set(fiber.HeaderContentType, "text/markdown; charset=utf-8")
+	return c.SendString(document)
+}
+
+// reasoningQuery reads the reasoning query parameter, include (the default)
+// or exclude, and reports whether reasoning is excluded; ok is false for
+// other values
+func reasoningQuery(c *fiber.Ctx) (exclude bool, ok bool) {
+	switch c.Query("reasoning") {
+	case "", "include":
+		return false, true
+	case "exclude":
+		return true, true
+	}
+	return false, false
+}
+
+func (h *ConversationsHandler) Versions(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	versions, err := h.service.Versions(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to list versions"})
+	}
+	if versions == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+
+	return c.JSON(versions)
+}
+
+func (h *ConversationsHandler) Version(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid version"})
+	}
+
+	v, err := h.service.Version(c.Context(), currentUserID(c), id, version)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to get version"})
+	}
+	if v == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Version not found"})
+	}
+
+	return c.JSON(v)
+}
+
+// Diff compares the content of two versions given by the from and to query
+// parameters. to defaults to the current version and from to the one before to.
+func (h *ConversationsHandler) Diff(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	var from, to *int
+	if fromStr := c.Query("from"); fromStr != "" {
+		version, err := strconv.Atoi(fromStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid from"})
+		}
+		from = &version
+	}
+
+	if toStr := c.Query("to"); toStr != "" {
+		version, err := strconv.Atoi(toStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid to"})
+		}
+		to = &version
+	}
+
+	diff, err := h.service.Diff(c.Context(), currentUserID(c), id, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to compare versions"})
+	}
+	if diff == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Version not found"})
+	}
+
+	return c.JSON(diff)
+}
+
+func (h *ConversationsHandler) RestoreVersion(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid version"})
+	}
+
+	conv, err := h.service.RestoreVersion(c.Context(), currentActor(c), id, version, ifMatch(c))
+	if err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+		case errors.Is(err, service.ErrVersionNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": "Version not found"})
+		case errors.Is(err, service.ErrForbidden):
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to restore version"})
+	}
+
+	c.Set(fiber.HeaderETag, conv.ETag())
+	return c.JSON(conv)
+}
+
+// Duplicates returns the likely duplicates of a conversation. The optional
+// max_distance query parameter is the number of fingerprint bits in which
+// near-duplicate content may differ.
+func (h *ConversationsHandler) Duplicates(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	maxDistance := service.DefaultDuplicateDistance
+	if distanceStr := c.Query("max_distance"); distanceStr != "" {
+		maxDistance, err = strconv.Atoi(distanceStr)
+		if err != nil || maxDistance < 0 || maxDistance > service.MaxDuplicateDistance {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid max_distance"})
+		}
+	}
+
+	duplicates, err := h.service.Duplicates(c.Context(), currentUserID(c), id, maxDistance)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to find duplicates"})
+	}
+	if duplicates == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+	}
+
+	return c.JSON(duplicates)
+}
+
+// Merge folds the conversation given by source_id into this one
+func (h *ConversationsHandler) Merge(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	var req models.MergeConversationRequest
+	if err := c.BodyParser(&req); err != nil || req.SourceID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "source_id is required"})
+	}
+
+	response, err := h.service.Merge(c.Context(), currentActor(c), id, req.SourceID, ifMatch(c))
+	if err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		switch {
+		case errors.Is(err, service.ErrMergeIntoItself):
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": "Conversation not found"})
+		case errors.Is(err, service.ErrForbidden):
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to merge conversations"})
+	}
+
+	c.Set(fiber.HeaderETag, response.ETag())
+	return c.JSON(response)
+}
+
 func (h *ConversationsHandler) Search(c *fiber.Ctx) error {
 	filters := models.SearchFilters{
 		Query:        c.Query("q"),
@@ -115,7 +456,75 @@ func (h *ConversationsHandler) Search(c *fiber.Ctx) error {
 		}
 	}
 
-	conversations, err := h.service.Search(c.Context(), filters)
+	// Derived metadata (see "Metadata" in the README)
+	filters.Language = c.Query("language")
+	filters.Model = c.Query("model")
+	filters.CodeLanguage = c.Query("code_language")
+
+	if hasCodeStr := c.Query("has_code"); hasCodeStr != "" {
+		hasCode, err := strconv.ParseBool(hasCodeStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid has_code"})
+		}
+		filters.HasCode = &hasCode
+	}
+
+	if minWordsStr := c.Query("min_words"); minWordsStr != "" {
+		minWords, err := strconv.Atoi(minWordsStr)
+		if err != nil || minWords < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid min_words"})
+		}
+		filters.MinWords = &minWords
+	}
+
+	if maxWordsStr := c.Query("max_words"); maxWordsStr != "" {
+		maxWords, err := strconv.Atoi(maxWordsStr)
+		if err != nil || maxWords < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid max_words"})
+		}
+		filters.MaxWords = &maxWords
+	}
+
+	if minTurnsStr := c.Query("min_turns"); minTurnsStr != "" {
+		minTurns, err := strconv.Atoi(minTurnsStr)
+		if err != nil || minTurns < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid min_turns"})
+		}
+		filters.MinTurns = &minTurns
+	}
+
+	if maxTurnsStr := c.Query("max_turns"); maxTurnsStr != "" {
+		maxTurns, err := strconv.Atoi(maxTurnsStr)
+		if err != nil || maxTurns < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid max_turns"})
+		}
+		filters.MaxTurns = &maxTurns
+	}
+
+	// Time bounds are RFC 3339 timestamps, e.g. 2026-01-06T00:00:00Z
+	if sinceStr := c.Query("messages_since"); sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid messages_since, expected RFC 3339 timestamp"})
+		}
+		filters.MessagesSince = &since
+	}
+
+	if untilStr := c.Query("messages_until"); untilStr != "" {
+		until, err := time.Parse(time.RFC3339, untilStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid messages_until, expected RFC 3339 timestamp"})
+		}
+		filters.MessagesUntil = &until
+	}
+
+	excludeReasoning, ok := reasoningQuery(c)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid reasoning, expected include or exclude"})
+	}
+	filters.ExcludeReasoning = excludeReasoning
+
+	conversations, err := h.service.Search(c.Context(), currentUserID(c), filters)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to search conversations"})
 	}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+type RelationsHandler struct {
+	service *service.RelationService
+}
+
+func NewRelationsHandler(service *service.RelationService) *RelationsHandler {
+	return &RelationsHandler{service: service}
+}
+
+// List returns the relations of a conversation
+func (h *RelationsHandler) List(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	relations, err := h.service.List(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return relationError(c, err, "Conversation", "Failed to list relations")
+	}
+
+	return c.JSON(relations)
+}
+
+// Create relates the conversation to the conversation given by target_id
+func (h *RelationsHandler) Create(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	var req models.CreateRelationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	relation, err := h.service.Create(c.Context(), currentActor(c), id, &req)
+	if err != nil {
+		return relationError(c, err, "Conversation", "Failed to create relation")
+	}
+
+	return c.Status(201).JSON(relation)
+}
+
+// Graph returns the neighborhood of a conversation. The optional depth query
+// parameter is the number of relations followed from it.
+func (h *RelationsHandler) Graph(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	depth := service.DefaultGraphDepth
+	if depthStr := c.Query("depth"); depthStr != "" {
+		depth, err = strconv.Atoi(depthStr)
+		if err != nil || depth < 1 || depth > service.MaxGraphDepth {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid depth"})
+		}
+	}
+
+	graph, err := h.service.Graph(c.Context(), currentUserID(c), id, depth)
+	if err != nil {
+		return relationError(c, err, "Conversation", "Failed to get graph")
+	}
+
+	return c.JSON(graph)
+}
+
+func (h *RelationsHandler) Get(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid relation ID"})
+	}
+
+	relation, err := h.service.Get(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return relationError(c, err, "Relation", "Failed to get relation")
+	}
+
+	return c.JSON(relation)
+}
+
+// Update changes the type and note of a relation
+func (h *RelationsHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid relation ID"})
+	}
+
+	var req models.UpdateRelationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	relation, err := h.service.Update(c.Context(), currentActor(c), id, &req)
+	if err != nil {
+		return relationError(c, err, "Relation", "Failed to update relation")
+	}
+
+	return c.JSON(relation)
+}
+
+func (h *RelationsHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid relation ID"})
+	}
+
+	if err := h.service.Delete(c.Context(), currentActor(c), id); err != nil {
+		return relationError(c, err, "Relation", "Failed to delete relation")
+	}
+
+	return c.SendStatus(204)
+}
+
+// relationError maps errors of the relation service to responses; entity
+// names what was not found
+func relationError(c *fiber.Ctx, err error, entity, message string) error {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": entity + " not found"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+	case errors.Is(err, service.ErrInvalidRelation):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrRelationExists):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": message})
+}
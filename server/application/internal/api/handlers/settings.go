@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
@@ -15,11 +17,12 @@ func NewSettingsHandler(service *service.SettingsService) *SettingsHandler {
 }
 
 func (h *SettingsHandler) Get(c *fiber.Ctx) error {
-	settings, err := h.service.Get(c.Context())
+	settings, err := h.service.Get(c.Context(), currentUserID(c))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to get settings"})
 	}
 
+	c.Set(fiber.HeaderETag, settings.ETag())
 	return c.JSON(settings)
 }
 
@@ -29,10 +32,29 @@ func (h *SettingsHandler) Update(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	if err := h.service.Update(c.Context(), &settings); err != nil {
+	if err := h.service.Update(c.Context(), currentActor(c), &settings, ifMatch(c)); err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	c.Set(fiber.HeaderETag, settings.ETag())
 	return c.JSON(settings)
 }
 
+// Patch applies the JSON Merge Patch (RFC 7386) in the request body to the settings
+func (h *SettingsHandler) Patch(c *fiber.Ctx) error {
+	settings, err := h.service.Patch(c.Context(), currentActor(c), c.Body(), ifMatch(c))
+	if err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderETag, settings.ETag())
+	return c.JSON(settings)
+}
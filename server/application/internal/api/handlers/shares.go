@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/markdown"
+)
+
+// SharePasswordHeader carries the password of a protected share link for JSON clients
+const SharePasswordHeader = "X-Share-Password"
+
+// shareContentSecurityPolicy forbids scripts, remote resources and framing on
+// shared pages; only the page's own inline styles and password form are allowed
+const shareContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'; base-uri 'none'"
+
+type SharesHandler struct {
+	service *service.ShareService
+}
+
+func NewSharesHandler(service *service.ShareService) *SharesHandler {
+	return &SharesHandler{service: service}
+}
+
+// List returns a handler listing the share links of an item of entityType
+func (h *SharesHandler) List(entityType string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid " + entityType + " ID"})
+		}
+
+		links, err := h.service.List(c.Context(), currentUserID(c), entityType, id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to list share links"})
+		}
+
+		return c.JSON(links)
+	}
+}
+
+// Create returns a handler sharing an item of entityType
+func (h *SharesHandler) Create(entityType string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid " + entityType + " ID"})
+		}
+
+		// The body is optional: an empty one creates a link without expiry or password
+		var req models.CreateShareLinkRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+			}
+		}
+
+		resp, err := h.service.Create(c.Context(), currentUserID(c), entityType, id, &req)
+		if err != nil {
+			if errors.Is(err, service.ErrNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": "Item not found"})
+			}
+			if errors.Is(err, service.ErrForbidden) {
+				return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+			}
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.Status(201).JSON(resp)
+	}
+}
+
+// Revoke returns a handler revoking a share link of an item of entityType
+func (h *SharesHandler) Revoke(entityType string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid " + entityType + " ID"})
+		}
+		shareID, err := strconv.Atoi(c.Params("shareId"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid share link ID"})
+		}
+
+		revoked, err := h.service.Revoke(c.Context(), currentUserID(c), entityType, id, shareID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke share link"})
+		}
+		if !revoked {
+			return c.Status(404).JSON(fiber.Map{"error": "Share link not found"})
+		}
+
+		return c.Status(204).Send(nil)
+	}
+}
+
+// View serves a shared item to anyone holding the token, as a standalone HTML
+// page or, for clients asking for it, as JSON. It is mounted outside /api and
+// needs no authentication.
+func (h *SharesHandler) View(c *fiber.Ctx) error {
+	c.Set("Content-Security-Policy", shareContentSecurityPolicy)
+	c.Set("X-Robots-Tag", "noindex, nofollow")
+	c.Set("Referrer-Policy", "no-referrer")
+	c.Set("X-Content-Type-Options", "nosniff")
+	c.Set("Cache-Control", "no-store")
+
+	wantsJSON := c.Query("format") == "json" || c.Accepts(fiber.MIMETextHTML, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON
+
+	password := c.Get(SharePasswordHeader)
+	if password == "" && c.Method() == fiber.MethodPost {
+		password = c.FormValue("password")
+	}
+
+	item, err := h.service.View(c.Context(), c.Params("token"), password)
+	if err != nil {
+		status, message := 500, "Failed to load shared item"
+		switch {
+		case errors.Is(err, service.ErrShareNotFound):
+			status, message = 404, "This link does not exist, has expired or was revoked"
+		case errors.Is(err, service.ErrSharePasswordRequired):
+			status, message = 401, "This link is protected by a password"
+		case errors.Is(err, service.ErrSharePasswordInvalid):
+			status, message = 401, "Invalid password"
+		}
+
+		if wantsJSON {
+			return c.Status(status).JSON(fiber.Map{"error": message})
+		}
+		return renderSharePage(c.Status(status), sharePage{
+			Title:         "Shared item",
+			Message:       message,
+			PasswordForm:  status == 401,
+			PasswordError: errors.Is(err, service.ErrSharePasswordInvalid),
+		})
+	}
+
+	if wantsJSON {
+		return c.JSON(item)
+	}
+	return renderSharePage(c, sharePage{
+		Title: item.Title,
+		Item:  item,
+		Body:  template.HTML(markdown.Render(item.Content)),
+	})
+}
+
+// sharePage is the data of shareTemplate
+type sharePage struct {
+	Title         string
+	Message       string
+	PasswordForm  bool
+	PasswordError bool
+	Item          *models.SharedItem
+	Body          template.HTML
+}
+
+func renderSharePage(c *fiber.Ctx, page sharePage) error {
+	var out strings.Builder
+	if err := shareTemplate.Execute(&out, page); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to render shared item"})
+	}
+	c.Type("html", "utf-8")
+	return c.SendString(out.String())
+}
+
+var shareTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 48rem; margin: 2rem auto; padding: 0 1rem; font: 16px/1.6 system-ui, sans-serif; color: #1f2328; }
+header { border-bottom: 1px solid #d0d7de; margin-bottom: 1.5rem; }
+.meta { color: #656d76; font-size: .875rem; }
+.tag { background: #eaeef2; border-radius: 1rem; padding: 0 .5rem; margin-right: .25rem; }
+pre { background: #f6f8fa; padding: 1rem; overflow: auto; border-radius: 6px; }
+code { font: .875rem ui-monospace, monospace; }
+blockquote { margin: 0; padding: 0 1rem; border-left: .25rem solid #d0d7de; color: #656d76; }
+.error { color: #cf222e; }
+</style>
+</head>
+<body>
+{{- if .Item}}
+<header>
+<h1>{{.Item.Title}}</h1>
+<p class="meta">
+{{- if .Item.Source}}{{.Item.Source}} · {{end}}
+{{- if .Item.Language}}{{.Item.Language}} · {{end}}
+{{- .Item.CreatedAt.Format "2006-01-02 15:04"}}
+{{- range .Item.Tags}} <span class="tag">{{.}}</span>{{end}}
+</p>
+</header>
+<main>
+{{.Body}}
+</main>
+{{- else}}
+<main>
+<p{{if .PasswordError}} class="error"{{end}}>{{.Message}}</p>
+{{- if .PasswordForm}}
+<form method="post">
+<label>Password <input type="password" name="password" autocomplete="off" autofocus required></label>
+<button type="submit">Open</button>
+</form>
+{{- end}}
+</main>
+{{- end}}
+</body>
+</html>
+`))
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -39,7 +40,14 @@ func (h *SnippetsHandler) List(c *fiber.Ctx) error {
 		}
 	}
 
-	snippets, err := h.service.List(c.Context(), filters)
+	// Parse collection_id
+	if collectionIDStr := c.Query("collection_id"); collectionIDStr != "" {
+		if collectionID, err := strconv.Atoi(collectionIDStr); err == nil {
+			filters.CollectionID = &collectionID
+		}
+	}
+
+	snippets, err := h.service.List(c.Context(), currentUserID(c), filters)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to list snippets"})
 	}
@@ -53,10 +61,11 @@ func (h *SnippetsHandler) Create(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	if err := h.service.Create(c.Context(), &snippet); err != nil {
+	if err := h.service.Create(c.Context(), currentActor(c), &snippet); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	c.Set(fiber.HeaderETag, snippet.ETag())
 	return c.Status(201).JSON(snippet)
 }
 
@@ -72,10 +81,47 @@ func (h *SnippetsHandler) Update(c *fiber.Ctx) error {
 	}
 
 	snippet.ID = &id
-	if err := h.service.Update(c.Context(), &snippet); err != nil {
+	if err := h.service.Update(c.Context(), currentActor(c), &snippet, ifMatch(c)); err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		if errors.Is(err, service.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Snippet not found"})
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	c.Set(fiber.HeaderETag, snippet.ETag())
+	return c.JSON(snippet)
+}
+
+// Patch applies the JSON Merge Patch (RFC 7386) in the request body to a snippet
+func (h *SnippetsHandler) Patch(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid snippet ID"})
+	}
+
+	snippet, err := h.service.Patch(c.Context(), currentActor(c), id, c.Body(), ifMatch(c))
+	if err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		if errors.Is(err, service.ErrNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Snippet not found"})
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderETag, snippet.ETag())
 	return c.JSON(snippet)
 }
 
@@ -85,7 +131,14 @@ func (h *SnippetsHandler) Delete(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid snippet ID"})
 	}
 
-	if err := h.service.Delete(c.Context(), id); err != nil {
+	if err := h.service.Delete(c.Context(), currentActor(c), id, ifMatch(c)); err != nil {
+		var conflict *service.ConflictError
+		if errors.As(err, &conflict) {
+			return conflictResponse(c, conflict)
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete snippet"})
 	}
 
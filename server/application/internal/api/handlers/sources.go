@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/sources"
+)
+
+type SourcesHandler struct{}
+
+func NewSourcesHandler() *SourcesHandler {
+	return &SourcesHandler{}
+}
+
+// List returns the providers of the source registry
+func (h *SourcesHandler) List(c *fiber.Ctx) error {
+	return c.JSON(sources.All())
+}
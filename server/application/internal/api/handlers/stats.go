@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+type StatsHandler struct {
+	service *service.StatsService
+}
+
+func NewStatsHandler(service *service.StatsService) *StatsHandler {
+	return &StatsHandler{service: service}
+}
+
+// Tokens returns the token counts of the user's conversations, with estimated
+// costs when a price table is configured
+func (h *StatsHandler) Tokens(c *fiber.Ctx) error {
+	filters := models.TokenStatsFilters{
+		Source: c.Query("source"),
+	}
+
+	// Time bounds are RFC 3339 timestamps, e.g. 2026-01-06T00:00:00Z
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid since, expected RFC 3339 timestamp"})
+		}
+		filters.Since = &since
+	}
+
+	if untilStr := c.Query("until"); untilStr != "" {
+		until, err := time.Parse(time.RFC3339, untilStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid until, expected RFC 3339 timestamp"})
+		}
+		filters.Until = &until
+	}
+
+	stats, err := h.service.Tokens(c.Context(), currentUserID(c), filters)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to compute token statistics"})
+	}
+
+	return c.JSON(stats)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/api/middleware"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+// trashReadScopes maps the entity types of the trash to the scope needed to list them
+var trashReadScopes = map[string]string{
+	models.EntityConversation: models.ScopeConversationsRead,
+	models.EntitySnippet:      models.ScopeSnippetsRead,
+	models.EntityCollection:   models.ScopeCollectionsRead,
+}
+
+type TrashHandler struct {
+	service *service.TrashService
+}
+
+func NewTrashHandler(service *service.TrashService) *TrashHandler {
+	return &TrashHandler{service: service}
+}
+
+// List returns the trash, limited to the entity types the credentials can read
+func (h *TrashHandler) List(c *fiber.Ctx) error {
+	principal := middleware.GetPrincipal(c)
+	entityTypes := []string{}
+	for entityType, scope := range trashReadScopes {
+		if principal != nil && principal.HasScope(scope) {
+			entityTypes = append(entityTypes, entityType)
+		}
+	}
+
+	trash, err := h.service.List(c.Context(), currentUserID(c), entityTypes)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to list trash"})
+	}
+
+	return c.JSON(trash)
+}
+
+func (h *TrashHandler) RestoreConversation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid conversation ID"})
+	}
+
+	conv, err := h.service.RestoreConversation(c.Context(), currentActor(c), id)
+	if err != nil {
+		return restoreError(c, err, "Conversation")
+	}
+
+	c.Set(fiber.HeaderETag, conv.ETag())
+	return c.JSON(conv)
+}
+
+func (h *TrashHandler) RestoreSnippet(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid snippet ID"})
+	}
+
+	snippet, err := h.service.RestoreSnippet(c.Context(), currentActor(c), id)
+	if err != nil {
+		return restoreError(c, err, "Snippet")
+	}
+
+	c.Set(fiber.HeaderETag, snippet.ETag())
+	return c.JSON(snippet)
+}
+
+func (h *TrashHandler) RestoreCollection(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid collection ID"})
+	}
+
+	collection, err := h.service.RestoreCollection(c.Context(), currentActor(c), id)
+	if err != nil {
+		return restoreError(c, err, "Collection")
+	}
+
+	c.Set(fiber.HeaderETag, collection.ETag())
+	return c.JSON(collection)
+}
+
+// restoreError answers a failed restore of an entity named entityName
+func restoreError(c *fiber.Ctx, err error, entityName string) error {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": entityName + " not found in trash"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+	case errors.Is(err, service.ErrRestoreConflict):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to restore " + strings.ToLower(entityName)})
+	}
+}
@@ -1,6 +1,45 @@
 package handlers
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/api/middleware"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+// currentUserID returns the ID of the authenticated user owning the request
+func currentUserID(c *fiber.Ctx) int {
+	if principal := middleware.GetPrincipal(c); principal != nil {
+		return principal.UserID
+	}
+	return 0
+}
+
+// currentActor identifies the caller of a mutating request for the audit log
+func currentActor(c *fiber.Ctx) models.Actor {
+	actor := models.Actor{IP: c.IP()}
+	if principal := middleware.GetPrincipal(c); principal != nil {
+		actor.UserID = principal.UserID
+		actor.APIKeyID = principal.APIKeyID
+	}
+	return actor
+}
+
+// ifMatch returns the If-Match precondition of the request, nil if it has none
+func ifMatch(c *fiber.Ctx) models.IfMatch {
+	return models.ParseIfMatch(c.Get(fiber.HeaderIfMatch))
+}
+
+// conflictResponse answers a write rejected by a ConflictError with 409, the
+// current copy of the entity and its ETag
+func conflictResponse(c *fiber.Ctx, conflict *service.ConflictError) error {
+	if entity, ok := conflict.Current.(interface{ ETag() string }); ok && entity.ETag() != "" {
+		c.Set(fiber.HeaderETag, entity.ETag())
+	}
+	return c.Status(409).JSON(fiber.Map{"error": "Version conflict", "current": conflict.Current})
+}
 
 func splitCommaSeparated(s string) []string {
 	if s == "" {
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/service"
+)
+
+type WorkspacesHandler struct {
+	service *service.WorkspaceService
+}
+
+func NewWorkspacesHandler(service *service.WorkspaceService) *WorkspacesHandler {
+	return &WorkspacesHandler{service: service}
+}
+
+func (h *WorkspacesHandler) List(c *fiber.Ctx) error {
+	workspaces, err := h.service.List(c.Context(), currentUserID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to list workspaces"})
+	}
+
+	return c.JSON(workspaces)
+}
+
+func (h *WorkspacesHandler) GetByID(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	workspace, err := h.service.GetByID(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to get workspace"})
+	}
+	if workspace == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Workspace not found"})
+	}
+
+	return c.JSON(workspace)
+}
+
+func (h *WorkspacesHandler) Create(c *fiber.Ctx) error {
+	var workspace models.Workspace
+	if err := c.BodyParser(&workspace); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.service.Create(c.Context(), currentActor(c), &workspace); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(workspace)
+}
+
+func (h *WorkspacesHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	var workspace models.Workspace
+	if err := c.BodyParser(&workspace); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	workspace.ID = &id
+	if err := h.service.Update(c.Context(), currentActor(c), &workspace); err != nil {
+		return workspaceError(c, err, "Workspace not found", "")
+	}
+
+	return c.JSON(workspace)
+}
+
+func (h *WorkspacesHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	if err := h.service.Delete(c.Context(), currentActor(c), id); err != nil {
+		return workspaceError(c, err, "Workspace not found", "Failed to delete workspace")
+	}
+
+	return c.Status(204).Send(nil)
+}
+
+func (h *WorkspacesHandler) Members(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	members, err := h.service.Members(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return workspaceError(c, err, "Workspace not found", "Failed to list workspace members")
+	}
+
+	return c.JSON(members)
+}
+
+func (h *WorkspacesHandler) UpdateMember(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+	userID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var req models.UpdateMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.service.UpdateMember(c.Context(), currentActor(c), id, userID, req.Role); err != nil {
+		return workspaceError(c, err, "Workspace member not found", "")
+	}
+
+	return c.JSON(models.WorkspaceMember{WorkspaceID: id, UserID: userID, Role: req.Role})
+}
+
+func (h *WorkspacesHandler) RemoveMember(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+	userID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.service.RemoveMember(c.Context(), currentActor(c), id, userID); err != nil {
+		return workspaceError(c, err, "Workspace member not found", "Failed to remove workspace member")
+	}
+
+	return c.Status(204).Send(nil)
+}
+
+func (h *WorkspacesHandler) Invitations(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	invitations, err := h.service.Invitations(c.Context(), currentUserID(c), id)
+	if err != nil {
+		return workspaceError(c, err, "Workspace not found", "Failed to list invitations")
+	}
+
+	return c.JSON(invitations)
+}
+
+func (h *WorkspacesHandler) CreateInvitation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+
+	// The body is optional: an empty one invites a viewer for the default duration
+	var req models.CreateInvitationRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	resp, err := h.service.CreateInvitation(c.Context(), currentActor(c), id, &req)
+	if err != nil {
+		return workspaceError(c, err, "Workspace not found", "")
+	}
+
+	return c.Status(201).JSON(resp)
+}
+
+func (h *WorkspacesHandler) RevokeInvitation(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid workspace ID"})
+	}
+	invitationID, err := strconv.Atoi(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid invitation ID"})
+	}
+
+	revoked, err := h.service.RevokeInvitation(c.Context(), currentActor(c), id, invitationID)
+	if err != nil {
+		return workspaceError(c, err, "Workspace not found", "Failed to revoke invitation")
+	}
+	if !revoked {
+		return c.Status(404).JSON(fiber.Map{"error": "Invitation not found"})
+	}
+
+	return c.Status(204).Send(nil)
+}
+
+func (h *WorkspacesHandler) AcceptInvitation(c *fiber.Ctx) error {
+	var req models.AcceptInvitationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Token == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "token is required"})
+	}
+
+	workspace, err := h.service.AcceptInvitation(c.Context(), currentActor(c), req.Token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvitationNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Invitation not found, expired or already used"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to accept invitation"})
+	}
+
+	return c.JSON(workspace)
+}
+
+// workspaceError maps workspace service errors to responses. Other errors are
+// answered with 500 and failureMessage, or with 400 and the error itself when
+// failureMessage is empty, for requests whose input the service validates.
+func workspaceError(c *fiber.Ctx, err error, notFoundMessage, failureMessage string) error {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": notFoundMessage})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(403).JSON(fiber.Map{"error": "Insufficient workspace role"})
+	case errors.Is(err, service.ErrLastAdmin):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case failureMessage == "":
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(500).JSON(fiber.Map{"error": failureMessage})
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// StreamLimits replace the server's timeouts and body limit for the routes
+// that stream attachment content, which take longer and carry more than
+// other requests
+type StreamLimits struct {
+	// Timeout bounds the transfer of a streamed request or response body
+	Timeout time.Duration
+	// MaxBodySize bounds the body of a backup attachment import
+	MaxBodySize int
+}
+
+// HeaderReceived gives attachment downloads and the backup attachment export
+// Timeout to write their response, and backup attachment imports Timeout to
+// read their body of up to MaxBodySize. Other requests keep the server's
+// limits. Set it as the HeaderReceived hook of the app's server.
+func (l StreamLimits) HeaderReceived(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	path := strings.ToLower(string(header.RequestURI()))
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	switch {
+	case header.IsGet() && (path == "/api/backup/attachments" ||
+		strings.HasPrefix(path, "/api/attachments/") && strings.HasSuffix(path, "/content")):
+		return fasthttp.RequestConfig{WriteTimeout: l.Timeout}
+	case header.IsPost() && path == "/api/backup/attachments":
+		return fasthttp.RequestConfig{ReadTimeout: l.Timeout, MaxRequestBodySize: l.MaxBodySize}
+	}
+	return fasthttp.RequestConfig{}
+}
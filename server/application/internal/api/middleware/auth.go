@@ -1,67 +1,96 @@
 package middleware
 
 import (
-	"strings"
-
 	"github.com/gofiber/fiber/v2"
-	jwtware "github.com/gofiber/jwt/v3"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
 )
 
+// principalKey is the c.Locals key holding the authenticated *models.Principal
+const principalKey = "principal"
+
+// ErrUnauthorized is returned when no authenticator accepted the request
+var ErrUnauthorized = fiber.NewError(fiber.StatusUnauthorized, "Missing or invalid credentials")
+
 // AuthConfig holds the authentication configuration
 type AuthConfig struct {
-	JWTSecret   string
+	JWTSecret    string
 	APIKeySecret string
+	// OIDC verifies RS256/ES256 tokens from an external identity provider (optional)
+	OIDC *auth.OIDCVerifier
+	// OIDCRequiredRole, when set, rejects provider tokens whose groups lack this role
+	OIDCRequiredRole string
+	// SessionCookieName enables browser session cookies when set
+	SessionCookieName string
+	Users             *repository.UserRepository
+	APIKeys           *repository.APIKeyRepository
+	Sessions          *repository.AuthSessionRepository
+}
+
+// Authenticator resolves the caller of a request from one kind of credential.
+// It returns a nil principal and nil error when the request carries no credential
+// it recognises, so the next authenticator in the chain gets a chance. Credentials
+// it recognises but rejects produce an error (usually a *fiber.Error).
+type Authenticator interface {
+	Authenticate(c *fiber.Ctx) (*models.Principal, error)
 }
 
-// Auth creates authentication middleware
-// Supports both JWT and API key authentication
+// Auth creates authentication middleware from the configured authenticators.
+// API keys, locally issued JWTs, OIDC tokens and session cookies can all be enabled at once.
 func Auth(config AuthConfig) fiber.Handler {
-	// If JWT secret is provided, use JWT middleware
+	authenticators := []Authenticator{
+		&APIKeyAuthenticator{
+			Secret:  config.APIKeySecret,
+			Users:   config.Users,
+			APIKeys: config.APIKeys,
+		},
+	}
 	if config.JWTSecret != "" {
-		return jwtware.New(jwtware.Config{
-			SigningKey: []byte(config.JWTSecret),
-			ErrorHandler: func(c *fiber.Ctx, err error) error {
-				return c.Status(401).JSON(fiber.Map{
-					"error": "Unauthorized",
-					"code":  "UNAUTHORIZED",
-				})
-			},
+		authenticators = append(authenticators, &LocalJWTAuthenticator{
+			Secret:   config.JWTSecret,
+			Users:    config.Users,
+			Sessions: config.Sessions,
+		})
+	}
+	if config.OIDC != nil {
+		authenticators = append(authenticators, &OIDCAuthenticator{
+			Verifier:     config.OIDC,
+			RequiredRole: config.OIDCRequiredRole,
+			Users:        config.Users,
+		})
+	}
+	if config.SessionCookieName != "" {
+		authenticators = append(authenticators, &SessionCookieAuthenticator{
+			CookieName: config.SessionCookieName,
+			Users:      config.Users,
+			Sessions:   config.Sessions,
 		})
 	}
 
-	// Otherwise, use API key authentication
-	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Missing Authorization header",
-				"code":  "UNAUTHORIZED",
-			})
-		}
-
-		// Extract token from "Bearer <token>" format
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Invalid Authorization header format",
-				"code":  "UNAUTHORIZED",
-			})
-		}
-
-		token := parts[1]
+	return Chain(authenticators...)
+}
 
-		// Validate API key
-		if config.APIKeySecret == "" || token != config.APIKeySecret {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Invalid API key",
-				"code":  "UNAUTHORIZED",
-			})
+// Chain runs authenticators in order. The first one resolving a principal wins;
+// if none does, the request is rejected with ErrUnauthorized.
+func Chain(authenticators ...Authenticator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.Authenticate(c)
+			if err != nil {
+				return err
+			}
+			if principal != nil {
+				c.Locals(principalKey, principal)
+				return c.Next()
+			}
 		}
-
-		// Store API key in locals for handlers
-		c.Locals("api_key", token)
-
-		return c.Next()
+		return ErrUnauthorized
 	}
 }
 
+// GetPrincipal returns the authenticated principal stored by Auth
+func GetPrincipal(c *fiber.Ctx) *models.Principal {
+	principal, _ := c.Locals(principalKey).(*models.Principal)
+	return principal
+}
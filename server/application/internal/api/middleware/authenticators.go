@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
+)
+
+// CSRFHeader carries the CSRF token on unsafe requests authenticated by session cookie
+const CSRFHeader = "X-CSRF-Token"
+
+// APIKeyAuthenticator accepts the static API_KEY_SECRET and per-user API keys
+type APIKeyAuthenticator struct {
+	Secret  string
+	Users   *repository.UserRepository
+	APIKeys *repository.APIKeyRepository
+}
+
+func (a *APIKeyAuthenticator) Authenticate(c *fiber.Ctx) (*models.Principal, error) {
+	token := bearerToken(c)
+	if token == "" {
+		return nil, nil
+	}
+
+	// The static API key acts on behalf of the default user with full access
+	if auth.ValidateAPIKey(token, a.Secret) {
+		c.Locals("api_key", token)
+		return principalFor(c, a.Users, models.DefaultUsername, []string{models.ScopeAdmin})
+	}
+
+	if !strings.HasPrefix(token, auth.APIKeyPrefix) {
+		return nil, nil
+	}
+
+	key, err := a.APIKeys.GetByHash(c.Context(), auth.HashAPIKey(token))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || !key.IsActive(time.Now()) {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid API key")
+	}
+
+	user, err := a.Users.GetByID(c.Context(), key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid API key")
+	}
+
+	// Last-use tracking is best effort and must not fail the request
+	_ = a.APIKeys.TouchLastUsed(c.Context(), *key.ID)
+
+	return &models.Principal{
+		UserID:   user.ID,
+		Username: user.Username,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+		Roles:    user.Roles,
+	}, nil
+}
+
+// LocalJWTAuthenticator accepts HS256 tokens signed with the shared JWT secret,
+// including access tokens issued by /api/auth/login
+type LocalJWTAuthenticator struct {
+	Secret   string
+	Users    *repository.UserRepository
+	Sessions *repository.AuthSessionRepository
+}
+
+func (a *LocalJWTAuthenticator) Authenticate(c *fiber.Ctx) (*models.Principal, error) {
+	token := bearerToken(c)
+	if token == "" || auth.TokenAlgorithm(token) != "HS256" {
+		return nil, nil
+	}
+
+	claims, err := auth.VerifyAccessToken(a.Secret, token)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
+	}
+
+	// The JWT subject identifies the user owning the data
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Token has no subject")
+	}
+
+	// Tokens issued by /api/auth/login belong to a session that can be revoked
+	if sid, ok := claims["sid"].(float64); ok {
+		session, err := a.Sessions.GetByID(c.Context(), int(sid))
+		if err != nil {
+			return nil, err
+		}
+		if session == nil || !session.IsActive(time.Now()) {
+			return nil, fiber.NewError(fiber.StatusUnauthorized, "Token has been revoked")
+		}
+	}
+
+	return principalFor(c, a.Users, subject, scopesFromClaims(claims))
+}
+
+// OIDCAuthenticator accepts RS256/ES256 tokens from the configured identity provider.
+// The provider subject is linked to a local user and its groups become roles.
+type OIDCAuthenticator struct {
+	Verifier     *auth.OIDCVerifier
+	RequiredRole string
+	Users        *repository.UserRepository
+}
+
+func (a *OIDCAuthenticator) Authenticate(c *fiber.Ctx) (*models.Principal, error) {
+	token := bearerToken(c)
+	if token == "" || !auth.IsAsymmetricToken(token) {
+		return nil, nil
+	}
+
+	identity, err := a.Verifier.Verify(c.Context(), token)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
+	}
+
+	if a.RequiredRole != "" && !containsString(identity.Groups, a.RequiredRole) {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Missing required role: "+a.RequiredRole)
+	}
+
+	user, err := a.Users.GetOrCreateExternal(
+		c.Context(), identity.Issuer, identity.Subject, identity.Username, identity.Groups,
+	)
+	if errors.Is(err, repository.ErrUsernameConflict) {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Identity conflicts with an existing local account")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Principal{
+		UserID:   user.ID,
+		Username: user.Username,
+		Scopes:   []string{models.ScopeAdmin},
+		Roles:    user.Roles,
+	}, nil
+}
+
+// SessionCookieAuthenticator accepts browser sessions opened by /api/auth/session.
+// Because browsers attach cookies to cross-site requests, unsafe methods must
+// also echo the session's CSRF token in the X-CSRF-Token header.
+type SessionCookieAuthenticator struct {
+	CookieName string
+	Users      *repository.UserRepository
+	Sessions   *repository.AuthSessionRepository
+}
+
+func (a *SessionCookieAuthenticator) Authenticate(c *fiber.Ctx) (*models.Principal, error) {
+	cookie := c.Cookies(a.CookieName)
+	if cookie == "" {
+		return nil, nil
+	}
+
+	session, err := a.Sessions.GetByCookieHash(c.Context(), auth.HashToken(cookie))
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || !session.IsActive(time.Now()) {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Session has expired")
+	}
+
+	if !isSafeMethod(c.Method()) {
+		csrfToken := c.Get(CSRFHeader)
+		if csrfToken == "" || session.CSRFHash == nil ||
+			subtle.ConstantTimeCompare([]byte(auth.HashToken(csrfToken)), []byte(*session.CSRFHash)) != 1 {
+			return nil, fiber.NewError(fiber.StatusForbidden, "Missing or invalid CSRF token")
+		}
+	}
+
+	user, err := a.Users.GetByID(c.Context(), session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Session has expired")
+	}
+
+	return &models.Principal{
+		UserID:   user.ID,
+		Username: user.Username,
+		Scopes:   session.Scopes,
+		Roles:    user.Roles,
+	}, nil
+}
+
+// bearerToken extracts the token from a "Bearer <token>" Authorization header,
+// or returns an empty string if there is none
+func bearerToken(c *fiber.Ctx) string {
+	parts := strings.Split(c.Get("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return ""
+	}
+	return parts[1]
+}
+
+// scopesFromClaims reads the "scopes" claim. Tokens without one were minted
+// by hand with the shared secret and keep full access.
+func scopesFromClaims(claims jwt.MapClaims) []string {
+	raw, ok := claims["scopes"].([]interface{})
+	if !ok {
+		return []string{models.ScopeAdmin}
+	}
+	scopes := make([]string, 0, len(raw))
+	for _, s := range raw {
+		if scope, ok := s.(string); ok {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// principalFor maps a username to a local user, creating it on first use
+func principalFor(c *fiber.Ctx, users *repository.UserRepository, username string, scopes []string) (*models.Principal, error) {
+	user, err := users.GetOrCreate(c.Context(), username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Principal{
+		UserID:   user.ID,
+		Username: user.Username,
+		Scopes:   scopes,
+		Roles:    user.Roles,
+	}, nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5"
 )
@@ -12,13 +14,14 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 	message := "Internal server error"
 
 	// Check if it's a Fiber error
-	if e, ok := err.(*fiber.Error); ok {
+	var e *fiber.Error
+	if errors.As(err, &e) {
 		code = e.Code
 		message = e.Message
 	}
 
 	// Check for database errors
-	if err == pgx.ErrNoRows {
+	if errors.Is(err, pgx.ErrNoRows) {
 		code = fiber.StatusNotFound
 		message = "Resource not found"
 	}
@@ -40,6 +43,10 @@ func getErrorCode(statusCode int) string {
 		return "FORBIDDEN"
 	case 404:
 		return "NOT_FOUND"
+	case 409:
+		return "CONFLICT"
+	case 429:
+		return "TOO_MANY_REQUESTS"
 	case 500:
 		return "INTERNAL_SERVER_ERROR"
 	case 503:
@@ -48,4 +55,3 @@ func getErrorCode(statusCode int) string {
 		return "UNKNOWN_ERROR"
 	}
 }
-
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireScope rejects requests whose principal was not granted scope
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return checkScope(c, scope)
+	}
+}
+
+// RequireReadWriteScope enforces readScope on safe methods (GET, HEAD)
+// and writeScope on every other method
+func RequireReadWriteScope(readScope, writeScope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if isSafeMethod(c.Method()) {
+			return checkScope(c, readScope)
+		}
+		return checkScope(c, writeScope)
+	}
+}
+
+func checkScope(c *fiber.Ctx, scope string) error {
+	principal := GetPrincipal(c)
+	if principal == nil {
+		return ErrUnauthorized
+	}
+	if !principal.HasScope(scope) {
+		return fiber.NewError(fiber.StatusForbidden, "Missing required scope: "+scope)
+	}
+	return c.Next()
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/api/handlers"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/api/middleware"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
 )
 
 type Handlers struct {
@@ -18,13 +21,30 @@ type Handlers struct {
 	Settings      *handlers.SettingsHandler
 	Backup        *handlers.BackupHandler
 	Health        *handlers.HealthHandler
+	APIKeys       *handlers.APIKeysHandler
+	Auth          *handlers.AuthHandler
+	Audit         *handlers.AuditHandler
+	Shares        *handlers.SharesHandler
+	Workspaces    *handlers.WorkspacesHandler
+	Trash         *handlers.TrashHandler
+	Sources       *handlers.SourcesHandler
+	Attachments   *handlers.AttachmentsHandler
+	Relations     *handlers.RelationsHandler
+	Annotations   *handlers.AnnotationsHandler
+	Stats         *handlers.StatsHandler
 }
 
 type MiddlewareConfig struct {
-	JWTSecret     string
-	APIKeySecret   string
-	CORSOrigins   []string
-	RateLimitMax  int
+	JWTSecret         string
+	APIKeySecret      string
+	CORSOrigins       []string
+	RateLimitMax      int
+	Users             *repository.UserRepository
+	APIKeys           *repository.APIKeyRepository
+	Sessions          *repository.AuthSessionRepository
+	OIDC              *auth.OIDCVerifier
+	OIDCRequiredRole  string
+	SessionCookieName string
 }
 
 func SetupRoutes(app *fiber.App, h *Handlers, mwConfig MiddlewareConfig) {
@@ -43,8 +63,9 @@ func SetupRoutes(app *fiber.App, h *Handlers, mwConfig MiddlewareConfig) {
 			}
 			return false
 		},
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,If-Match,If-None-Match,If-Range,Range," + middleware.CSRFHeader + "," + handlers.SharePasswordHeader + "," + handlers.UploadOffsetHeader,
+		ExposeHeaders:    "ETag,Accept-Ranges,Content-Range,Content-Disposition," + handlers.UploadOffsetHeader,
 		AllowCredentials: true, // Needed for API key authentication
 	}))
 
@@ -56,8 +77,9 @@ func SetupRoutes(app *fiber.App, h *Handlers, mwConfig MiddlewareConfig) {
 		},
 	}))
 
-	// Error handler
-	app.Use(middleware.ErrorHandler)
+	// Public share links, outside /api and without authentication
+	app.Get("/s/:token", h.Shares.View)
+	app.Post("/s/:token", h.Shares.View)
 
 	// API routes
 	api := app.Group("/api")
@@ -65,43 +87,162 @@ func SetupRoutes(app *fiber.App, h *Handlers, mwConfig MiddlewareConfig) {
 	// Public routes
 	api.Get("/health", h.Health.Check)
 
+	// Account and session routes.
+	// Must be registered before the protected group, whose middleware applies to all of /api.
+	authRoutes := api.Group("/auth")
+	authRoutes.Post("/register", h.Auth.Register)
+	authRoutes.Post("/session", h.Auth.CreateSession)
+	authRoutes.Delete("/session", h.Auth.DeleteSession)
+
+	// Token issuance needs a signing secret
+	if mwConfig.JWTSecret != "" {
+		authRoutes.Post("/login", h.Auth.Login)
+		authRoutes.Post("/refresh", h.Auth.Refresh)
+		authRoutes.Post("/logout", h.Auth.Logout)
+	}
+
 	// Protected routes
 	authMw := middleware.Auth(middleware.AuthConfig{
-		JWTSecret:    mwConfig.JWTSecret,
-		APIKeySecret: mwConfig.APIKeySecret,
+		JWTSecret:         mwConfig.JWTSecret,
+		APIKeySecret:      mwConfig.APIKeySecret,
+		Users:             mwConfig.Users,
+		APIKeys:           mwConfig.APIKeys,
+		Sessions:          mwConfig.Sessions,
+		OIDC:              mwConfig.OIDC,
+		OIDCRequiredRole:  mwConfig.OIDCRequiredRole,
+		SessionCookieName: mwConfig.SessionCookieName,
 	})
 
 	protected := api.Group("", authMw)
 
 	// Conversations routes
-	conversations := protected.Group("/conversations")
+	conversations := protected.Group("/conversations",
+		middleware.RequireReadWriteScope(models.ScopeConversationsRead, models.ScopeConversationsWrite))
+	// Static paths are registered before /:id, which would match them first
+	conversations.Get("/search", h.Conversations.Search)
 	conversations.Get("/:id", h.Conversations.GetByID)
 	conversations.Get("/url/:url", h.Conversations.GetByURL)
 	conversations.Post("", h.Conversations.Create)
+	conversations.Patch("/:id", h.Conversations.Patch)
 	conversations.Delete("/:id", h.Conversations.Delete)
-	conversations.Get("/search", h.Conversations.Search)
+	conversations.Get("/:id/messages", h.Conversations.Messages)
+	conversations.Get("/:id/segments", h.Conversations.Segments)
+	conversations.Get("/:id/export", h.Conversations.Export)
+	conversations.Get("/:id/versions", h.Conversations.Versions)
+	conversations.Get("/:id/versions/diff", h.Conversations.Diff)
+	conversations.Get("/:id/versions/:version", h.Conversations.Version)
+	conversations.Post("/:id/versions/:version/restore", h.Conversations.RestoreVersion)
+	conversations.Get("/:id/duplicates", h.Conversations.Duplicates)
+	conversations.Post("/:id/merge", h.Conversations.Merge)
+	conversations.Get("/:id/attachments", h.Attachments.List)
+	conversations.Post("/:id/attachments", h.Attachments.Upload)
+	conversations.Post("/:id/attachments/uploads", h.Attachments.CreateUpload)
+	conversations.Get("/:id/relations", h.Relations.List)
+	conversations.Post("/:id/relations", h.Relations.Create)
+	conversations.Get("/:id/graph", h.Relations.Graph)
+	conversations.Get("/:id/annotations", h.Annotations.ListByConversation)
+	conversations.Post("/:id/annotations", h.Annotations.Create)
+	conversations.Get("/:id/shares", h.Shares.List(models.EntityConversation))
+	conversations.Post("/:id/shares", h.Shares.Create(models.EntityConversation))
+	conversations.Delete("/:id/shares/:shareId", h.Shares.Revoke(models.EntityConversation))
+
+	// Attachment routes; access follows access to their conversation
+	attachments := protected.Group("/attachments",
+		middleware.RequireReadWriteScope(models.ScopeConversationsRead, models.ScopeConversationsWrite))
+	attachments.Get("/uploads/:uploadId", h.Attachments.GetUpload)
+	attachments.Patch("/uploads/:uploadId", h.Attachments.AppendUpload)
+	attachments.Delete("/uploads/:uploadId", h.Attachments.CancelUpload)
+	attachments.Get("/:id", h.Attachments.Get)
+	attachments.Get("/:id/content", h.Attachments.Download)
+	attachments.Delete("/:id", h.Attachments.Delete)
+
+	// Relation routes; access follows access to their conversations
+	relations := protected.Group("/relations",
+		middleware.RequireReadWriteScope(models.ScopeConversationsRead, models.ScopeConversationsWrite))
+	relations.Get("/:id", h.Relations.Get)
+	relations.Put("/:id", h.Relations.Update)
+	relations.Delete("/:id", h.Relations.Delete)
+
+	// Annotation routes; annotations are private to the user who made them
+	annotations := protected.Group("/annotations",
+		middleware.RequireReadWriteScope(models.ScopeConversationsRead, models.ScopeConversationsWrite))
+	annotations.Get("", h.Annotations.List)
+	annotations.Get("/:id", h.Annotations.Get)
+	annotations.Put("/:id", h.Annotations.Update)
+	annotations.Delete("/:id", h.Annotations.Delete)
+
+	// Statistics over the conversations the user can read
+	protected.Get("/stats/tokens", middleware.RequireScope(models.ScopeConversationsRead), h.Stats.Tokens)
 
 	// Snippets routes
-	snippets := protected.Group("/snippets")
+	snippets := protected.Group("/snippets",
+		middleware.RequireReadWriteScope(models.ScopeSnippetsRead, models.ScopeSnippetsWrite))
 	snippets.Get("", h.Snippets.List)
 	snippets.Post("", h.Snippets.Create)
 	snippets.Put("/:id", h.Snippets.Update)
+	snippets.Patch("/:id", h.Snippets.Patch)
 	snippets.Delete("/:id", h.Snippets.Delete)
+	snippets.Get("/:id/shares", h.Shares.List(models.EntitySnippet))
+	snippets.Post("/:id/shares", h.Shares.Create(models.EntitySnippet))
+	snippets.Delete("/:id/shares/:shareId", h.Shares.Revoke(models.EntitySnippet))
 
 	// Collections routes
-	collections := protected.Group("/collections")
+	collections := protected.Group("/collections",
+		middleware.RequireReadWriteScope(models.ScopeCollectionsRead, models.ScopeCollectionsWrite))
 	collections.Get("", h.Collections.List)
 	collections.Post("", h.Collections.Create)
 	collections.Put("/:id", h.Collections.Update)
+	collections.Patch("/:id", h.Collections.Patch)
 	collections.Delete("/:id", h.Collections.Delete)
 
 	// Settings routes
-	settings := protected.Group("/settings")
+	settings := protected.Group("/settings",
+		middleware.RequireReadWriteScope(models.ScopeSettingsRead, models.ScopeSettingsWrite))
 	settings.Get("", h.Settings.Get)
 	settings.Post("", h.Settings.Update)
+	settings.Patch("", h.Settings.Patch)
+
+	// Source registry
+	protected.Get("/sources", h.Sources.List)
+
+	// Trash routes
+	trash := protected.Group("/trash")
+	trash.Get("", h.Trash.List)
+	trash.Post("/conversations/:id/restore", middleware.RequireScope(models.ScopeConversationsWrite), h.Trash.RestoreConversation)
+	trash.Post("/snippets/:id/restore", middleware.RequireScope(models.ScopeSnippetsWrite), h.Trash.RestoreSnippet)
+	trash.Post("/collections/:id/restore", middleware.RequireScope(models.ScopeCollectionsWrite), h.Trash.RestoreCollection)
 
 	// Backup routes
 	backup := protected.Group("/backup")
-	backup.Post("/import", h.Backup.Import)
+	backup.Post("/import", middleware.RequireScope(models.ScopeBackupImport), h.Backup.Import)
+	backup.Get("/attachments", middleware.RequireScope(models.ScopeBackupExport), h.Backup.ExportAttachments)
+	backup.Post("/attachments", middleware.RequireScope(models.ScopeBackupImport), h.Backup.ImportAttachment)
+
+	// Workspace routes
+	workspaces := protected.Group("/workspaces",
+		middleware.RequireReadWriteScope(models.ScopeWorkspacesRead, models.ScopeWorkspacesWrite))
+	workspaces.Get("", h.Workspaces.List)
+	workspaces.Post("", h.Workspaces.Create)
+	workspaces.Post("/invitations/accept", h.Workspaces.AcceptInvitation)
+	workspaces.Get("/:id", h.Workspaces.GetByID)
+	workspaces.Put("/:id", h.Workspaces.Update)
+	workspaces.Delete("/:id", h.Workspaces.Delete)
+	workspaces.Get("/:id/members", h.Workspaces.Members)
+	workspaces.Put("/:id/members/:userId", h.Workspaces.UpdateMember)
+	workspaces.Delete("/:id/members/:userId", h.Workspaces.RemoveMember)
+	workspaces.Get("/:id/invitations", h.Workspaces.Invitations)
+	workspaces.Post("/:id/invitations", h.Workspaces.CreateInvitation)
+	workspaces.Delete("/:id/invitations/:invitationId", h.Workspaces.RevokeInvitation)
+
+	// Audit log routes
+	protected.Get("/audit", middleware.RequireScope(models.ScopeAuditRead), h.Audit.List)
+
+	// Account routes
+	protected.Post("/auth/password", middleware.RequireScope(models.ScopeAdmin), h.Auth.ChangePassword)
+
+	// API key management routes
+	keys := protected.Group("/keys", middleware.RequireScope(models.ScopeAdmin))
+	keys.Get("", h.APIKeys.List)
+	keys.Post("", h.APIKeys.Create)
+	keys.Delete("/:id", h.APIKeys.Revoke)
 }
-
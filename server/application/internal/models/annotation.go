@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Annotation colors
+const (
+	AnnotationYellow = "yellow"
+	AnnotationGreen  = "green"
+	AnnotationBlue   = "blue"
+	AnnotationPink   = "pink"
+	AnnotationPurple = "purple"
+	AnnotationOrange = "orange"
+)
+
+// IsValidAnnotationColor reports whether color is a known annotation color
+func IsValidAnnotationColor(color string) bool {
+	switch color {
+	case AnnotationYellow, AnnotationGreen, AnnotationBlue, AnnotationPink, AnnotationPurple, AnnotationOrange:
+		return true
+	}
+	return false
+}
+
+// Annotation highlights a range of the content of a conversation, with an
+// optional note and tags. StartOffset and EndOffset count characters (Unicode
+// code points) of the content. Quote is the highlighted text, and Prefix and
+// Suffix the text around it, used to find it again when the content changes.
+// Orphaned is set when the quote is no longer in the content; the annotation
+// then keeps its last offsets.
+type Annotation struct {
+	ID             *int      `json:"id,omitempty" db:"id"`
+	UserID         int       `json:"user_id" db:"user_id"`
+	ConversationID int       `json:"conversation_id" db:"conversation_id"`
+	StartOffset    int       `json:"start_offset" db:"start_offset"`
+	EndOffset      int       `json:"end_offset" db:"end_offset"`
+	Quote          string    `json:"quote" db:"quote"`
+	Prefix         string    `json:"prefix" db:"prefix"`
+	Suffix         string    `json:"suffix" db:"suffix"`
+	Color          string    `json:"color" db:"color"`
+	Note           *string   `json:"note,omitempty" db:"note"`
+	Tags           []string  `json:"tags" db:"tags"`
+	Orphaned       bool      `json:"orphaned" db:"orphaned"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CreateAnnotationRequest highlights the range [StartOffset, EndOffset) of a
+// conversation. With a Quote, the range is checked against it, and the
+// occurrence of the quote nearest to StartOffset is taken if it differs.
+type CreateAnnotationRequest struct {
+	StartOffset int      `json:"start_offset"`
+	EndOffset   int      `json:"end_offset"`
+	Quote       string   `json:"quote,omitempty"`
+	Color       string   `json:"color,omitempty"`
+	Note        *string  `json:"note,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// UpdateAnnotationRequest replaces the color, note and tags of an annotation
+type UpdateAnnotationRequest struct {
+	Color string   `json:"color,omitempty"`
+	Note  *string  `json:"note,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// AnnotationPage is one page of annotations, newest first
+type AnnotationPage struct {
+	Annotations []Annotation `json:"annotations"`
+	Limit       int          `json:"limit"`
+	Offset      int          `json:"offset"`
+	HasMore     bool         `json:"has_more"`
+}
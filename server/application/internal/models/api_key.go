@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// API key scopes
+const (
+	ScopeConversationsRead  = "conversations:read"
+	ScopeConversationsWrite = "conversations:write"
+	ScopeSnippetsRead       = "snippets:read"
+	ScopeSnippetsWrite      = "snippets:write"
+	ScopeCollectionsRead    = "collections:read"
+	ScopeCollectionsWrite   = "collections:write"
+	ScopeSettingsRead       = "settings:read"
+	ScopeSettingsWrite      = "settings:write"
+	ScopeBackupImport       = "backup:import"
+	ScopeBackupExport       = "backup:export"
+	ScopeAuditRead          = "audit:read"
+	ScopeWorkspacesRead     = "workspaces:read"
+	ScopeWorkspacesWrite    = "workspaces:write"
+	// ScopeAdmin grants every other scope, including API key management
+	ScopeAdmin = "admin"
+)
+
+// AllScopes lists every scope that can be granted to an API key
+var AllScopes = []string{
+	ScopeConversationsRead,
+	ScopeConversationsWrite,
+	ScopeSnippetsRead,
+	ScopeSnippetsWrite,
+	ScopeCollectionsRead,
+	ScopeCollectionsWrite,
+	ScopeSettingsRead,
+	ScopeSettingsWrite,
+	ScopeBackupImport,
+	ScopeBackupExport,
+	ScopeAuditRead,
+	ScopeWorkspacesRead,
+	ScopeWorkspacesWrite,
+	ScopeAdmin,
+}
+
+// IsValidScope reports whether scope is a known scope
+func IsValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey represents a per-user API key. The key itself is never stored, only its hash.
+type APIKey struct {
+	ID         *int       `json:"id,omitempty" db:"id"`
+	UserID     int        `json:"-" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// IsActive reports whether the key is neither revoked nor expired at the given time
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// CreateAPIKeyRequest represents a request to create an API key
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required"`
+	Scopes    []string   `json:"scopes" validate:"required"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAPIKeyResponse is returned once on creation and is the only time the key is visible
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Attachment is an image or file of a conversation. MessageOrdinal ties it to
+// one of the conversation's messages. SHA256 addresses its content in the
+// blob store; attachments with the same content share it.
+type Attachment struct {
+	ID             *int      `json:"id,omitempty" db:"id"`
+	UserID         int       `json:"user_id" db:"user_id"`
+	ConversationID int       `json:"conversation_id" db:"conversation_id"`
+	MessageOrdinal *int      `json:"message_ordinal,omitempty" db:"message_ordinal"`
+	Filename       string    `json:"filename" db:"filename"`
+	ContentType    string    `json:"content_type" db:"content_type"`
+	Size           int64     `json:"size" db:"size"`
+	SHA256         string    `json:"sha256" db:"sha256"`
+	SourceURL      *string   `json:"source_url,omitempty" db:"source_url"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// AttachmentUpload is a file being uploaded in parts. Received is the number
+// of bytes stored so far, the offset of the next part.
+type AttachmentUpload struct {
+	ID             *int      `json:"id,omitempty" db:"id"`
+	UserID         int       `json:"user_id" db:"user_id"`
+	ConversationID int       `json:"conversation_id" db:"conversation_id"`
+	MessageOrdinal *int      `json:"message_ordinal,omitempty" db:"message_ordinal"`
+	Filename       string    `json:"filename" db:"filename"`
+	ContentType    string    `json:"content_type" db:"content_type"`
+	Size           int64     `json:"size" db:"size"`
+	Received       int64     `json:"received" db:"received"`
+	SourceURL      *string   `json:"source_url,omitempty" db:"source_url"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// CreateAttachmentUploadRequest starts the upload of a file of Size bytes
+type CreateAttachmentUploadRequest struct {
+	Filename       string  `json:"filename"`
+	ContentType    string  `json:"content_type,omitempty"`
+	Size           int64   `json:"size"`
+	MessageOrdinal *int    `json:"message_ordinal,omitempty"`
+	SourceURL      *string `json:"source_url,omitempty"`
+}
+
+// AttachmentUploadResponse reports the state of an upload after a part, and
+// the attachment it became once complete
+type AttachmentUploadResponse struct {
+	Upload     AttachmentUpload `json:"upload"`
+	Attachment *Attachment      `json:"attachment,omitempty"`
+}
+
+// BackupAttachment is an attachment in a backup, with its content. It refers
+// to its conversation by canonical URL, since IDs differ between databases.
+// Data is base64-encoded in JSON, and left out when empty.
+type BackupAttachment struct {
+	ConversationURL string    `json:"conversation_url"`
+	MessageOrdinal  *int      `json:"message_ordinal,omitempty"`
+	Filename        string    `json:"filename"`
+	ContentType     string    `json:"content_type"`
+	Size            int64     `json:"size"`
+	SHA256          string    `json:"sha256"`
+	SourceURL       *string   `json:"source_url,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	Data            []byte    `json:"data,omitempty"`
+}
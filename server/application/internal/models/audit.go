@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Audit actions
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	// AuditActionRestore records an entity taken out of the trash
+	AuditActionRestore = "restore"
+)
+
+// Audited entity types. Workspace member events have the workspace ID as
+// entity ID and record the member's role as a "member:<user ID>" change.
+const (
+	EntityConversation    = "conversation"
+	EntitySnippet         = "snippet"
+	EntityCollection      = "collection"
+	EntitySettings        = "settings"
+	EntityWorkspace       = "workspace"
+	EntityWorkspaceMember = "workspace_member"
+	EntityAttachment      = "attachment"
+	EntityRelation        = "relation"
+	EntityAnnotation      = "annotation"
+)
+
+// Actor identifies who performs a mutation, for the audit log
+type Actor struct {
+	UserID   int
+	APIKeyID *int
+	IP       string
+}
+
+// AuditChange holds the old and new value of a changed field.
+// Old is null for created entities, New is null for deleted ones.
+type AuditChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// AuditEvent records one mutation of a user's data
+type AuditEvent struct {
+	ID            int64                  `json:"id" db:"id"`
+	UserID        int                    `json:"-" db:"user_id"`
+	ActorID       *int                   `json:"actor_id,omitempty" db:"actor_id"`
+	ActorUsername *string                `json:"actor_username,omitempty"`
+	APIKeyID      *int                   `json:"api_key_id,omitempty" db:"api_key_id"`
+	IP            *string                `json:"ip,omitempty" db:"ip"`
+	Action        string                 `json:"action" db:"action"`
+	EntityType    string                 `json:"entity_type" db:"entity_type"`
+	EntityID      int                    `json:"entity_id" db:"entity_id"`
+	Changes       map[string]AuditChange `json:"changes" db:"changes"`
+	CreatedAt     time.Time              `json:"created_at" db:"created_at"`
+}
+
+// AuditEventPage is one page of audit events, newest first
+type AuditEventPage struct {
+	Events  []AuditEvent `json:"events"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+	HasMore bool         `json:"has_more"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// AuthSession represents a login session. Refresh tokens and the access tokens
+// issued from them are only valid while their session is active.
+type AuthSession struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CookieHash *string    `json:"-" db:"cookie_hash"` // Set for browser cookie sessions only
+	CSRFHash   *string    `json:"-" db:"csrf_hash"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// IsActive reports whether the session is neither revoked nor expired at the given time
+func (s *AuthSession) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken represents a single-use refresh token belonging to a session
+type RefreshToken struct {
+	ID        int        `json:"id" db:"id"`
+	SessionID int        `json:"session_id" db:"session_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
+
+// RegisterRequest represents a request to create a local account
+type RegisterRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// LoginRequest represents a username/password login.
+// Scopes optionally narrows the access granted to the issued tokens.
+type LoginRequest struct {
+	Username string   `json:"username" validate:"required"`
+	Password string   `json:"password" validate:"required"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+// RefreshRequest carries a refresh token for the refresh and logout endpoints
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// ChangePasswordRequest represents a request to set or change the caller's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password,omitempty"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+// CookieSession holds the secrets of a new browser session. Token goes into an
+// HttpOnly cookie; CSRFToken must be echoed in the X-CSRF-Token header.
+type CookieSession struct {
+	Token     string    `json:"-"`
+	CSRFToken string    `json:"csrf_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TokenResponse is returned by login and refresh
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Access token lifetime in seconds
+}
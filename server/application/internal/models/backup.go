@@ -11,7 +11,8 @@ package models
 //	  "conversations": [...],
 //	  "snippets": [...],
 //	  "collections": [...],
-//	  "settings": {...}
+//	  "settings": {...},
+//	  "attachments": [...]
 //	}
 type BackupData struct {
 	Version       string         `json:"version"`       // "1.0"
@@ -20,6 +21,8 @@ type BackupData struct {
 	Snippets      []Snippet      `json:"snippets"`      // Array of Snippet objects
 	Collections   []Collection   `json:"collections"`   // Array of Collection objects
 	Settings      Settings       `json:"settings"`      // Settings object
+	// Attachments with their content, from GET /api/backup/attachments
+	Attachments []BackupAttachment `json:"attachments,omitempty"`
 }
 
 // Note: The Conversation, Snippet, Collection, and Settings types are already defined
@@ -2,12 +2,17 @@ package models
 
 import "time"
 
-// Collection represents a collection used to organize conversations
+// Collection represents a collection used to organize conversations and snippets.
+// A collection with a WorkspaceID is shared with the members of that workspace;
+// the workspace is set on creation and does not change.
 type Collection struct {
-	ID        *int       `json:"id,omitempty" db:"id"`
-	Name      string     `json:"name" db:"name"`
-	Icon      *string    `json:"icon,omitempty" db:"icon"`
-	Color     *string    `json:"color,omitempty" db:"color"`
-	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ID          *int       `json:"id,omitempty" db:"id"`
+	OwnerID     int        `json:"owner_id" db:"user_id"`
+	WorkspaceID *int       `json:"workspace_id,omitempty" db:"workspace_id"`
+	Name        string     `json:"name" db:"name"`
+	Icon        *string    `json:"icon,omitempty" db:"icon"`
+	Color       *string    `json:"color,omitempty" db:"color"`
+	Version     int        `json:"version" db:"version"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
-
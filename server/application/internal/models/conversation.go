@@ -2,9 +2,23 @@ package models
 
 import "time"
 
+// ConversationMetadata is derived from the content of a conversation (see
+// pkg/enrichment). Fields the content does not show are empty.
+type ConversationMetadata struct {
+	WordCount      int        `json:"word_count" db:"word_count"`
+	TurnCount      int        `json:"turn_count" db:"turn_count"`
+	Language       *string    `json:"language,omitempty" db:"language"`
+	CodeBlockCount int        `json:"code_block_count" db:"code_block_count"`
+	CodeLanguages  []string   `json:"code_languages" db:"code_languages"`
+	Model          *string    `json:"model,omitempty" db:"model"`
+	FirstMessageAt *time.Time `json:"first_message_at,omitempty" db:"first_message_at"`
+	LastMessageAt  *time.Time `json:"last_message_at,omitempty" db:"last_message_at"`
+}
+
 // Conversation represents a saved conversation from an AI platform
 type Conversation struct {
 	ID             *int       `json:"id,omitempty" db:"id"`
+	OwnerID        int        `json:"owner_id" db:"user_id"`
 	CanonicalURL   string     `json:"canonical_url" db:"canonical_url"`
 	ShareURL       *string    `json:"share_url,omitempty" db:"share_url"`
 	Source         string     `json:"source" db:"source"`
@@ -17,5 +31,15 @@ type Conversation struct {
 	Version        int        `json:"version" db:"version"`
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// TokenCount is the number of tokens of the content for Tokenizer, counted
+	// on every save, and nil like Metadata
+	TokenCount *int    `json:"token_count,omitempty" db:"token_count"`
+	Tokenizer  *string `json:"tokenizer,omitempty" db:"tokenizer"`
+	// Metadata is derived from the content on every save, and nil for
+	// conversations saved before it existed and not saved since
+	Metadata *ConversationMetadata `json:"metadata,omitempty" db:"-"`
+	// Annotations are the user's annotations that matched a search
+	Annotations []Annotation `json:"annotations,omitempty" db:"-"`
 }
 
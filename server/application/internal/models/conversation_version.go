@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ConversationVersion is a saved state of a conversation. SavedAt is when the
+// state was saved. Current is true for the conversation as it is now.
+// Content is only set when a single version is fetched.
+type ConversationVersion struct {
+	ConversationID int       `json:"conversation_id"`
+	Version        int       `json:"version"`
+	Title          string    `json:"title"`
+	Description    *string   `json:"description,omitempty"`
+	Tags           []string  `json:"tags"`
+	Content        *string   `json:"content,omitempty"`
+	ContentLength  int       `json:"content_length"`
+	SavedAt        time.Time `json:"saved_at"`
+	Current        bool      `json:"current"`
+}
+
+// ConversationDiff is the unified diff of the content of two conversation versions
+type ConversationDiff struct {
+	ConversationID int    `json:"conversation_id"`
+	From           int    `json:"from"`
+	To             int    `json:"to"`
+	Diff           string `json:"diff"`
+}
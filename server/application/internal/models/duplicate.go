@@ -0,0 +1,23 @@
+package models
+
+// Duplicate matches, telling why a conversation is a likely duplicate of another
+const (
+	// DuplicateMatchURL is a conversation saved from the canonical or share URL of the other
+	DuplicateMatchURL = "url"
+	// DuplicateMatchContent is a conversation whose content fingerprint is close to the other's
+	DuplicateMatchContent = "content"
+)
+
+// DuplicateConversation is a likely duplicate of a conversation. Similarity
+// compares their content fingerprints, from 0 (unrelated) to 1 (same).
+type DuplicateConversation struct {
+	Conversation
+	Match      string  `json:"match"`
+	Similarity float64 `json:"similarity"`
+}
+
+// MergeConversationRequest asks to fold the conversation SourceID into
+// another one and move it to the trash
+type MergeConversationRequest struct {
+	SourceID int `json:"source_id"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VersionETag returns the entity tag of a version of an entity
+func VersionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ETag returns the entity tag of the conversation, or "" for nil
+func (c *Conversation) ETag() string {
+	if c == nil {
+		return ""
+	}
+	return VersionETag(c.Version)
+}
+
+// ETag returns the entity tag of the snippet, or "" for nil
+func (s *Snippet) ETag() string {
+	if s == nil {
+		return ""
+	}
+	return VersionETag(s.Version)
+}
+
+// ETag returns the entity tag of the collection, or "" for nil
+func (c *Collection) ETag() string {
+	if c == nil {
+		return ""
+	}
+	return VersionETag(c.Version)
+}
+
+// ETag returns the entity tag of the settings, or "" for nil
+func (s *Settings) ETag() string {
+	if s == nil {
+		return ""
+	}
+	return VersionETag(s.Version)
+}
+
+// IfMatch is the precondition of a write: the entity tags the client expects
+// the entity to have. A nil IfMatch sets no precondition.
+type IfMatch []string
+
+// ParseIfMatch parses an If-Match header, returning nil for an empty header
+func ParseIfMatch(header string) IfMatch {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+	tags := IfMatch{}
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Matches reports whether an entity with the given tag satisfies the
+// precondition. A missing entity has the tag "" and never matches, not even "*".
+// Weak tags never match, as If-Match uses the strong comparison.
+func (m IfMatch) Matches(etag string) bool {
+	if m == nil {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+	for _, tag := range m {
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
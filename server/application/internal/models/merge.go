@@ -0,0 +1,41 @@
+package models
+
+// Merge modes of a conversation save: merge splices the incoming content into
+// the stored one (the default), replace stores the incoming content as is
+const (
+	MergeModeMerge   = "merge"
+	MergeModeReplace = "replace"
+)
+
+// Merge results, telling how the saved content relates to the stored one
+const (
+	// MergeCreated is a new conversation
+	MergeCreated = "created"
+	// MergeUnchanged is incoming content already contained in the stored content
+	MergeUnchanged = "unchanged"
+	// MergeAppended is incoming content extending the stored content at the end
+	MergeAppended = "appended"
+	// MergeMerged is incoming content overlapping the stored content, spliced with it
+	MergeMerged = "merged"
+	// MergeReplaced is incoming content replacing the stored content, in replace
+	// mode or when it diverges from a common beginning, as after an edited message
+	MergeReplaced = "replaced"
+	// MergeConflict is incoming content unrelated to the stored content, which is kept
+	MergeConflict = "conflict"
+)
+
+// MergeReport tells how the content of a saved conversation was merged.
+// Lengths are in bytes; Overlap is the length of the content found in both.
+type MergeReport struct {
+	Result         string `json:"result"`
+	StoredLength   int    `json:"stored_length"`
+	IncomingLength int    `json:"incoming_length"`
+	Length         int    `json:"length"`
+	Overlap        int    `json:"overlap,omitempty"`
+}
+
+// SaveConversationResponse is the response to a conversation save
+type SaveConversationResponse struct {
+	Conversation
+	Merge *MergeReport `json:"merge"`
+}
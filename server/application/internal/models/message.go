@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// Message roles, see transcript.Parse
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+	MessageRoleSystem    = "system"
+	MessageRoleTool      = "tool"
+	MessageRoleUnknown   = "unknown"
+)
+
+// IsValidMessageRole reports whether role is a known message role
+func IsValidMessageRole(role string) bool {
+	switch role {
+	case MessageRoleUser, MessageRoleAssistant, MessageRoleSystem, MessageRoleTool, MessageRoleUnknown:
+		return true
+	}
+	return false
+}
+
+// Message segment kinds, see segments.Split
+const (
+	SegmentKindAnswer    = "answer"
+	SegmentKindReasoning = "reasoning"
+	SegmentKindToolCall  = "tool_call"
+	SegmentKindCitation  = "citation"
+)
+
+// IsValidSegmentKind reports whether kind is a known message segment kind
+func IsValidSegmentKind(kind string) bool {
+	switch kind {
+	case SegmentKindAnswer, SegmentKindReasoning, SegmentKindToolCall, SegmentKindCitation:
+		return true
+	}
+	return false
+}
+
+// Message is one turn of a conversation, parsed from its content.
+// Ordinal is the 1-based position of the message in the conversation.
+type Message struct {
+	ID             *int      `json:"id,omitempty" db:"id"`
+	ConversationID int       `json:"conversation_id" db:"conversation_id"`
+	Ordinal        int       `json:"ordinal" db:"ordinal"`
+	Role           string    `json:"role" db:"role"`
+	Content        string    `json:"content" db:"content"`
+	Model          *string   `json:"model,omitempty" db:"model"`
+	TokenCount     *int      `json:"token_count,omitempty" db:"token_count"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	// Segments are the parts of the content, set when the message is parsed
+	Segments []MessageSegment `json:"-" db:"-"`
+}
+
+// MessageList is the response of the conversation messages endpoint.
+// Total counts all messages of the conversation, before range and role selection.
+type MessageList struct {
+	ConversationID int       `json:"conversation_id"`
+	Total          int       `json:"total"`
+	Messages       []Message `json:"messages"`
+}
+
+// MessageSegment is a part of a message: its answer, a reasoning trace, a tool
+// call or a citation. Ordinal is the 1-based position of the segment in its message.
+type MessageSegment struct {
+	ID             *int   `json:"id,omitempty" db:"id"`
+	MessageID      int    `json:"message_id" db:"message_id"`
+	MessageOrdinal int    `json:"message_ordinal" db:"-"`
+	Ordinal        int    `json:"ordinal" db:"ordinal"`
+	Kind           string `json:"kind" db:"kind"`
+	Content        string `json:"content" db:"content"`
+}
+
+// SegmentList is the response of the conversation segments endpoint
+type SegmentList struct {
+	ConversationID int              `json:"conversation_id"`
+	Segments       []MessageSegment `json:"segments"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// Relation types. A relation goes from its source conversation to its target:
+// the source continues the target, was forked from it, or references it.
+// RelationAnswersSamePrompt goes both ways and is stored with the lower
+// conversation ID as source.
+const (
+	RelationContinues         = "continues"
+	RelationForkedFrom        = "forked_from"
+	RelationAnswersSamePrompt = "answers_same_prompt"
+	RelationReferences        = "references"
+)
+
+// IsValidRelationType reports whether t is a known relation type
+func IsValidRelationType(t string) bool {
+	switch t {
+	case RelationContinues, RelationForkedFrom, RelationAnswersSamePrompt, RelationReferences:
+		return true
+	}
+	return false
+}
+
+// IsSymmetricRelation reports whether relations of type t go both ways
+func IsSymmetricRelation(t string) bool {
+	return t == RelationAnswersSamePrompt
+}
+
+// ConversationRelation links two conversations. UserID is the user who
+// created it.
+type ConversationRelation struct {
+	ID        *int      `json:"id,omitempty" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	SourceID  int       `json:"source_id" db:"source_id"`
+	TargetID  int       `json:"target_id" db:"target_id"`
+	Type      string    `json:"type" db:"type"`
+	Note      *string   `json:"note,omitempty" db:"note"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CreateRelationRequest relates a conversation to the conversation TargetID
+type CreateRelationRequest struct {
+	TargetID int     `json:"target_id"`
+	Type     string  `json:"type"`
+	Note     *string `json:"note,omitempty"`
+}
+
+// UpdateRelationRequest changes the type and note of a relation
+type UpdateRelationRequest struct {
+	Type string  `json:"type"`
+	Note *string `json:"note,omitempty"`
+}
+
+// GraphNode is a conversation of a graph, Depth relations away from its root
+type GraphNode struct {
+	ID           int       `json:"id"`
+	Title        string    `json:"title"`
+	Source       string    `json:"source"`
+	CanonicalURL string    `json:"canonical_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	Depth        int       `json:"depth"`
+}
+
+// ConversationGraph is the neighborhood of a conversation: the conversations
+// related to it, directly or through others, and the relations between them.
+// Truncated is set when the depth or node limit left related conversations out.
+type ConversationGraph struct {
+	RootID    int                    `json:"root_id"`
+	Nodes     []GraphNode            `json:"nodes"`
+	Edges     []ConversationRelation `json:"edges"`
+	Truncated bool                   `json:"truncated"`
+}
+
+// BackupRelation is a relation in a backup. It refers to its conversations
+// by canonical URL, since IDs differ between databases.
+type BackupRelation struct {
+	SourceURL string    `json:"source_url"`
+	TargetURL string    `json:"target_url"`
+	Type      string    `json:"type"`
+	Note      *string   `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -1,6 +1,8 @@
 package models
 
-// CreateConversationRequest represents a request to create a conversation
+// CreateConversationRequest represents a request to create a conversation, or to
+// save it again. MergeMode is MergeModeMerge (the default) or MergeModeReplace.
+// Force saves content that the shrink guard would reject as truncated.
 type CreateConversationRequest struct {
 	CanonicalURL string   `json:"canonical_url" validate:"required"`
 	ShareURL     *string  `json:"share_url,omitempty"`
@@ -11,6 +13,8 @@ type CreateConversationRequest struct {
 	Tags         []string `json:"tags,omitempty"`
 	CollectionID *int     `json:"collection_id,omitempty"`
 	Ignore       bool     `json:"ignore,omitempty"`
+	MergeMode    string   `json:"merge_mode,omitempty"`
+	Force        bool     `json:"force,omitempty"`
 }
 
 // UpdateConversationRequest represents a request to update a conversation
@@ -37,6 +41,9 @@ type BackupImportRequest struct {
 	Snippets      []Snippet      `json:"snippets,omitempty"`
 	Collections   []Collection   `json:"collections,omitempty"`
 	Settings      *Settings      `json:"settings,omitempty"`
+	// Attachments and relations are imported after the conversations they belong to
+	Attachments []BackupAttachment `json:"attachments,omitempty"`
+	Relations   []BackupRelation   `json:"relations,omitempty"`
 }
 
 // BackupImportResponse represents the result of a backup import
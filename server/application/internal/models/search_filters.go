@@ -1,11 +1,34 @@
 package models
 
+import "time"
+
 // SearchFilters represents filters for searching conversations
 type SearchFilters struct {
 	Query        string
 	Source       string
 	Tags         []string
 	CollectionID *int
+	// Filters on the derived metadata, see ConversationMetadata
+	Language      string
+	Model         string
+	CodeLanguage  string
+	HasCode       *bool
+	MinWords      *int
+	MaxWords      *int
+	MinTurns      *int
+	MaxTurns      *int
+	MessagesSince *time.Time
+	MessagesUntil *time.Time
+	// ExcludeReasoning matches the query against the answers and citations
+	// of messages only, not their reasoning traces and tool calls
+	ExcludeReasoning bool
+}
+
+// HasMetadataFilters reports whether the filters select on derived metadata
+func (f SearchFilters) HasMetadataFilters() bool {
+	return f.Language != "" || f.Model != "" || f.CodeLanguage != "" || f.HasCode != nil ||
+		f.MinWords != nil || f.MaxWords != nil || f.MinTurns != nil || f.MaxTurns != nil ||
+		f.MessagesSince != nil || f.MessagesUntil != nil
 }
 
 // SnippetFilters represents filters for listing snippets
@@ -13,5 +36,43 @@ type SnippetFilters struct {
 	Language             string
 	Tags                 []string
 	SourceConversationID *int
+	CollectionID         *int
+}
+
+// AuditFilters represents filters for listing audit events
+type AuditFilters struct {
+	EntityType string
+	EntityID   *int
+	Action     string
+	APIKeyID   *int
+	Since      *time.Time
+	Until      *time.Time
+	Limit      int
+	Offset     int
 }
 
+// MessageFilters selects messages of a conversation by inclusive ordinal range and role
+type MessageFilters struct {
+	From *int
+	To   *int
+	Role string
+	// ExcludeReasoning strips reasoning traces and tool calls from the content
+	ExcludeReasoning bool
+}
+
+// SegmentFilters selects message segments of a conversation by kind, all
+// kinds when Kinds is empty
+type SegmentFilters struct {
+	Kinds []string
+}
+
+// AnnotationFilters represents filters for listing annotations across conversations
+type AnnotationFilters struct {
+	Query          string
+	Tags           []string
+	Color          string
+	ConversationID *int
+	Orphaned       *bool
+	Limit          int
+	Offset         int
+}
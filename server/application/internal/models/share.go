@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// ShareLink grants read-only access to one conversation or snippet (EntityType
+// is EntityConversation or EntitySnippet) to anyone holding its token.
+// Only the token hash is stored.
+type ShareLink struct {
+	ID           *int       `json:"id,omitempty" db:"id"`
+	UserID       int        `json:"-" db:"user_id"`
+	EntityType   string     `json:"entity_type" db:"entity_type"`
+	EntityID     int        `json:"entity_id" db:"entity_id"`
+	Prefix       string     `json:"prefix" db:"prefix"`
+	TokenHash    string     `json:"-" db:"token_hash"`
+	PasswordHash *string    `json:"-" db:"password_hash"`
+	HasPassword  bool       `json:"has_password"`
+	ViewCount    int        `json:"view_count" db:"view_count"`
+	LastViewedAt *time.Time `json:"last_viewed_at,omitempty" db:"last_viewed_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// IsActive reports whether the link is neither revoked nor expired at the given time
+func (l *ShareLink) IsActive(now time.Time) bool {
+	if l.RevokedAt != nil {
+		return false
+	}
+	if l.ExpiresAt != nil && !now.Before(*l.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// CreateShareLinkRequest represents a request to share a conversation or snippet
+type CreateShareLinkRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Password  *string    `json:"password,omitempty"`
+}
+
+// CreateShareLinkResponse is returned once on creation and is the only time the token is visible
+type CreateShareLinkResponse struct {
+	ShareLink
+	Token string `json:"token"`
+	Path  string `json:"path"`
+}
+
+// SharedItem is the read-only view of a shared conversation or snippet
+type SharedItem struct {
+	EntityType string    `json:"entity_type"`
+	Title      string    `json:"title"`
+	Source     string    `json:"source,omitempty"`
+	Language   string    `json:"language,omitempty"`
+	Tags       []string  `json:"tags"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	ViewCount  int       `json:"view_count"`
+}
@@ -5,12 +5,16 @@ import "time"
 // Snippet represents a code snippet or excerpt
 type Snippet struct {
 	ID                   *int       `json:"id,omitempty" db:"id"`
+	OwnerID              int        `json:"owner_id" db:"user_id"`
 	Title                string     `json:"title" db:"title"`
 	Content              string     `json:"content" db:"content"`
 	SourceURL            *string    `json:"source_url,omitempty" db:"source_url"`
 	SourceConversationID *int       `json:"source_conversation_id,omitempty" db:"source_conversation_id"`
 	Tags                 []string   `json:"tags" db:"tags"`
 	Language             *string    `json:"language,omitempty" db:"language"`
+	CollectionID         *int       `json:"collection_id,omitempty" db:"collection_id"`
+	Version              int        `json:"version" db:"version"`
 	CreatedAt            time.Time  `json:"created_at" db:"created_at"`
+	DeletedAt            *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// TokenStatsFilters selects the conversations counted by the token statistics.
+// Since and Until bound their creation date.
+type TokenStatsFilters struct {
+	Source string
+	Since  *time.Time
+	Until  *time.Time
+}
+
+// TokenUsage sums the tokens of a group of conversations. InputTokens and
+// OutputTokens split the tokens of their messages between what was sent to the
+// model and its answers; Tokens counts their whole content. EstimatedCost is
+// set when the price table has a price for the conversations of the group.
+type TokenUsage struct {
+	Source        string   `json:"source,omitempty"`
+	Month         string   `json:"month,omitempty"`
+	Conversations int      `json:"conversations"`
+	Tokens        int64    `json:"tokens"`
+	InputTokens   int64    `json:"input_tokens"`
+	OutputTokens  int64    `json:"output_tokens"`
+	EstimatedCost *float64 `json:"estimated_cost,omitempty"`
+}
+
+// TokenStats is the response of the token statistics endpoint. Months are
+// "YYYY-MM" in UTC. Uncounted is the number of conversations saved before
+// token counts existed that are not counted yet. Tokenizers names the
+// tokenizer of each source, with the default one under "*".
+type TokenStats struct {
+	Total         TokenUsage        `json:"total"`
+	BySource      []TokenUsage      `json:"by_source"`
+	ByMonth       []TokenUsage      `json:"by_month"`
+	BySourceMonth []TokenUsage      `json:"by_source_month"`
+	Uncounted     int               `json:"uncounted"`
+	Tokenizers    map[string]string `json:"tokenizers"`
+	Currency      *string           `json:"currency,omitempty"`
+}
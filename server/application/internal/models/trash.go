@@ -0,0 +1,10 @@
+package models
+
+// Trash lists the deleted conversations, snippets and collections the user
+// may restore, most recently deleted first. A list is null when the request
+// lacks the read scope of its entity type.
+type Trash struct {
+	Conversations []Conversation `json:"conversations"`
+	Snippets      []Snippet      `json:"snippets"`
+	Collections   []Collection   `json:"collections"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// User represents an account that owns conversations, snippets, collections and settings
+type User struct {
+	ID           int       `json:"id" db:"id"`
+	Username     string    `json:"username" db:"username"`
+	PasswordHash *string   `json:"-" db:"password_hash"`
+	Roles        []string  `json:"roles" db:"roles"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// DefaultUsername is the user that owns data created before multi-user support
+// and the principal used by the static API key
+const DefaultUsername = "default"
+
+// Principal represents the authenticated caller of a request
+type Principal struct {
+	UserID   int      `json:"user_id"`
+	Username string   `json:"username"`
+	APIKeyID *int     `json:"api_key_id,omitempty"`
+	Scopes   []string `json:"scopes"`
+	Roles    []string `json:"roles"`
+}
+
+// HasRole reports whether the principal holds role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the principal was granted scope, either directly or through admin
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package models
+
+import "time"
+
+// Workspace roles, from least to most privileged
+const (
+	// RoleViewer can read the workspace's collections and the items filed in them
+	RoleViewer = "viewer"
+	// RoleEditor can also create and change collections and items in the workspace
+	RoleEditor = "editor"
+	// RoleAdmin can also delete collections, rename or delete the workspace,
+	// and manage members and invitations
+	RoleAdmin = "admin"
+)
+
+// roleRanks orders the workspace roles; unknown roles rank 0
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// IsValidRole reports whether role is a known workspace role
+func IsValidRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// RoleAllows reports whether role grants at least the permissions of required
+func RoleAllows(role, required string) bool {
+	return IsValidRole(role) && roleRanks[role] >= roleRanks[required]
+}
+
+// RolesAllowing returns the roles granting at least the permissions of required
+func RolesAllowing(required string) []string {
+	roles := []string{}
+	for _, role := range []string{RoleViewer, RoleEditor, RoleAdmin} {
+		if RoleAllows(role, required) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Workspace groups users sharing collections. Role is the role of the user
+// requesting it.
+type Workspace struct {
+	ID        *int      `json:"id,omitempty" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedBy *int      `json:"created_by,omitempty" db:"created_by"`
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// WorkspaceMember is a user's membership in a workspace
+type WorkspaceMember struct {
+	WorkspaceID int       `json:"workspace_id" db:"workspace_id"`
+	UserID      int       `json:"user_id" db:"user_id"`
+	Username    string    `json:"username"`
+	Role        string    `json:"role" db:"role"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// UpdateMemberRequest represents a request to change a member's role
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// WorkspaceInvitation lets whoever redeems its token join a workspace with Role.
+// An invitation can be redeemed once. Only the token hash is stored.
+type WorkspaceInvitation struct {
+	ID          *int       `json:"id,omitempty" db:"id"`
+	WorkspaceID int        `json:"workspace_id" db:"workspace_id"`
+	Role        string     `json:"role" db:"role"`
+	Prefix      string     `json:"prefix" db:"prefix"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	CreatedBy   *int       `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	AcceptedBy  *int       `json:"accepted_by,omitempty" db:"accepted_by"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty" db:"accepted_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// IsPending reports whether the invitation can still be redeemed at the given time
+func (i *WorkspaceInvitation) IsPending(now time.Time) bool {
+	if i.AcceptedAt != nil || i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && !now.Before(*i.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// CreateInvitationRequest represents a request to invite a user to a workspace
+type CreateInvitationRequest struct {
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateInvitationResponse is returned once on creation and is the only time the token is visible
+type CreateInvitationResponse struct {
+	WorkspaceInvitation
+	Token string `json:"token"`
+}
+
+// AcceptInvitationRequest represents a request to join a workspace
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
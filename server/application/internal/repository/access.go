@@ -0,0 +1,26 @@
+package repository
+
+import "fmt"
+
+// itemAccess is the condition restricting conversations or snippets to those
+// the user in parameter $userArg may access: the ones they own, and the ones
+// filed in a collection of a workspace where they have one of the roles in
+// parameter $rolesArg (see models.RolesAllowing). Collections in the trash
+// share nothing.
+func itemAccess(schema string, userArg, rolesArg int) string {
+	return fmt.Sprintf(`(user_id = $%[2]d OR collection_id IN (
+			SELECT c.id FROM "%[1]s".collections c
+			JOIN "%[1]s".workspace_members m ON m.workspace_id = c.workspace_id
+			WHERE m.user_id = $%[2]d AND m.role = ANY($%[3]d) AND c.deleted_at IS NULL
+		))`, schema, userArg, rolesArg)
+}
+
+// collectionAccess is the condition restricting collections to those the user
+// in parameter $userArg may access: their own private collections, and the
+// collections of workspaces where they have one of the roles in parameter $rolesArg.
+func collectionAccess(schema string, userArg, rolesArg int) string {
+	return fmt.Sprintf(`((workspace_id IS NULL AND user_id = $%[2]d) OR workspace_id IN (
+			SELECT m.workspace_id FROM "%[1]s".workspace_members m
+			WHERE m.user_id = $%[2]d AND m.role = ANY($%[3]d)
+		))`, schema, userArg, rolesArg)
+}
@@ -0,0 +1,317 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
+)
+
+// annotationColumns are the columns read by scan, in order
+const annotationColumns = `id, user_id, conversation_id, start_offset, end_offset, content, color, note, tags,
+		       orphaned, created_at, updated_at, content_ciphertext, data_key, master_key_id`
+
+// annotationAnchor is the text of an annotation's anchor, stored as JSON in
+// its content column so that it is encrypted like conversation content
+type annotationAnchor struct {
+	Quote  string `json:"quote"`
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+}
+
+// annotationQuote is the condition matching the quote of plaintext
+// annotations against the pattern in parameter $arg; encrypted quotes never match
+const annotationQuote = `(CASE WHEN data_key IS NULL AND content <> '' THEN content::jsonb->>'quote' END) ILIKE $%d`
+
+type AnnotationRepository struct {
+	pool    *pgxpool.Pool
+	schema  string
+	keyring *encryption.Keyring
+}
+
+// NewAnnotationRepository creates the repository. Anchors are encrypted at
+// rest when keyring is non-nil.
+func NewAnnotationRepository(pool *pgxpool.Pool, schema string, keyring *encryption.Keyring) *AnnotationRepository {
+	return &AnnotationRepository{
+		pool:    pool,
+		schema:  schema,
+		keyring: keyring,
+	}
+}
+
+// readableConversations is the condition restricting annotations to those on
+// conversations the user in parameter $1 may still read, with the roles in
+// parameter $2, except conversations in the trash
+func (r *AnnotationRepository) readableConversations() string {
+	return fmt.Sprintf(`conversation_id IN (SELECT id FROM "%s".conversations WHERE deleted_at IS NULL AND %s)`,
+		r.schema, itemAccess(r.schema, 1, 2))
+}
+
+// GetByID returns an annotation the user made on a conversation they can
+// read, or nil
+func (r *AnnotationRepository) GetByID(ctx context.Context, userID, id int) (*models.Annotation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".annotations
+		WHERE id = $3 AND user_id = $1 AND %s
+	`, annotationColumns, r.schema, r.readableConversations())
+
+	annotation, err := r.scan(conn(ctx, r.pool).QueryRow(ctx, query, userID, models.RolesAllowing(models.RoleViewer), id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get annotation: %w", err)
+	}
+	return annotation, nil
+}
+
+// List returns the annotations the user made on conversations they can read,
+// matching filters, newest first. A query matches the note, and the quote of
+// annotations stored in clear.
+func (r *AnnotationRepository) List(ctx context.Context, userID int, filters models.AnnotationFilters) ([]models.Annotation, error) {
+	conditions := []string{"user_id = $1", r.readableConversations()}
+	args := []interface{}{userID, models.RolesAllowing(models.RoleViewer)}
+	argPos := 3
+
+	if filters.Query != "" {
+		conditions = append(conditions, fmt.Sprintf("(note ILIKE $%d OR "+annotationQuote+")", argPos, argPos))
+		args = append(args, "%"+filters.Query+"%")
+		argPos++
+	}
+
+	if len(filters.Tags) > 0 {
+		conditions = append(conditions, fmt.Sprintf("tags && $%d", argPos))
+		args = append(args, filters.Tags)
+		argPos++
+	}
+
+	if filters.Color != "" {
+		conditions = append(conditions, fmt.Sprintf("color = $%d", argPos))
+		args = append(args, filters.Color)
+		argPos++
+	}
+
+	if filters.ConversationID != nil {
+		conditions = append(conditions, fmt.Sprintf("conversation_id = $%d", argPos))
+		args = append(args, *filters.ConversationID)
+		argPos++
+	}
+
+	if filters.Orphaned != nil {
+		conditions = append(conditions, fmt.Sprintf("orphaned = $%d", argPos))
+		args = append(args, *filters.Orphaned)
+		argPos++
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM "%s".annotations WHERE %s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`,
+		annotationColumns, r.schema, strings.Join(conditions, " AND "), argPos, argPos+1)
+	args = append(args, filters.Limit, filters.Offset)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list annotations: %w", err)
+	}
+	return r.collect(rows)
+}
+
+// ListByConversation returns the annotations the user made on a conversation,
+// in the order of the content
+func (r *AnnotationRepository) ListByConversation(ctx context.Context, userID, conversationID int) ([]models.Annotation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".annotations
+		WHERE user_id = $1 AND conversation_id = $2
+		ORDER BY start_offset, end_offset, id
+	`, annotationColumns, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list annotations: %w", err)
+	}
+	return r.collect(rows)
+}
+
+// ListMatching returns the annotations the user made on the given
+// conversations whose note or quote contains query or which have one of tags,
+// in the order of the content. It is meant to show why search results matched.
+func (r *AnnotationRepository) ListMatching(ctx context.Context, userID int, conversationIDs []int, query string, tags []string) ([]models.Annotation, error) {
+	conditions := []string{}
+	args := []interface{}{userID, conversationIDs}
+	if query != "" {
+		conditions = append(conditions, fmt.Sprintf("note ILIKE $3 OR "+annotationQuote, 3))
+		args = append(args, "%"+query+"%")
+	}
+	if len(tags) > 0 {
+		conditions = append(conditions, fmt.Sprintf("tags && $%d", len(args)+1))
+		args = append(args, tags)
+	}
+	if len(conditions) == 0 {
+		return []models.Annotation{}, nil
+	}
+
+	sql := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".annotations
+		WHERE user_id = $1 AND conversation_id = ANY($2) AND (%s)
+		ORDER BY conversation_id, start_offset, end_offset, id
+	`, annotationColumns, r.schema, strings.Join(conditions, " OR "))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list annotations: %w", err)
+	}
+	return r.collect(rows)
+}
+
+// ListAllByConversation returns the annotations every user made on a
+// conversation. It is meant for re-anchoring them after its content changes.
+func (r *AnnotationRepository) ListAllByConversation(ctx context.Context, conversationID int) ([]models.Annotation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".annotations
+		WHERE conversation_id = $1
+		ORDER BY id
+	`, annotationColumns, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list annotations: %w", err)
+	}
+	return r.collect(rows)
+}
+
+func (r *AnnotationRepository) Create(ctx context.Context, annotation *models.Annotation) error {
+	content, err := r.sealAnchor(annotation)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".annotations
+		(user_id, conversation_id, start_offset, end_offset, content, color, note, tags, orphaned,
+		 content_ciphertext, data_key, master_key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at, updated_at
+	`, r.schema)
+
+	err = conn(ctx, r.pool).QueryRow(ctx, query,
+		annotation.UserID, annotation.ConversationID, annotation.StartOffset, annotation.EndOffset,
+		content.Content, annotation.Color, annotation.Note, annotation.Tags, annotation.Orphaned,
+		content.Ciphertext, content.DataKey, content.KeyID,
+	).Scan(&annotation.ID, &annotation.CreatedAt, &annotation.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create annotation: %w", err)
+	}
+	return nil
+}
+
+// Update stores the color, note and tags of an annotation
+func (r *AnnotationRepository) Update(ctx context.Context, annotation *models.Annotation) error {
+	query := fmt.Sprintf(`
+		UPDATE "%s".annotations
+		SET color = $1, note = $2, tags = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING updated_at
+	`, r.schema)
+
+	err := conn(ctx, r.pool).QueryRow(ctx, query,
+		annotation.Color, annotation.Note, annotation.Tags, annotation.ID,
+	).Scan(&annotation.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update annotation: %w", err)
+	}
+	return nil
+}
+
+// SetAnchor stores the offsets, anchor text and orphaned flag of an annotation
+func (r *AnnotationRepository) SetAnchor(ctx context.Context, annotation *models.Annotation) error {
+	content, err := r.sealAnchor(annotation)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE "%s".annotations
+		SET start_offset = $1, end_offset = $2, content = $3, orphaned = $4,
+		    content_ciphertext = $5, data_key = $6, master_key_id = $7
+		WHERE id = $8
+	`, r.schema)
+
+	_, err = conn(ctx, r.pool).Exec(ctx, query,
+		annotation.StartOffset, annotation.EndOffset, content.Content, annotation.Orphaned,
+		content.Ciphertext, content.DataKey, content.KeyID, annotation.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to re-anchor annotation: %w", err)
+	}
+	return nil
+}
+
+func (r *AnnotationRepository) Delete(ctx context.Context, id int) error {
+	query := fmt.Sprintf(`DELETE FROM "%s".annotations WHERE id = $1`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete annotation: %w", err)
+	}
+	return nil
+}
+
+// sealAnchor returns the content column values of the anchor text of an annotation
+func (r *AnnotationRepository) sealAnchor(annotation *models.Annotation) (sealedContent, error) {
+	anchor, err := json.Marshal(annotationAnchor{
+		Quote:  annotation.Quote,
+		Prefix: annotation.Prefix,
+		Suffix: annotation.Suffix,
+	})
+	if err != nil {
+		return sealedContent{}, fmt.Errorf("failed to encode annotation anchor: %w", err)
+	}
+	return sealContent(r.keyring, string(anchor))
+}
+
+// collect reads and closes rows of annotationColumns
+func (r *AnnotationRepository) collect(rows pgx.Rows) ([]models.Annotation, error) {
+	defer rows.Close()
+
+	annotations := []models.Annotation{}
+	for rows.Next() {
+		annotation, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan annotation: %w", err)
+		}
+		annotations = append(annotations, *annotation)
+	}
+	return annotations, rows.Err()
+}
+
+// scan reads a row of annotationColumns
+func (r *AnnotationRepository) scan(row pgx.Row) (*models.Annotation, error) {
+	var annotation models.Annotation
+	var content sealedContent
+	err := row.Scan(
+		&annotation.ID, &annotation.UserID, &annotation.ConversationID,
+		&annotation.StartOffset, &annotation.EndOffset, &content.Content,
+		&annotation.Color, &annotation.Note, &annotation.Tags, &annotation.Orphaned,
+		&annotation.CreatedAt, &annotation.UpdatedAt,
+		&content.Ciphertext, &content.DataKey, &content.KeyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := content.open(r.keyring)
+	if err != nil {
+		return nil, err
+	}
+	var anchor annotationAnchor
+	if err := json.Unmarshal([]byte(plaintext), &anchor); err != nil {
+		return nil, fmt.Errorf("failed to decode annotation anchor: %w", err)
+	}
+	annotation.Quote, annotation.Prefix, annotation.Suffix = anchor.Quote, anchor.Prefix, anchor.Suffix
+	return &annotation, nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+type APIKeyRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewAPIKeyRepository(pool *pgxpool.Pool, schema string) *APIKeyRepository {
+	return &APIKeyRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+// GetByHash looks up a key by its hash regardless of owner, for authentication
+func (r *APIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := fmt.Sprintf(`
+		SELECT id, user_id, name, prefix, key_hash, scopes, created_at,
+		       last_used_at, expires_at, revoked_at
+		FROM "%s".api_keys
+		WHERE key_hash = $1
+	`, r.schema)
+
+	var key models.APIKey
+	err := r.pool.QueryRow(ctx, query, keyHash).Scan(
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scopes,
+		&key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key by hash: %w", err)
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) List(ctx context.Context, userID int) ([]models.APIKey, error) {
+	query := fmt.Sprintf(`
+		SELECT id, user_id, name, prefix, key_hash, scopes, created_at,
+		       last_used_at, expires_at, revoked_at
+		FROM "%s".api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, r.schema)
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(
+			&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scopes,
+			&key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, userID int, key *models.APIKey) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, r.schema)
+
+	err := r.pool.QueryRow(ctx, query,
+		userID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	key.UserID = userID
+	return nil
+}
+
+// Revoke marks a key as revoked. It returns false if the user owns no such active key.
+func (r *APIKeyRepository) Revoke(ctx context.Context, userID, id int) (bool, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, r.schema)
+
+	tag, err := r.pool.Exec(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id int) error {
+	query := fmt.Sprintf(`UPDATE "%s".api_keys SET last_used_at = NOW() WHERE id = $1`, r.schema)
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to update API key last use: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+// attachmentColumns are the columns read by scanAttachment, in order
+const attachmentColumns = `id, user_id, conversation_id, message_ordinal, filename, content_type,
+		       size, sha256, source_url, created_at`
+
+// attachmentUploadColumns are the columns read by scanAttachmentUpload, in order
+const attachmentUploadColumns = `id, user_id, conversation_id, message_ordinal, filename, content_type,
+		       size, received, source_url, created_at, expires_at`
+
+// AttachmentRepository stores attachment metadata and uploads in progress.
+// Access to attachments follows access to their conversation, which callers
+// check first.
+type AttachmentRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewAttachmentRepository(pool *pgxpool.Pool, schema string) *AttachmentRepository {
+	return &AttachmentRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+// GetByID returns an attachment, or nil
+func (r *AttachmentRepository) GetByID(ctx context.Context, id int) (*models.Attachment, error) {
+	query := fmt.Sprintf(`SELECT %s FROM "%s".attachments WHERE id = $1`, attachmentColumns, r.schema)
+
+	attachment, err := scanAttachment(conn(ctx, r.pool).QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return attachment, nil
+}
+
+// ListByConversation returns the attachments of a conversation in message order
+func (r *AttachmentRepository) ListByConversation(ctx context.Context, conversationID int) ([]models.Attachment, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".attachments
+		WHERE conversation_id = $1
+		ORDER BY message_ordinal NULLS LAST, id
+	`, attachmentColumns, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	return attachments, nil
+}
+
+// Create inserts an attachment, keeping its creation date if it has one, as
+// when restored from a backup
+func (r *AttachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	var createdAt interface{}
+	if !attachment.CreatedAt.IsZero() {
+		createdAt = attachment.CreatedAt
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".attachments
+		(user_id, conversation_id, message_ordinal, filename, content_type, size, sha256, source_url, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, NOW()))
+		RETURNING id, created_at
+	`, r.schema)
+
+	err := conn(ctx, r.pool).QueryRow(ctx, query,
+		attachment.UserID, attachment.ConversationID, attachment.MessageOrdinal, attachment.Filename,
+		attachment.ContentType, attachment.Size, attachment.SHA256, attachment.SourceURL, createdAt,
+	).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	return nil
+}
+
+// ListForBackup returns the attachments of the conversations the user owns,
+// except those in the trash, without their content
+func (r *AttachmentRepository) ListForBackup(ctx context.Context, userID int) ([]models.BackupAttachment, error) {
+	query := fmt.Sprintf(`
+		SELECT c.canonical_url, a.message_ordinal, a.filename, a.content_type, a.size, a.sha256,
+		       a.source_url, a.created_at
+		FROM "%s".attachments a
+		JOIN "%s".conversations c ON c.id = a.conversation_id
+		WHERE c.user_id = $1 AND c.deleted_at IS NULL
+		ORDER BY a.id
+	`, r.schema, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := []models.BackupAttachment{}
+	for rows.Next() {
+		var attachment models.BackupAttachment
+		err := rows.Scan(
+			&attachment.ConversationURL, &attachment.MessageOrdinal, &attachment.Filename,
+			&attachment.ContentType, &attachment.Size, &attachment.SHA256, &attachment.SourceURL,
+			&attachment.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+func (r *AttachmentRepository) Delete(ctx context.Context, id int) error {
+	query := fmt.Sprintf(`DELETE FROM "%s".attachments WHERE id = $1`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	return nil
+}
+
+// IsReferenced reports whether an attachment has the content with the given hash
+func (r *AttachmentRepository) IsReferenced(ctx context.Context, hash string) (bool, error) {
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM "%s".attachments WHERE sha256 = $1)`, r.schema)
+
+	var referenced bool
+	if err := conn(ctx, r.pool).QueryRow(ctx, query, hash).Scan(&referenced); err != nil {
+		return false, fmt.Errorf("failed to check blob references: %w", err)
+	}
+	return referenced, nil
+}
+
+// CreateUpload records the start of an upload in parts
+func (r *AttachmentRepository) CreateUpload(ctx context.Context, upload *models.AttachmentUpload) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".attachment_uploads
+		(user_id, conversation_id, message_ordinal, filename, content_type, size, source_url, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, received, created_at
+	`, r.schema)
+
+	err := conn(ctx, r.pool).QueryRow(ctx, query,
+		upload.UserID, upload.ConversationID, upload.MessageOrdinal, upload.Filename,
+		upload.ContentType, upload.Size, upload.SourceURL, upload.ExpiresAt,
+	).Scan(&upload.ID, &upload.Received, &upload.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment upload: %w", err)
+	}
+	return nil
+}
+
+// GetUpload returns an unexpired upload the user started, or nil. forUpdate
+// locks it until the end of the transaction, so that parts are not appended
+// concurrently.
+func (r *AttachmentRepository) GetUpload(ctx context.Context, userID, id int, forUpdate bool) (*models.AttachmentUpload, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".attachment_uploads
+		WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+	`, attachmentUploadColumns, r.schema)
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	upload, err := scanAttachmentUpload(conn(ctx, r.pool).QueryRow(ctx, query, id, userID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment upload: %w", err)
+	}
+	return upload, nil
+}
+
+// SetUploadReceived records how many bytes of an upload are stored
+func (r *AttachmentRepository) SetUploadReceived(ctx context.Context, id int, received int64) error {
+	query := fmt.Sprintf(`UPDATE "%s".attachment_uploads SET received = $1 WHERE id = $2`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, received, id); err != nil {
+		return fmt.Errorf("failed to update attachment upload: %w", err)
+	}
+	return nil
+}
+
+func (r *AttachmentRepository) DeleteUpload(ctx context.Context, id int) error {
+	query := fmt.Sprintf(`DELETE FROM "%s".attachment_uploads WHERE id = $1`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete attachment upload: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredUploads removes the uploads that expired before the given time
+// and returns their IDs
+func (r *AttachmentRepository) DeleteExpiredUploads(ctx context.Context, before time.Time) ([]int, error) {
+	query := fmt.Sprintf(`DELETE FROM "%s".attachment_uploads WHERE expires_at < $1 RETURNING id`, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired uploads: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete expired uploads: %w", err)
+	}
+	return ids, nil
+}
+
+// UploadIDs returns the IDs of all uploads in progress
+func (r *AttachmentRepository) UploadIDs(ctx context.Context) (map[int]bool, error) {
+	query := fmt.Sprintf(`SELECT id FROM "%s".attachment_uploads`, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	defer rows.Close()
+
+	ids := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// scanAttachment reads a row of attachmentColumns
+func scanAttachment(row pgx.Row) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := row.Scan(
+		&attachment.ID, &attachment.UserID, &attachment.ConversationID, &attachment.MessageOrdinal,
+		&attachment.Filename, &attachment.ContentType, &attachment.Size, &attachment.SHA256,
+		&attachment.SourceURL, &attachment.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// scanAttachmentUpload reads a row of attachmentUploadColumns
+func scanAttachmentUpload(row pgx.Row) (*models.AttachmentUpload, error) {
+	var upload models.AttachmentUpload
+	err := row.Scan(
+		&upload.ID, &upload.UserID, &upload.ConversationID, &upload.MessageOrdinal,
+		&upload.Filename, &upload.ContentType, &upload.Size, &upload.Received,
+		&upload.SourceURL, &upload.CreatedAt, &upload.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
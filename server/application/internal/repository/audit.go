@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+type AuditRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewAuditRepository(pool *pgxpool.Pool, schema string) *AuditRepository {
+	return &AuditRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+// Create records an event. Call it inside the transaction of the mutation it describes.
+func (r *AuditRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	changesJSON, err := json.Marshal(event.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit changes: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".audit_events
+		(user_id, actor_id, api_key_id, ip, action, entity_type, entity_id, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, r.schema)
+
+	err = conn(ctx, r.pool).QueryRow(ctx, query,
+		event.UserID, event.ActorID, event.APIKeyID, event.IP,
+		event.Action, event.EntityType, event.EntityID, changesJSON,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+	return nil
+}
+
+// List returns the events matching filters on the user's data or made by the
+// user, newest first
+func (r *AuditRepository) List(ctx context.Context, userID int, filters models.AuditFilters) ([]models.AuditEvent, error) {
+	conditions := []string{"(e.user_id = $1 OR e.actor_id = $1)"}
+	args := []interface{}{userID}
+	argPos := 2
+
+	baseQuery := fmt.Sprintf(`
+		SELECT e.id, e.user_id, e.actor_id, u.username, e.api_key_id, e.ip,
+		       e.action, e.entity_type, e.entity_id, e.changes, e.created_at
+		FROM "%s".audit_events e
+		LEFT JOIN "%s".users u ON u.id = e.actor_id
+	`, r.schema, r.schema)
+
+	if filters.EntityType != "" {
+		conditions = append(conditions, fmt.Sprintf("e.entity_type = $%d", argPos))
+		args = append(args, filters.EntityType)
+		argPos++
+	}
+
+	if filters.EntityID != nil {
+		conditions = append(conditions, fmt.Sprintf("e.entity_id = $%d", argPos))
+		args = append(args, *filters.EntityID)
+		argPos++
+	}
+
+	if filters.Action != "" {
+		conditions = append(conditions, fmt.Sprintf("e.action = $%d", argPos))
+		args = append(args, filters.Action)
+		argPos++
+	}
+
+	if filters.APIKeyID != nil {
+		conditions = append(conditions, fmt.Sprintf("e.api_key_id = $%d", argPos))
+		args = append(args, *filters.APIKeyID)
+		argPos++
+	}
+
+	if filters.Since != nil {
+		conditions = append(conditions, fmt.Sprintf("e.created_at >= $%d", argPos))
+		args = append(args, *filters.Since)
+		argPos++
+	}
+
+	if filters.Until != nil {
+		conditions = append(conditions, fmt.Sprintf("e.created_at < $%d", argPos))
+		args = append(args, *filters.Until)
+		argPos++
+	}
+
+	baseQuery += " WHERE " + strings.Join(conditions, " AND ")
+	baseQuery += fmt.Sprintf(" ORDER BY e.created_at DESC, e.id DESC LIMIT $%d OFFSET $%d", argPos, argPos+1)
+	args = append(args, filters.Limit, filters.Offset)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var changesJSON []byte
+		err := rows.Scan(
+			&event.ID, &event.UserID, &event.ActorID, &event.ActorUsername, &event.APIKeyID, &event.IP,
+			&event.Action, &event.EntityType, &event.EntityID, &changesJSON, &event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := json.Unmarshal(changesJSON, &event.Changes); err != nil {
+			return nil, fmt.Errorf("failed to parse audit changes: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
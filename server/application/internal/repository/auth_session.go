@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+type AuthSessionRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewAuthSessionRepository(pool *pgxpool.Pool, schema string) *AuthSessionRepository {
+	return &AuthSessionRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+func (r *AuthSessionRepository) GetByID(ctx context.Context, id int) (*models.AuthSession, error) {
+	query := fmt.Sprintf(`
+		SELECT id, user_id, scopes, cookie_hash, csrf_hash, created_at, expires_at, revoked_at
+		FROM "%s".auth_sessions
+		WHERE id = $1
+	`, r.schema)
+
+	var session models.AuthSession
+	err := r.pool.QueryRow(ctx, query, id).Scan(
+		&session.ID, &session.UserID, &session.Scopes, &session.CookieHash, &session.CSRFHash,
+		&session.CreatedAt, &session.ExpiresAt, &session.RevokedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth session by ID: %w", err)
+	}
+	return &session, nil
+}
+
+func (r *AuthSessionRepository) GetByCookieHash(ctx context.Context, cookieHash string) (*models.AuthSession, error) {
+	query := fmt.Sprintf(`
+		SELECT id, user_id, scopes, cookie_hash, csrf_hash, created_at, expires_at, revoked_at
+		FROM "%s".auth_sessions
+		WHERE cookie_hash = $1
+	`, r.schema)
+
+	var session models.AuthSession
+	err := r.pool.QueryRow(ctx, query, cookieHash).Scan(
+		&session.ID, &session.UserID, &session.Scopes, &session.CookieHash, &session.CSRFHash,
+		&session.CreatedAt, &session.ExpiresAt, &session.RevokedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth session by cookie: %w", err)
+	}
+	return &session, nil
+}
+
+func (r *AuthSessionRepository) Create(ctx context.Context, session *models.AuthSession) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".auth_sessions (user_id, scopes, cookie_hash, csrf_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, r.schema)
+
+	err := r.pool.QueryRow(ctx, query,
+		session.UserID, session.Scopes, session.CookieHash, session.CSRFHash, session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create auth session: %w", err)
+	}
+	return nil
+}
+
+func (r *AuthSessionRepository) Revoke(ctx context.Context, id int) error {
+	query := fmt.Sprintf(`
+		UPDATE "%s".auth_sessions SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+	`, r.schema)
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke auth session: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every active session of a user, e.g. after a password change
+func (r *AuthSessionRepository) RevokeAllForUser(ctx context.Context, userID int) error {
+	query := fmt.Sprintf(`
+		UPDATE "%s".auth_sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, r.schema)
+	_, err := r.pool.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke auth sessions: %w", err)
+	}
+	return nil
+}
+
+func (r *AuthSessionRepository) CreateRefreshToken(ctx context.Context, sessionID int, tokenHash string, expiresAt time.Time) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".refresh_tokens (session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, r.schema)
+	_, err := r.pool.Exec(ctx, query, sessionID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *AuthSessionRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := fmt.Sprintf(`
+		SELECT id, session_id, token_hash, created_at, expires_at, used_at
+		FROM "%s".refresh_tokens
+		WHERE token_hash = $1
+	`, r.schema)
+
+	var token models.RefreshToken
+	err := r.pool.QueryRow(ctx, query, tokenHash).Scan(
+		&token.ID, &token.SessionID, &token.TokenHash,
+		&token.CreatedAt, &token.ExpiresAt, &token.UsedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed consumes a refresh token. It returns false if the token
+// was already used, so concurrent refreshes cannot both succeed.
+func (r *AuthSessionRepository) MarkRefreshTokenUsed(ctx context.Context, id int) (bool, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".refresh_tokens SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL
+	`, r.schema)
+	tag, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
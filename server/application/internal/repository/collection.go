@@ -3,12 +3,16 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
 )
 
+// collectionColumns are the columns read by scanCollection, in order
+const collectionColumns = `id, user_id, workspace_id, name, icon, color, version, created_at, deleted_at`
+
 type CollectionRepository struct {
 	pool   *pgxpool.Pool
 	schema string
@@ -21,54 +25,55 @@ func NewCollectionRepository(pool *pgxpool.Pool, schema string) *CollectionRepos
 	}
 }
 
-func (r *CollectionRepository) GetByID(ctx context.Context, id int) (*models.Collection, error) {
+// GetByID returns one of the user's private collections or a collection of
+// a workspace they are a member of, unless it is in the trash
+func (r *CollectionRepository) GetByID(ctx context.Context, userID, id int) (*models.Collection, error) {
 	query := fmt.Sprintf(`
-		SELECT id, name, icon, color, created_at
+		SELECT %s
 		FROM "%s".collections
-		WHERE id = $1
-	`, r.schema)
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+	`, collectionColumns, r.schema, collectionAccess(r.schema, 2, 3))
 
-	var collection models.Collection
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&collection.ID, &collection.Name, &collection.Icon, &collection.Color, &collection.CreatedAt,
-	)
+	collection, err := scanCollection(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleViewer)))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get collection by ID: %w", err)
 	}
-	return &collection, nil
+	return collection, nil
 }
 
-func (r *CollectionRepository) GetByName(ctx context.Context, name string) (*models.Collection, error) {
+// GetByName returns a collection the user created, unless it is in the trash.
+// Names are unique per creator among collections out of the trash.
+func (r *CollectionRepository) GetByName(ctx context.Context, userID int, name string) (*models.Collection, error) {
 	query := fmt.Sprintf(`
-		SELECT id, name, icon, color, created_at
+		SELECT %s
 		FROM "%s".collections
-		WHERE name = $1
-	`, r.schema)
+		WHERE name = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, collectionColumns, r.schema)
 
-	var collection models.Collection
-	err := r.pool.QueryRow(ctx, query, name).Scan(
-		&collection.ID, &collection.Name, &collection.Icon, &collection.Color, &collection.CreatedAt,
-	)
+	collection, err := scanCollection(conn(ctx, r.pool).QueryRow(ctx, query, name, userID))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get collection by name: %w", err)
 	}
-	return &collection, nil
+	return collection, nil
 }
 
-func (r *CollectionRepository) List(ctx context.Context) ([]models.Collection, error) {
+// List returns the user's private collections and the collections of the
+// workspaces they are a member of, except those in the trash
+func (r *CollectionRepository) List(ctx context.Context, userID int) ([]models.Collection, error) {
 	query := fmt.Sprintf(`
-		SELECT id, name, icon, color, created_at
+		SELECT %s
 		FROM "%s".collections
+		WHERE deleted_at IS NULL AND %s
 		ORDER BY created_at DESC
-	`, r.schema)
+	`, collectionColumns, r.schema, collectionAccess(r.schema, 1, 2))
 
-	rows, err := r.pool.Query(ctx, query)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleViewer))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list collections: %w", err)
 	}
@@ -76,20 +81,17 @@ func (r *CollectionRepository) List(ctx context.Context) ([]models.Collection, e
 
 	var collections []models.Collection
 	for rows.Next() {
-		var collection models.Collection
-		err := rows.Scan(
-			&collection.ID, &collection.Name, &collection.Icon, &collection.Color, &collection.CreatedAt,
-		)
+		collection, err := scanCollection(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan collection: %w", err)
 		}
-		collections = append(collections, collection)
+		collections = append(collections, *collection)
 	}
 
 	return collections, nil
 }
 
-func (r *CollectionRepository) Create(ctx context.Context, collection *models.Collection) error {
+func (r *CollectionRepository) Create(ctx context.Context, userID int, collection *models.Collection) error {
 	// Use provided date if not zero, otherwise use NULL to trigger DEFAULT (NOW())
 	var createdAt interface{}
 	if collection.CreatedAt.IsZero() {
@@ -99,42 +101,162 @@ func (r *CollectionRepository) Create(ctx context.Context, collection *models.Co
 	}
 
 	query := fmt.Sprintf(`
-		INSERT INTO "%s".collections (name, icon, color, created_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at
+		INSERT INTO "%s".collections (user_id, workspace_id, name, icon, color, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, version, created_at
 	`, r.schema)
 
-	err := r.pool.QueryRow(ctx, query,
-		collection.Name, collection.Icon, collection.Color, createdAt,
-	).Scan(&collection.ID, &collection.CreatedAt)
+	err := conn(ctx, r.pool).QueryRow(ctx, query,
+		userID, collection.WorkspaceID, collection.Name, collection.Icon, collection.Color, createdAt,
+	).Scan(&collection.ID, &collection.Version, &collection.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create collection: %w", err)
 	}
+	collection.OwnerID = userID
 	return nil
 }
 
-func (r *CollectionRepository) Update(ctx context.Context, collection *models.Collection) error {
+// Update changes a private collection of the user, or a collection of a
+// workspace where they are an editor. The workspace of a collection does not change.
+// collection.Version must follow the stored version, otherwise it returns ErrStaleVersion.
+func (r *CollectionRepository) Update(ctx context.Context, userID int, collection *models.Collection) error {
 	query := fmt.Sprintf(`
 		UPDATE "%s".collections
-		SET name = $1, icon = $2, color = $3
-		WHERE id = $4
-	`, r.schema)
+		SET name = $1, icon = $2, color = $3, version = $7
+		WHERE id = $4 AND version = $8 AND deleted_at IS NULL AND %s
+	`, r.schema, collectionAccess(r.schema, 5, 6))
 
-	_, err := r.pool.Exec(ctx, query,
-		collection.Name, collection.Icon, collection.Color, collection.ID,
+	tag, err := conn(ctx, r.pool).Exec(ctx, query,
+		collection.Name, collection.Icon, collection.Color, collection.ID, userID,
+		models.RolesAllowing(models.RoleEditor), collection.Version, collection.Version-1,
 	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrStaleVersion
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update collection: %w", err)
 	}
 	return nil
 }
 
-func (r *CollectionRepository) Delete(ctx context.Context, id int) error {
-	query := fmt.Sprintf(`DELETE FROM "%s".collections WHERE id = $1`, r.schema)
-	_, err := r.pool.Exec(ctx, query, id)
+// Trash moves a private collection of the user, or a collection of a
+// workspace where they are an admin, to the trash. Conversations and snippets
+// stay filed in it.
+func (r *CollectionRepository) Trash(ctx context.Context, userID, id int) error {
+	query := fmt.Sprintf(`
+		UPDATE "%s".collections SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+	`, r.schema, collectionAccess(r.schema, 2, 3))
+	_, err := conn(ctx, r.pool).Exec(ctx, query, id, userID, models.RolesAllowing(models.RoleAdmin))
 	if err != nil {
-		return fmt.Errorf("failed to delete collection: %w", err)
+		return fmt.Errorf("failed to trash collection: %w", err)
 	}
 	return nil
 }
 
+// GetTrashed returns a collection in the trash that is one of the user's
+// private collections or belongs to a workspace they are a member of
+func (r *CollectionRepository) GetTrashed(ctx context.Context, userID, id int) (*models.Collection, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".collections
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s
+	`, collectionColumns, r.schema, collectionAccess(r.schema, 2, 3))
+
+	collection, err := scanCollection(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleViewer)))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed collection: %w", err)
+	}
+	return collection, nil
+}
+
+// ListTrashed returns the collections in the trash that are private
+// collections of the user or belong to a workspace where they are an admin,
+// most recently deleted first
+func (r *CollectionRepository) ListTrashed(ctx context.Context, userID int) ([]models.Collection, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".collections
+		WHERE deleted_at IS NOT NULL AND %s
+		ORDER BY deleted_at DESC
+	`, collectionColumns, r.schema, collectionAccess(r.schema, 1, 2))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleAdmin))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trashed collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := []models.Collection{}
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		collections = append(collections, *collection)
+	}
+
+	return collections, nil
+}
+
+// Restore takes a private collection of the user, or a collection of a
+// workspace where they are an admin, out of the trash and returns it. It
+// returns nil if there is no such collection in the trash, and ErrDuplicate
+// if its creator has made another collection with the same name since.
+func (r *CollectionRepository) Restore(ctx context.Context, userID, id int) (*models.Collection, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".collections SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s
+		RETURNING %s
+	`, r.schema, collectionAccess(r.schema, 2, 3), collectionColumns)
+
+	collection, err := scanCollection(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleAdmin)))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicate
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore collection: %w", err)
+	}
+	return collection, nil
+}
+
+// Purge deletes the collections moved to the trash before the given time and
+// returns how many there were. Conversations and snippets filed in them are
+// kept, outside of any collection.
+func (r *CollectionRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	// Snippets are unfiled by their foreign key, conversations have none
+	unfile := fmt.Sprintf(`
+		UPDATE "%[1]s".conversations SET collection_id = NULL
+		WHERE collection_id IN (SELECT id FROM "%[1]s".collections WHERE deleted_at < $1)
+	`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, unfile, before); err != nil {
+		return 0, fmt.Errorf("failed to unfile conversations: %w", err)
+	}
+
+	query := fmt.Sprintf(`DELETE FROM "%s".collections WHERE deleted_at < $1`, r.schema)
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge collections: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// scanCollection reads a row of collectionColumns
+func scanCollection(row pgx.Row) (*models.Collection, error) {
+	var collection models.Collection
+	err := row.Scan(
+		&collection.ID, &collection.OwnerID, &collection.WorkspaceID,
+		&collection.Name, &collection.Icon, &collection.Color, &collection.Version, &collection.CreatedAt,
+		&collection.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
@@ -4,73 +4,89 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/enrichment"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/fingerprint"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/tokenizer"
 )
 
+// conversationColumns are the columns read by scan, in order
+const conversationColumns = `id, user_id, canonical_url, share_url, source, title, description, content,
+		       tags, collection_id, ignore, version, created_at, updated_at, deleted_at,
+		       content_ciphertext, data_key, master_key_id,
+		       word_count, turn_count, language, code_block_count, code_languages, model,
+		       first_message_at, last_message_at, token_count, tokenizer`
+
 type ConversationRepository struct {
-	pool   *pgxpool.Pool
-	schema string
+	pool       *pgxpool.Pool
+	schema     string
+	keyring    *encryption.Keyring
+	tokenizers *tokenizer.Registry
 }
 
-func NewConversationRepository(pool *pgxpool.Pool, schema string) *ConversationRepository {
+// NewConversationRepository creates the repository. Content is encrypted at rest
+// when keyring is non-nil, and its tokens are counted with the tokenizer
+// tokenizers has for the conversation's source.
+func NewConversationRepository(pool *pgxpool.Pool, schema string, keyring *encryption.Keyring, tokenizers *tokenizer.Registry) *ConversationRepository {
 	return &ConversationRepository{
-		pool:   pool,
-		schema: schema,
+		pool:       pool,
+		schema:     schema,
+		keyring:    keyring,
+		tokenizers: tokenizers,
 	}
 }
 
-func (r *ConversationRepository) GetByID(ctx context.Context, id int) (*models.Conversation, error) {
+// GetByID returns a conversation the user owns or can read through a workspace,
+// unless it is in the trash
+func (r *ConversationRepository) GetByID(ctx context.Context, userID, id int) (*models.Conversation, error) {
 	query := fmt.Sprintf(`
-		SELECT id, canonical_url, share_url, source, title, description, content,
-		       tags, collection_id, ignore, version, created_at, updated_at
+		SELECT %s
 		FROM "%s".conversations
-		WHERE id = $1
-	`, r.schema)
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+	`, conversationColumns, r.schema, itemAccess(r.schema, 2, 3))
 
-	var conv models.Conversation
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&conv.ID, &conv.CanonicalURL, &conv.ShareURL, &conv.Source,
-		&conv.Title, &conv.Description, &conv.Content,
-		&conv.Tags, &conv.CollectionID, &conv.Ignore,
-		&conv.Version, &conv.CreatedAt, &conv.UpdatedAt,
-	)
+	conv, err := r.scan(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleViewer)))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get conversation by ID: %w", err)
 	}
-	return &conv, nil
+	return conv, nil
 }
 
-func (r *ConversationRepository) GetByCanonicalURL(ctx context.Context, url string) (*models.Conversation, error) {
+// GetByCanonicalURL returns the user's own conversation saved from url, or
+// having url or one of aliases as an alias, unless it is in the trash.
+// Canonical URLs are unique per user among conversations out of the trash,
+// so conversations shared by others are not considered.
+func (r *ConversationRepository) GetByCanonicalURL(ctx context.Context, userID int, url string, aliases ...string) (*models.Conversation, error) {
 	query := fmt.Sprintf(`
-		SELECT id, canonical_url, share_url, source, title, description, content,
-		       tags, collection_id, ignore, version, created_at, updated_at
-		FROM "%s".conversations
-		WHERE canonical_url = $1
-	`, r.schema)
+		SELECT %[1]s
+		FROM "%[2]s".conversations
+		WHERE user_id = $2 AND deleted_at IS NULL AND (canonical_url = $1 OR id IN (
+			SELECT conversation_id FROM "%[2]s".conversation_url_aliases
+			WHERE user_id = $2 AND url = ANY($3)
+		))
+		ORDER BY canonical_url = $1 DESC, updated_at DESC
+		LIMIT 1
+	`, conversationColumns, r.schema)
 
-	var conv models.Conversation
-	err := r.pool.QueryRow(ctx, query, url).Scan(
-		&conv.ID, &conv.CanonicalURL, &conv.ShareURL, &conv.Source,
-		&conv.Title, &conv.Description, &conv.Content,
-		&conv.Tags, &conv.CollectionID, &conv.Ignore,
-		&conv.Version, &conv.CreatedAt, &conv.UpdatedAt,
-	)
+	conv, err := r.scan(conn(ctx, r.pool).QueryRow(ctx, query, url, userID, append([]string{url}, aliases...)))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get conversation by URL: %w", err)
 	}
-	return &conv, nil
+	return conv, nil
 }
 
-func (r *ConversationRepository) Create(ctx context.Context, conv *models.Conversation) error {
+func (r *ConversationRepository) Create(ctx context.Context, userID int, conv *models.Conversation) error {
 	// Use provided dates if not zero, otherwise use NULL to trigger DEFAULT (NOW())
 	var createdAt, updatedAt interface{}
 	if conv.CreatedAt.IsZero() {
@@ -84,71 +100,489 @@ func (r *ConversationRepository) Create(ctx context.Context, conv *models.Conver
 		updatedAt = conv.UpdatedAt
 	}
 
+	content, err := sealContent(r.keyring, conv.Content)
+	if err != nil {
+		return err
+	}
+	conv.Metadata = contentMetadata(conv.Content)
+	metadata := conv.Metadata
+	r.countTokens(conv)
+
 	query := fmt.Sprintf(`
 		INSERT INTO "%s".conversations
-		(canonical_url, share_url, source, title, description, content, tags,
-		 collection_id, ignore, version, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		(user_id, canonical_url, share_url, source, title, description, content, tags,
+		 collection_id, ignore, version, created_at, updated_at,
+		 content_ciphertext, data_key, master_key_id, content_terms, content_fingerprint,
+		 word_count, turn_count, language, code_block_count, code_languages, model,
+		 first_message_at, last_message_at, token_count, tokenizer)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+		        $19, $20, $21, $22, $23, $24, $25, $26, $27, $28)
 		RETURNING id, created_at, updated_at
 	`, r.schema)
 
-	err := r.pool.QueryRow(ctx, query,
-		conv.CanonicalURL, conv.ShareURL, conv.Source, conv.Title,
-		conv.Description, conv.Content, conv.Tags, conv.CollectionID,
+	err = conn(ctx, r.pool).QueryRow(ctx, query,
+		userID, conv.CanonicalURL, conv.ShareURL, conv.Source, conv.Title,
+		conv.Description, content.Content, conv.Tags, conv.CollectionID,
 		conv.Ignore, conv.Version, createdAt, updatedAt,
+		content.Ciphertext, content.DataKey, content.KeyID, contentTerms(r.keyring, conv.Content),
+		contentFingerprint(conv.Content),
+		metadata.WordCount, metadata.TurnCount, metadata.Language, metadata.CodeBlockCount,
+		metadata.CodeLanguages, metadata.Model, metadata.FirstMessageAt, metadata.LastMessageAt,
+		conv.TokenCount, conv.Tokenizer,
 	).Scan(&conv.ID, &conv.CreatedAt, &conv.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create conversation: %w", err)
 	}
+	conv.OwnerID = userID
 	return nil
 }
 
-func (r *ConversationRepository) Update(ctx context.Context, conv *models.Conversation) error {
+// Update changes a conversation the user owns or can edit through a workspace.
+// conv.Version must follow the stored version, otherwise it returns ErrStaleVersion.
+func (r *ConversationRepository) Update(ctx context.Context, userID int, conv *models.Conversation) error {
+	content, err := sealContent(r.keyring, conv.Content)
+	if err != nil {
+		return err
+	}
+	conv.Metadata = contentMetadata(conv.Content)
+	metadata := conv.Metadata
+	r.countTokens(conv)
+
 	query := fmt.Sprintf(`
 		UPDATE "%s".conversations
 		SET title = $1, description = $2, content = $3, tags = $4,
-		    collection_id = $5, ignore = $6, version = $7, updated_at = NOW()
-		WHERE id = $8
-		RETURNING updated_at
-	`, r.schema)
+		    collection_id = $5, ignore = $6, version = $7, updated_at = NOW(),
+		    content_ciphertext = $10, data_key = $11, master_key_id = $12, content_terms = $13,
+		    content_fingerprint = $16,
+		    word_count = $17, turn_count = $18, language = $19, code_block_count = $20,
+		    code_languages = $21, model = $22, first_message_at = $23, last_message_at = $24,
+		    token_count = $25, tokenizer = $26
+		WHERE id = $8 AND version = $15 AND deleted_at IS NULL AND %s
+		RETURNING user_id, updated_at
+	`, r.schema, itemAccess(r.schema, 9, 14))
 
-	err := r.pool.QueryRow(ctx, query,
-		conv.Title, conv.Description, conv.Content, conv.Tags,
-		conv.CollectionID, conv.Ignore, conv.Version, conv.ID,
-	).Scan(&conv.UpdatedAt)
+	err = conn(ctx, r.pool).QueryRow(ctx, query,
+		conv.Title, conv.Description, content.Content, conv.Tags,
+		conv.CollectionID, conv.Ignore, conv.Version, conv.ID, userID,
+		content.Ciphertext, content.DataKey, content.KeyID, contentTerms(r.keyring, conv.Content),
+		models.RolesAllowing(models.RoleEditor), conv.Version-1, contentFingerprint(conv.Content),
+		metadata.WordCount, metadata.TurnCount, metadata.Language, metadata.CodeBlockCount,
+		metadata.CodeLanguages, metadata.Model, metadata.FirstMessageAt, metadata.LastMessageAt,
+		conv.TokenCount, conv.Tokenizer,
+	).Scan(&conv.OwnerID, &conv.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrStaleVersion
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update conversation: %w", err)
 	}
 	return nil
 }
 
-func (r *ConversationRepository) Delete(ctx context.Context, id int) error {
-	query := fmt.Sprintf(`DELETE FROM "%s".conversations WHERE id = $1`, r.schema)
-	_, err := r.pool.Exec(ctx, query, id)
+// Trash moves a conversation the user owns or can edit through a workspace to the trash
+func (r *ConversationRepository) Trash(ctx context.Context, userID, id int) error {
+	query := fmt.Sprintf(`
+		UPDATE "%s".conversations SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+	`, r.schema, itemAccess(r.schema, 2, 3))
+	_, err := conn(ctx, r.pool).Exec(ctx, query, id, userID, models.RolesAllowing(models.RoleEditor))
 	if err != nil {
-		return fmt.Errorf("failed to delete conversation: %w", err)
+		return fmt.Errorf("failed to trash conversation: %w", err)
 	}
 	return nil
 }
 
-func (r *ConversationRepository) Search(ctx context.Context, filters models.SearchFilters) ([]models.Conversation, error) {
-	var conditions []string
-	var args []interface{}
-	argPos := 1
+// GetTrashed returns a conversation in the trash that the user owns or can
+// read through a workspace
+func (r *ConversationRepository) GetTrashed(ctx context.Context, userID, id int) (*models.Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversations
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s
+	`, conversationColumns, r.schema, itemAccess(r.schema, 2, 3))
 
-	baseQuery := fmt.Sprintf(`
-		SELECT id, canonical_url, share_url, source, title, description, content,
-		       tags, collection_id, ignore, version, created_at, updated_at
+	conv, err := r.scan(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleViewer)))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed conversation: %w", err)
+	}
+	return conv, nil
+}
+
+// ListTrashed returns the conversations in the trash that the user owns or
+// can edit through a workspace, most recently deleted first
+func (r *ConversationRepository) ListTrashed(ctx context.Context, userID int) ([]models.Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM "%s".conversations
+		WHERE deleted_at IS NOT NULL AND %s
+		ORDER BY deleted_at DESC
+	`, conversationColumns, r.schema, itemAccess(r.schema, 1, 2))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleEditor))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trashed conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		conv, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, *conv)
+	}
+
+	return conversations, nil
+}
+
+// Restore takes a conversation the user owns or can edit through a workspace
+// out of the trash and returns it. It returns nil if there is no such
+// conversation in the trash, and ErrDuplicate if another conversation of its
+// owner has been saved from the same canonical URL since.
+func (r *ConversationRepository) Restore(ctx context.Context, userID, id int) (*models.Conversation, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".conversations SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s
+		RETURNING %s
+	`, r.schema, itemAccess(r.schema, 2, 3), conversationColumns)
+
+	conv, err := r.scan(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleEditor)))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicate
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore conversation: %w", err)
+	}
+	return conv, nil
+}
+
+// Purge deletes the conversations moved to the trash before the given time,
+// with their messages and versions, and returns how many there were
+func (r *ConversationRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM "%s".conversations WHERE deleted_at < $1`, r.schema)
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge conversations: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Duplicates returns the conversations out of the trash, other than conv, that
+// the user owns or can read through a workspace and that are saved from one of
+// the URLs of conv, or whose content fingerprint is at most maxDistance bits
+// away from fingerprint. A nil fingerprint only matches URLs.
+func (r *ConversationRepository) Duplicates(ctx context.Context, userID int, conv *models.Conversation, fingerprint *int64, maxDistance int) ([]models.Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversations
+		WHERE id <> $1 AND deleted_at IS NULL AND %s AND (
+			canonical_url IN ($4, $5) OR share_url IN ($4, $5)
+			OR bit_count((content_fingerprint # $6)::bit(64)) <= $7
+		)
+		ORDER BY updated_at DESC
+		LIMIT 100
+	`, conversationColumns, r.schema, itemAccess(r.schema, 2, 3))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query,
+		*conv.ID, userID, models.RolesAllowing(models.RoleViewer),
+		conv.CanonicalURL, conv.ShareURL, fingerprint, maxDistance,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicate conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		duplicate, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, *duplicate)
+	}
+
+	return conversations, nil
+}
+
+// ListUnfingerprinted returns up to limit conversations out of the trash that
+// the user owns or can read through a workspace and whose content fingerprint
+// was never computed, because they were saved before fingerprints existed
+func (r *ConversationRepository) ListUnfingerprinted(ctx context.Context, userID, limit int) ([]models.Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversations
+		WHERE content_fingerprint IS NULL AND deleted_at IS NULL AND %s
+		LIMIT $3
+	`, conversationColumns, r.schema, itemAccess(r.schema, 1, 2))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleViewer), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations without fingerprint: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		conv, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, *conv)
+	}
+
+	return conversations, nil
+}
+
+// SetFingerprint stores the content fingerprint of a conversation without
+// changing its version, as it is derived from the stored content
+func (r *ConversationRepository) SetFingerprint(ctx context.Context, id int, content string) error {
+	query := fmt.Sprintf(`UPDATE "%s".conversations SET content_fingerprint = $1 WHERE id = $2`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, contentFingerprint(content), id); err != nil {
+		return fmt.Errorf("failed to set conversation fingerprint: %w", err)
+	}
+	return nil
+}
+
+// ListUnenriched returns up to limit conversations out of the trash that the
+// user owns or can read through a workspace and whose metadata was never
+// derived, because they were saved before it existed and not saved since
+func (r *ConversationRepository) ListUnenriched(ctx context.Context, userID, limit int) ([]models.Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversations
+		WHERE word_count IS NULL AND deleted_at IS NULL AND %s
+		LIMIT $3
+	`, conversationColumns, r.schema, itemAccess(r.schema, 1, 2))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleViewer), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations without metadata: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		conv, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, *conv)
+	}
+
+	return conversations, nil
+}
+
+// SetMetadata stores the metadata derived from the content of a conversation
+// without changing its version, as it is derived from the stored content
+func (r *ConversationRepository) SetMetadata(ctx context.Context, id int, content string) error {
+	metadata := contentMetadata(content)
+	query := fmt.Sprintf(`
+		UPDATE "%s".conversations
+		SET word_count = $1, turn_count = $2, language = $3, code_block_count = $4,
+		    code_languages = $5, model = $6, first_message_at = $7, last_message_at = $8
+		WHERE id = $9
 	`, r.schema)
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
+		metadata.WordCount, metadata.TurnCount, metadata.Language, metadata.CodeBlockCount,
+		metadata.CodeLanguages, metadata.Model, metadata.FirstMessageAt, metadata.LastMessageAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set conversation metadata: %w", err)
+	}
+	return nil
+}
+
+// ListUncounted returns up to limit conversations out of the trash that the
+// user owns or can read through a workspace and whose tokens were never
+// counted, because they were saved before token counts existed and not saved since
+func (r *ConversationRepository) ListUncounted(ctx context.Context, userID, limit int) ([]models.Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversations
+		WHERE token_count IS NULL AND deleted_at IS NULL AND %s
+		LIMIT $3
+	`, conversationColumns, r.schema, itemAccess(r.schema, 1, 2))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleViewer), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations without token count: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		conv, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, *conv)
+	}
+
+	return conversations, nil
+}
+
+// ListUnsegmented returns up to limit conversations out of the trash that the
+// user owns or can read through a workspace and whose messages were never
+// split into segments, because they were saved before segments existed and
+// not saved since
+func (r *ConversationRepository) ListUnsegmented(ctx context.Context, userID, limit int) ([]models.Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %[1]s
+		FROM "%[2]s".conversations
+		WHERE (content <> '' OR content_ciphertext IS NOT NULL) AND deleted_at IS NULL AND %[3]s
+		  AND NOT EXISTS (SELECT 1 FROM "%[2]s".message_segments s WHERE s.conversation_id = conversations.id)
+		LIMIT $3
+	`, conversationColumns, r.schema, itemAccess(r.schema, 1, 2))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleViewer), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations without message segments: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		conv, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, *conv)
+	}
+
+	return conversations, nil
+}
+
+// SetTokenCount counts and stores the tokens of a conversation without
+// changing its version, as they are derived from the stored content
+func (r *ConversationRepository) SetTokenCount(ctx context.Context, conv *models.Conversation) error {
+	r.countTokens(conv)
+	query := fmt.Sprintf(`UPDATE "%s".conversations SET token_count = $1, tokenizer = $2 WHERE id = $3`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, conv.TokenCount, conv.Tokenizer, conv.ID); err != nil {
+		return fmt.Errorf("failed to set conversation token count: %w", err)
+	}
+	return nil
+}
+
+// AddAlias makes url an alias of a conversation of the user, replacing any
+// conversation it was an alias of
+func (r *ConversationRepository) AddAlias(ctx context.Context, userID int, url string, conversationID int) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".conversation_url_aliases (user_id, url, conversation_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, url) DO UPDATE SET conversation_id = EXCLUDED.conversation_id
+	`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, userID, url, conversationID); err != nil {
+		return fmt.Errorf("failed to add conversation URL alias: %w", err)
+	}
+	return nil
+}
+
+// SetURLs changes the canonical URL, share URL and source of a conversation,
+// in the trash or not, without changing its version: they name the same
+// conversation in another form
+func (r *ConversationRepository) SetURLs(ctx context.Context, conv *models.Conversation) error {
+	query := fmt.Sprintf(`
+		UPDATE "%s".conversations SET canonical_url = $1, share_url = $2, source = $3
+		WHERE id = $4
+	`, r.schema)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, conv.CanonicalURL, conv.ShareURL, conv.Source, conv.ID)
+	if err != nil {
+		return fmt.Errorf("failed to set conversation URLs: %w", err)
+	}
+	return nil
+}
+
+// ListAfter returns up to limit conversations of all users, in the trash or
+// not, with an ID greater than afterID, in ID order. It is meant for
+// maintenance jobs walking the whole table.
+func (r *ConversationRepository) ListAfter(ctx context.Context, afterID, limit int) ([]models.Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversations
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`, conversationColumns, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		conv, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, *conv)
+	}
+
+	return conversations, nil
+}
+
+// Search returns the conversations the user owns or can read through a
+// workspace, except those in the trash. The query and tags also match the
+// notes and tags of the user's annotations.
+func (r *ConversationRepository) Search(ctx context.Context, userID int, filters models.SearchFilters) ([]models.Conversation, error) {
+	conditions := []string{"deleted_at IS NULL", itemAccess(r.schema, 1, 2)}
+	args := []interface{}{userID, models.RolesAllowing(models.RoleViewer)}
+	argPos := 3
+
+	baseQuery := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversations
+	`, conversationColumns, r.schema)
 
 	if filters.Query != "" {
-		conditions = append(conditions, fmt.Sprintf(
-			"(title ILIKE $%d OR description ILIKE $%d OR content ILIKE $%d)",
-			argPos, argPos, argPos,
-		))
-		args = append(args, "%"+filters.Query+"%")
-		argPos++
+		// Encrypted content is matched by whole words through its blind index;
+		// plaintext rows and the other fields keep substring matching
+		// The user's annotation notes match too
+		annotated := fmt.Sprintf(`id IN (SELECT conversation_id FROM "%s".annotations WHERE user_id = $1 AND note ILIKE $%d)`,
+			r.schema, argPos)
+		if filters.ExcludeReasoning {
+			// Content is matched through the answers and citations of its
+			// messages, leaving reasoning traces and tool calls out
+			queryPos := argPos
+			matched := fmt.Sprintf("content ILIKE $%d", queryPos)
+			args = append(args, "%"+filters.Query+"%")
+			argPos++
+			if terms := contentTerms(r.keyring, filters.Query); len(terms) > 0 {
+				matched += fmt.Sprintf(" OR content_terms @> $%d", argPos)
+				args = append(args, terms)
+				argPos++
+			}
+			answered := fmt.Sprintf(`id IN (
+				SELECT conversation_id FROM "%s".message_segments
+				WHERE kind IN ('%s', '%s') AND (%s)
+			)`, r.schema, models.SegmentKindAnswer, models.SegmentKindCitation, matched)
+			conditions = append(conditions, fmt.Sprintf(
+				"(title ILIKE $%d OR description ILIKE $%d OR %s OR %s)",
+				queryPos, queryPos, answered, annotated,
+			))
+		} else if terms := contentTerms(r.keyring, filters.Query); len(terms) > 0 {
+			conditions = append(conditions, fmt.Sprintf(
+				"(title ILIKE $%d OR description ILIKE $%d OR content ILIKE $%d OR content_terms @> $%d OR %s)",
+				argPos, argPos, argPos, argPos+1, annotated,
+			))
+			args = append(args, "%"+filters.Query+"%", terms)
+			argPos += 2
+		} else {
+			conditions = append(conditions, fmt.Sprintf(
+				"(title ILIKE $%d OR description ILIKE $%d OR content ILIKE $%d OR %s)",
+				argPos, argPos, argPos, annotated,
+			))
+			args = append(args, "%"+filters.Query+"%")
+			argPos++
+		}
 	}
 
 	if filters.Source != "" {
@@ -158,7 +592,10 @@ func (r *ConversationRepository) Search(ctx context.Context, filters models.Sear
 	}
 
 	if len(filters.Tags) > 0 {
-		conditions = append(conditions, fmt.Sprintf("tags && $%d", argPos))
+		conditions = append(conditions, fmt.Sprintf(
+			`(tags && $%[1]d OR id IN (SELECT conversation_id FROM "%[2]s".annotations WHERE user_id = $1 AND tags && $%[1]d))`,
+			argPos, r.schema,
+		))
 		args = append(args, filters.Tags)
 		argPos++
 	}
@@ -169,13 +606,74 @@ func (r *ConversationRepository) Search(ctx context.Context, filters models.Sear
 		argPos++
 	}
 
-	if len(conditions) > 0 {
-		baseQuery += " WHERE " + strings.Join(conditions, " AND ")
+	if filters.Language != "" {
+		conditions = append(conditions, fmt.Sprintf("language = $%d", argPos))
+		args = append(args, strings.ToLower(filters.Language))
+		argPos++
+	}
+
+	if filters.Model != "" {
+		// Model names are stored lowercased with dashes, see pkg/enrichment
+		conditions = append(conditions, fmt.Sprintf("model ILIKE $%d", argPos))
+		args = append(args, "%"+strings.Join(strings.Fields(filters.Model), "-")+"%")
+		argPos++
+	}
+
+	if filters.CodeLanguage != "" {
+		conditions = append(conditions, fmt.Sprintf("code_languages @> ARRAY[$%d]::text[]", argPos))
+		args = append(args, strings.ToLower(filters.CodeLanguage))
+		argPos++
+	}
+
+	if filters.HasCode != nil {
+		if *filters.HasCode {
+			conditions = append(conditions, "code_block_count > 0")
+		} else {
+			conditions = append(conditions, "code_block_count = 0")
+		}
+	}
+
+	if filters.MinWords != nil {
+		conditions = append(conditions, fmt.Sprintf("word_count >= $%d", argPos))
+		args = append(args, *filters.MinWords)
+		argPos++
+	}
+
+	if filters.MaxWords != nil {
+		conditions = append(conditions, fmt.Sprintf("word_count <= $%d", argPos))
+		args = append(args, *filters.MaxWords)
+		argPos++
+	}
+
+	if filters.MinTurns != nil {
+		conditions = append(conditions, fmt.Sprintf("turn_count >= $%d", argPos))
+		args = append(args, *filters.MinTurns)
+		argPos++
+	}
+
+	if filters.MaxTurns != nil {
+		conditions = append(conditions, fmt.Sprintf("turn_count <= $%d", argPos))
+		args = append(args, *filters.MaxTurns)
+		argPos++
+	}
+
+	// Conversations with messages in the period
+	if filters.MessagesSince != nil {
+		conditions = append(conditions, fmt.Sprintf("last_message_at >= $%d", argPos))
+		args = append(args, *filters.MessagesSince)
+		argPos++
 	}
 
+	if filters.MessagesUntil != nil {
+		conditions = append(conditions, fmt.Sprintf("first_message_at <= $%d", argPos))
+		args = append(args, *filters.MessagesUntil)
+		argPos++
+	}
+
+	baseQuery += " WHERE " + strings.Join(conditions, " AND ")
 	baseQuery += " ORDER BY updated_at DESC LIMIT 100"
 
-	rows, err := r.pool.Query(ctx, baseQuery, args...)
+	rows, err := conn(ctx, r.pool).Query(ctx, baseQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search conversations: %w", err)
 	}
@@ -183,19 +681,90 @@ func (r *ConversationRepository) Search(ctx context.Context, filters models.Sear
 
 	var conversations []models.Conversation
 	for rows.Next() {
-		var conv models.Conversation
-		err := rows.Scan(
-			&conv.ID, &conv.CanonicalURL, &conv.ShareURL, &conv.Source,
-			&conv.Title, &conv.Description, &conv.Content,
-			&conv.Tags, &conv.CollectionID, &conv.Ignore,
-			&conv.Version, &conv.CreatedAt, &conv.UpdatedAt,
-		)
+		conv, err := r.scan(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conversation: %w", err)
 		}
-		conversations = append(conversations, conv)
+		conversations = append(conversations, *conv)
 	}
 
 	return conversations, nil
 }
 
+// contentFingerprint returns the SimHash of content as stored in the
+// content_fingerprint column, or nil for content without words
+func contentFingerprint(content string) *int64 {
+	simhash, ok := fingerprint.SimHash(content)
+	if !ok {
+		return nil
+	}
+	stored := int64(simhash)
+	return &stored
+}
+
+// countTokens sets the token count of a conversation with the tokenizer of its source
+func (r *ConversationRepository) countTokens(conv *models.Conversation) {
+	t := r.tokenizers.ForSource(conv.Source)
+	count, name := t.Count(conv.Content), t.Name()
+	conv.TokenCount, conv.Tokenizer = &count, &name
+}
+
+// contentMetadata returns the metadata derived from content, with the empty
+// fields as nil
+func contentMetadata(content string) *models.ConversationMetadata {
+	derived := enrichment.Analyze(content)
+	metadata := &models.ConversationMetadata{
+		WordCount:      derived.WordCount,
+		TurnCount:      derived.TurnCount,
+		CodeBlockCount: derived.CodeBlockCount,
+		CodeLanguages:  derived.CodeLanguages,
+		FirstMessageAt: derived.FirstMessageAt,
+		LastMessageAt:  derived.LastMessageAt,
+	}
+	if derived.Language != "" {
+		metadata.Language = &derived.Language
+	}
+	if derived.Model != "" {
+		metadata.Model = &derived.Model
+	}
+	return metadata
+}
+
+// scan reads a row of conversationColumns and decrypts its content
+func (r *ConversationRepository) scan(row pgx.Row) (*models.Conversation, error) {
+	var conv models.Conversation
+	var content sealedContent
+	var wordCount, turnCount, codeBlockCount *int
+	var metadata models.ConversationMetadata
+	err := row.Scan(
+		&conv.ID, &conv.OwnerID, &conv.CanonicalURL, &conv.ShareURL, &conv.Source,
+		&conv.Title, &conv.Description, &content.Content,
+		&conv.Tags, &conv.CollectionID, &conv.Ignore,
+		&conv.Version, &conv.CreatedAt, &conv.UpdatedAt, &conv.DeletedAt,
+		&content.Ciphertext, &content.DataKey, &content.KeyID,
+		&wordCount, &turnCount, &metadata.Language, &codeBlockCount, &metadata.CodeLanguages, &metadata.Model,
+		&metadata.FirstMessageAt, &metadata.LastMessageAt, &conv.TokenCount, &conv.Tokenizer,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Metadata is only missing from conversations saved before it existed
+	if wordCount != nil {
+		metadata.WordCount = *wordCount
+		if turnCount != nil {
+			metadata.TurnCount = *turnCount
+		}
+		if codeBlockCount != nil {
+			metadata.CodeBlockCount = *codeBlockCount
+		}
+		if metadata.CodeLanguages == nil {
+			metadata.CodeLanguages = []string{}
+		}
+		conv.Metadata = &metadata
+	}
+	if conv.Content, err = content.open(r.keyring); err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/textdiff"
+)
+
+// fullVersionInterval is how often a version keeps its full content rather than
+// a delta, so that reading a version applies at most this many deltas
+const fullVersionInterval = 20
+
+// ConversationVersionRepository stores the past versions of conversations.
+// Access control is done on the conversation, so methods take a conversation only.
+type ConversationVersionRepository struct {
+	pool    *pgxpool.Pool
+	schema  string
+	keyring *encryption.Keyring
+}
+
+// NewConversationVersionRepository creates the repository. Content is encrypted
+// at rest when keyring is non-nil.
+func NewConversationVersionRepository(pool *pgxpool.Pool, schema string, keyring *encryption.Keyring) *ConversationVersionRepository {
+	return &ConversationVersionRepository{
+		pool:    pool,
+		schema:  schema,
+		keyring: keyring,
+	}
+}
+
+// Create stores the current state of conv before it is replaced by a version
+// whose content is next. The content is stored as a delta from next.
+func (r *ConversationVersionRepository) Create(ctx context.Context, conv *models.Conversation, next string) error {
+	var prefix, suffix *int
+	text := conv.Content
+	if delta := textdiff.Compute(next, conv.Content); conv.Version%fullVersionInterval != 0 && delta.Size() < len(conv.Content) {
+		prefix, suffix, text = &delta.Prefix, &delta.Suffix, delta.Text
+	}
+
+	content, err := sealContent(r.keyring, text)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".conversation_versions
+		(conversation_id, version, title, description, tags, content_length, saved_at,
+		 delta_prefix, delta_suffix, content, content_ciphertext, data_key, master_key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, r.schema)
+
+	_, err = conn(ctx, r.pool).Exec(ctx, query,
+		*conv.ID, conv.Version, conv.Title, conv.Description, conv.Tags, len(conv.Content), conv.UpdatedAt,
+		prefix, suffix, content.Content, content.Ciphertext, content.DataKey, content.KeyID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create conversation version: %w", err)
+	}
+	return nil
+}
+
+// List returns the past versions of a conversation without their content, newest first
+func (r *ConversationVersionRepository) List(ctx context.Context, conversationID int) ([]models.ConversationVersion, error) {
+	query := fmt.Sprintf(`
+		SELECT conversation_id, version, title, description, tags, content_length, saved_at
+		FROM "%s".conversation_versions
+		WHERE conversation_id = $1
+		ORDER BY version DESC
+	`, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversation versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []models.ConversationVersion{}
+	for rows.Next() {
+		var v models.ConversationVersion
+		err := rows.Scan(&v.ConversationID, &v.Version, &v.Title, &v.Description, &v.Tags, &v.ContentLength, &v.SavedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+}
+
+// Get returns a past version of the conversation conv with its content, or nil
+// if there is no such version. Its content is rebuilt from the content of conv
+// by applying the deltas of the versions in between.
+func (r *ConversationVersionRepository) Get(ctx context.Context, conv *models.Conversation, version int) (*models.ConversationVersion, error) {
+	// Read from the nearest full version at or after the requested one
+	query := fmt.Sprintf(`
+		SELECT conversation_id, version, title, description, tags, content_length, saved_at,
+		       delta_prefix, delta_suffix, content, content_ciphertext, data_key, master_key_id
+		FROM "%[1]s".conversation_versions
+		WHERE conversation_id = $1 AND version >= $2 AND version <= COALESCE((
+			SELECT MIN(version) FROM "%[1]s".conversation_versions
+			WHERE conversation_id = $1 AND version >= $2 AND delta_prefix IS NULL
+		), $3)
+		ORDER BY version DESC
+	`, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, *conv.ID, version, conv.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation version: %w", err)
+	}
+	defer rows.Close()
+
+	var v *models.ConversationVersion
+	content := conv.Content
+	for rows.Next() {
+		v = &models.ConversationVersion{}
+		var prefix, suffix *int
+		var sealed sealedContent
+		err := rows.Scan(
+			&v.ConversationID, &v.Version, &v.Title, &v.Description, &v.Tags, &v.ContentLength, &v.SavedAt,
+			&prefix, &suffix, &sealed.Content, &sealed.Ciphertext, &sealed.DataKey, &sealed.KeyID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation version: %w", err)
+		}
+		text, err := sealed.open(r.keyring)
+		if err != nil {
+			return nil, err
+		}
+
+		if prefix == nil {
+			content = text
+			continue
+		}
+		delta := textdiff.Delta{Prefix: *prefix, Suffix: *suffix, Text: text}
+		if content, err = delta.Apply(content); err != nil {
+			return nil, fmt.Errorf("failed to rebuild version %d of conversation %d: %w", v.Version, v.ConversationID, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get conversation version: %w", err)
+	}
+
+	if v == nil || v.Version != version {
+		return nil, nil
+	}
+	v.Content = &content
+	return v, nil
+}
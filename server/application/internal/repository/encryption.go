@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
+)
+
+// sealedContent holds the column values of a content field that is encrypted
+// at rest when a keyring is configured. Plaintext rows have a nil DataKey.
+type sealedContent struct {
+	Content    string
+	Ciphertext []byte
+	DataKey    []byte
+	KeyID      *string
+}
+
+// sealContent encrypts content with a fresh data key, or keeps it in clear
+// when encryption is disabled
+func sealContent(keyring *encryption.Keyring, content string) (sealedContent, error) {
+	if keyring == nil {
+		return sealedContent{Content: content}, nil
+	}
+	env, err := keyring.Seal([]byte(content))
+	if err != nil {
+		return sealedContent{}, fmt.Errorf("failed to encrypt content: %w", err)
+	}
+	return sealedContent{
+		Ciphertext: env.Ciphertext,
+		DataKey:    env.WrappedKey,
+		KeyID:      &env.KeyID,
+	}, nil
+}
+
+// open returns the plaintext content
+func (c sealedContent) open(keyring *encryption.Keyring) (string, error) {
+	if c.DataKey == nil {
+		return c.Content, nil
+	}
+	if keyring == nil {
+		return "", fmt.Errorf("content is encrypted but no encryption keys are configured")
+	}
+	plaintext, err := keyring.Open(&encryption.Envelope{
+		KeyID:      stringValue(c.KeyID),
+		WrappedKey: c.DataKey,
+		Ciphertext: c.Ciphertext,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt content: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// contentTerms returns the blind index of content, or nil when encryption is disabled
+func contentTerms(keyring *encryption.Keyring, content string) []string {
+	if keyring == nil {
+		return nil
+	}
+	return keyring.IndexTerms(content)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// RotationResult counts the rows touched by a key rotation
+type RotationResult struct {
+	Rewrapped int
+	Encrypted int
+	Skipped   int
+}
+
+// encryptedTables maps the tables with encrypted content to whether they keep a blind index
+var encryptedTables = map[string]bool{
+	"conversations":         true,
+	"conversation_versions": false,
+	"snippets":              false,
+	"messages":              false,
+	"message_segments":      true,
+	"annotations":           false,
+}
+
+// KeyRotationRepository re-wraps data keys with the active master key.
+// It works across all users and is meant for the rotate-keys command.
+type KeyRotationRepository struct {
+	pool    *pgxpool.Pool
+	schema  string
+	keyring *encryption.Keyring
+}
+
+func NewKeyRotationRepository(pool *pgxpool.Pool, schema string, keyring *encryption.Keyring) *KeyRotationRepository {
+	return &KeyRotationRepository{
+		pool:    pool,
+		schema:  schema,
+		keyring: keyring,
+	}
+}
+
+// Rotate walks table in batches and re-wraps every data key that is not wrapped
+// by the active master key. Plaintext rows are encrypted. Each row is updated
+// on its own and only if it did not change meanwhile, so the server can keep
+// running; rows written concurrently are skipped, as they already use the active key.
+func (r *KeyRotationRepository) Rotate(ctx context.Context, table string, batchSize int) (*RotationResult, error) {
+	withTerms, ok := encryptedTables[table]
+	if !ok {
+		return nil, fmt.Errorf("table %s has no encrypted content", table)
+	}
+
+	result := &RotationResult{}
+	activeID := r.keyring.ActiveKeyID()
+	lastID := 0
+	for {
+		query := fmt.Sprintf(`
+			SELECT id, content, content_ciphertext, data_key, master_key_id
+			FROM "%s".%s
+			WHERE id > $1 AND (data_key IS NULL OR master_key_id IS DISTINCT FROM $2)
+			ORDER BY id
+			LIMIT $3
+		`, r.schema, table)
+
+		rows, err := r.pool.Query(ctx, query, lastID, activeID, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s to rotate: %w", table, err)
+		}
+		type pending struct {
+			id      int
+			content sealedContent
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.content.Content, &p.content.Ciphertext, &p.content.DataKey, &p.content.KeyID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan %s row: %w", table, err)
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list %s to rotate: %w", table, err)
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			var updated bool
+			var err error
+			if p.content.DataKey == nil {
+				updated, err = r.encryptRow(ctx, table, withTerms, p.id, p.content.Content)
+				if updated {
+					result.Encrypted++
+				}
+			} else {
+				updated, err = r.rewrapRow(ctx, table, p.id, p.content)
+				if updated {
+					result.Rewrapped++
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !updated {
+				result.Skipped++
+			}
+		}
+	}
+}
+
+func (r *KeyRotationRepository) encryptRow(ctx context.Context, table string, withTerms bool, id int, plaintext string) (bool, error) {
+	content, err := sealContent(r.keyring, plaintext)
+	if err != nil {
+		return false, err
+	}
+
+	var terms []string
+	setTerms := ""
+	if withTerms {
+		terms = r.keyring.IndexTerms(plaintext)
+		setTerms = ", content_terms = $6"
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE "%s".%s
+		SET content = '', content_ciphertext = $1, data_key = $2, master_key_id = $3%s
+		WHERE id = $4 AND data_key IS NULL AND content = $5
+	`, r.schema, table, setTerms)
+
+	args := []interface{}{content.Ciphertext, content.DataKey, content.KeyID, id, plaintext}
+	if withTerms {
+		args = append(args, terms)
+	}
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to encrypt %s %d: %w", table, id, err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *KeyRotationRepository) rewrapRow(ctx context.Context, table string, id int, content sealedContent) (bool, error) {
+	wrapped, err := r.keyring.Rewrap(&encryption.Envelope{
+		KeyID:      stringValue(content.KeyID),
+		WrappedKey: content.DataKey,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrap data key of %s %d: %w", table, id, err)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE "%s".%s
+		SET data_key = $1, master_key_id = $2
+		WHERE id = $3 AND data_key = $4
+	`, r.schema, table)
+
+	tag, err := r.pool.Exec(ctx, query, wrapped, r.keyring.ActiveKeyID(), id, content.DataKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrap data key of %s %d: %w", table, id, err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
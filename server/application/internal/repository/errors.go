@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrStaleVersion is returned by updates when the stored version of the row
+// is no longer the one the update was based on, because of a concurrent write
+var ErrStaleVersion = errors.New("stale version")
+
+// ErrDuplicate is returned when a write would break a uniqueness rule, such as
+// restoring a row from the trash when a live row with the same key was created
+// meanwhile, or creating a relation that exists
+var ErrDuplicate = errors.New("duplicate")
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/tokenizer"
+)
+
+// messageColumns are the columns read by scan, in order
+const messageColumns = `id, conversation_id, ordinal, role, content, model, created_at,
+		       content_ciphertext, data_key, master_key_id, token_count`
+
+// MessageRepository stores the messages parsed from conversations. Access
+// control is done on the conversation, so methods take a conversation ID only.
+type MessageRepository struct {
+	pool       *pgxpool.Pool
+	schema     string
+	keyring    *encryption.Keyring
+	tokenizers *tokenizer.Registry
+}
+
+// NewMessageRepository creates the repository. Content is encrypted at rest
+// when keyring is non-nil, and its tokens are counted with the tokenizer
+// tokenizers has for the conversation's source.
+func NewMessageRepository(pool *pgxpool.Pool, schema string, keyring *encryption.Keyring, tokenizers *tokenizer.Registry) *MessageRepository {
+	return &MessageRepository{
+		pool:       pool,
+		schema:     schema,
+		keyring:    keyring,
+		tokenizers: tokenizers,
+	}
+}
+
+// segmentColumns are the columns read by scanSegment, in order
+const segmentColumns = `s.id, s.message_id, m.ordinal, s.ordinal, s.kind, s.content,
+		       s.content_ciphertext, s.data_key, s.master_key_id`
+
+// Replace deletes the messages of a conversation and inserts messages in their place,
+// numbering them from 1 in order and counting their tokens with the tokenizer
+// of source, the source of the conversation. The segments of each message are
+// inserted with it.
+func (r *MessageRepository) Replace(ctx context.Context, conversationID int, source string, messages []models.Message) error {
+	t := r.tokenizers.ForSource(source)
+
+	query := fmt.Sprintf(`DELETE FROM "%s".messages WHERE conversation_id = $1`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, conversationID); err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+
+	insert := fmt.Sprintf(`
+		INSERT INTO "%s".messages
+		(conversation_id, ordinal, role, content, model, content_ciphertext, data_key, master_key_id, token_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+	`, r.schema)
+
+	for i := range messages {
+		msg := &messages[i]
+		msg.ConversationID = conversationID
+		msg.Ordinal = i + 1
+		count := t.Count(msg.Content)
+		msg.TokenCount = &count
+
+		content, err := sealContent(r.keyring, msg.Content)
+		if err != nil {
+			return err
+		}
+		err = conn(ctx, r.pool).QueryRow(ctx, insert,
+			conversationID, msg.Ordinal, msg.Role, content.Content, msg.Model,
+			content.Ciphertext, content.DataKey, content.KeyID, msg.TokenCount,
+		).Scan(&msg.ID, &msg.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create message: %w", err)
+		}
+		if err := r.insertSegments(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertSegments inserts the segments of a message just inserted, numbering
+// them from 1 in order. Their content is indexed when it is encrypted.
+func (r *MessageRepository) insertSegments(ctx context.Context, msg *models.Message) error {
+	insert := fmt.Sprintf(`
+		INSERT INTO "%s".message_segments
+		(message_id, conversation_id, ordinal, kind, content, content_ciphertext, data_key, master_key_id, content_terms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, r.schema)
+
+	for i := range msg.Segments {
+		seg := &msg.Segments[i]
+		seg.MessageID = *msg.ID
+		seg.MessageOrdinal = msg.Ordinal
+		seg.Ordinal = i + 1
+
+		content, err := sealContent(r.keyring, seg.Content)
+		if err != nil {
+			return err
+		}
+		err = conn(ctx, r.pool).QueryRow(ctx, insert,
+			seg.MessageID, msg.ConversationID, seg.Ordinal, seg.Kind, content.Content,
+			content.Ciphertext, content.DataKey, content.KeyID, contentTerms(r.keyring, seg.Content),
+		).Scan(&seg.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create message segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// Count returns the number of messages of a conversation
+func (r *MessageRepository) Count(ctx context.Context, conversationID int) (int, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM "%s".messages WHERE conversation_id = $1`, r.schema)
+
+	var count int
+	if err := conn(ctx, r.pool).QueryRow(ctx, query, conversationID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+	return count, nil
+}
+
+// CountSegments returns the number of message segments of a conversation
+func (r *MessageRepository) CountSegments(ctx context.Context, conversationID int) (int, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM "%s".message_segments WHERE conversation_id = $1`, r.schema)
+
+	var count int
+	if err := conn(ctx, r.pool).QueryRow(ctx, query, conversationID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count message segments: %w", err)
+	}
+	return count, nil
+}
+
+// ListSegments returns the message segments of a conversation matching
+// filters, in order of their message and of their position in it
+func (r *MessageRepository) ListSegments(ctx context.Context, conversationID int, filters models.SegmentFilters) ([]models.MessageSegment, error) {
+	conditions := []string{"s.conversation_id = $1"}
+	args := []interface{}{conversationID}
+
+	if len(filters.Kinds) > 0 {
+		conditions = append(conditions, "s.kind = ANY($2)")
+		args = append(args, filters.Kinds)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %[1]s
+		FROM "%[2]s".message_segments s
+		JOIN "%[2]s".messages m ON m.id = s.message_id
+		WHERE %[3]s
+		ORDER BY m.ordinal, s.ordinal
+	`, segmentColumns, r.schema, strings.Join(conditions, " AND "))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message segments: %w", err)
+	}
+	defer rows.Close()
+
+	segments := []models.MessageSegment{}
+	for rows.Next() {
+		var seg models.MessageSegment
+		var content sealedContent
+		err := rows.Scan(
+			&seg.ID, &seg.MessageID, &seg.MessageOrdinal, &seg.Ordinal, &seg.Kind, &content.Content,
+			&content.Ciphertext, &content.DataKey, &content.KeyID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message segment: %w", err)
+		}
+		if seg.Content, err = content.open(r.keyring); err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+
+	return segments, nil
+}
+
+// List returns the messages of a conversation matching filters, in order
+func (r *MessageRepository) List(ctx context.Context, conversationID int, filters models.MessageFilters) ([]models.Message, error) {
+	conditions := []string{"conversation_id = $1"}
+	args := []interface{}{conversationID}
+	argPos := 2
+
+	if filters.From != nil {
+		conditions = append(conditions, fmt.Sprintf("ordinal >= $%d", argPos))
+		args = append(args, *filters.From)
+		argPos++
+	}
+
+	if filters.To != nil {
+		conditions = append(conditions, fmt.Sprintf("ordinal <= $%d", argPos))
+		args = append(args, *filters.To)
+		argPos++
+	}
+
+	if filters.Role != "" {
+		conditions = append(conditions, fmt.Sprintf("role = $%d", argPos))
+		args = append(args, filters.Role)
+		argPos++
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".messages
+		WHERE %s
+		ORDER BY ordinal
+	`, messageColumns, r.schema, strings.Join(conditions, " AND "))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		msg, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, nil
+}
+
+// scan reads a row of messageColumns and decrypts its content
+func (r *MessageRepository) scan(row pgx.Row) (*models.Message, error) {
+	var msg models.Message
+	var content sealedContent
+	err := row.Scan(
+		&msg.ID, &msg.ConversationID, &msg.Ordinal, &msg.Role, &content.Content, &msg.Model, &msg.CreatedAt,
+		&content.Ciphertext, &content.DataKey, &content.KeyID, &msg.TokenCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Content, err = content.open(r.keyring); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
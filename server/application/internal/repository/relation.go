@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+// relationColumns are the columns read by scanRelation, in order
+const relationColumns = `id, user_id, source_id, target_id, type, note, created_at, updated_at`
+
+// RelationRepository stores typed relations between conversations
+type RelationRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewRelationRepository(pool *pgxpool.Pool, schema string) *RelationRepository {
+	return &RelationRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+// GetByID returns a relation whatever the conversations it links, or nil.
+// Callers check access to both conversations.
+func (r *RelationRepository) GetByID(ctx context.Context, id int) (*models.ConversationRelation, error) {
+	query := fmt.Sprintf(`SELECT %s FROM "%s".conversation_relations WHERE id = $1`, relationColumns, r.schema)
+
+	relation, err := scanRelation(conn(ctx, r.pool).QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relation: %w", err)
+	}
+	return relation, nil
+}
+
+// Find returns the relation of a type between two conversations, or nil
+func (r *RelationRepository) Find(ctx context.Context, sourceID, targetID int, relationType string) (*models.ConversationRelation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversation_relations
+		WHERE source_id = $1 AND target_id = $2 AND type = $3
+	`, relationColumns, r.schema)
+
+	relation, err := scanRelation(conn(ctx, r.pool).QueryRow(ctx, query, sourceID, targetID, relationType))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find relation: %w", err)
+	}
+	return relation, nil
+}
+
+// ListByConversations returns the relations of any of the given conversations
+// whose two ends the user may read, except those to conversations in the
+// trash, oldest first
+func (r *RelationRepository) ListByConversations(ctx context.Context, userID int, conversationIDs []int) ([]models.ConversationRelation, error) {
+	readable := fmt.Sprintf(`SELECT id FROM "%s".conversations WHERE deleted_at IS NULL AND %s`,
+		r.schema, itemAccess(r.schema, 1, 2))
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversation_relations
+		WHERE (source_id = ANY($3) OR target_id = ANY($3))
+		  AND source_id IN (%s) AND target_id IN (%s)
+		ORDER BY created_at, id
+	`, relationColumns, r.schema, readable, readable)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleViewer), conversationIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relations: %w", err)
+	}
+	return collectRelations(rows)
+}
+
+// ListByConversation returns all the relations of a conversation, whoever
+// may read the other end. It is meant for merges moving them to another one.
+func (r *RelationRepository) ListByConversation(ctx context.Context, conversationID int) ([]models.ConversationRelation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".conversation_relations
+		WHERE source_id = $1 OR target_id = $1
+		ORDER BY id
+	`, relationColumns, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relations: %w", err)
+	}
+	return collectRelations(rows)
+}
+
+// Nodes returns the graph nodes of the given conversations the user may read,
+// except those in the trash. Depths are left to the caller.
+func (r *RelationRepository) Nodes(ctx context.Context, userID int, conversationIDs []int) ([]models.GraphNode, error) {
+	query := fmt.Sprintf(`
+		SELECT id, title, source, canonical_url, created_at
+		FROM "%s".conversations
+		WHERE id = ANY($3) AND deleted_at IS NULL AND %s
+	`, r.schema, itemAccess(r.schema, 1, 2))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleViewer), conversationIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list graph nodes: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := []models.GraphNode{}
+	for rows.Next() {
+		var node models.GraphNode
+		if err := rows.Scan(&node.ID, &node.Title, &node.Source, &node.CanonicalURL, &node.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan graph node: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
+// Create inserts a relation, keeping its creation date if it has one, as when
+// restored from a backup. It returns ErrDuplicate if the same relation exists.
+func (r *RelationRepository) Create(ctx context.Context, relation *models.ConversationRelation) error {
+	var createdAt interface{}
+	if !relation.CreatedAt.IsZero() {
+		createdAt = relation.CreatedAt
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".conversation_relations (user_id, source_id, target_id, type, note, created_at)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, NOW()))
+		RETURNING id, created_at, updated_at
+	`, r.schema)
+
+	err := conn(ctx, r.pool).QueryRow(ctx, query,
+		relation.UserID, relation.SourceID, relation.TargetID, relation.Type, relation.Note, createdAt,
+	).Scan(&relation.ID, &relation.CreatedAt, &relation.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create relation: %w", err)
+	}
+	return nil
+}
+
+// Update stores the conversations, type and note of a relation. It returns
+// ErrDuplicate if the same relation exists.
+func (r *RelationRepository) Update(ctx context.Context, relation *models.ConversationRelation) error {
+	query := fmt.Sprintf(`
+		UPDATE "%s".conversation_relations
+		SET source_id = $1, target_id = $2, type = $3, note = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING updated_at
+	`, r.schema)
+
+	err := conn(ctx, r.pool).QueryRow(ctx, query,
+		relation.SourceID, relation.TargetID, relation.Type, relation.Note, relation.ID,
+	).Scan(&relation.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update relation: %w", err)
+	}
+	return nil
+}
+
+func (r *RelationRepository) Delete(ctx context.Context, id int) error {
+	query := fmt.Sprintf(`DELETE FROM "%s".conversation_relations WHERE id = $1`, r.schema)
+	if _, err := conn(ctx, r.pool).Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete relation: %w", err)
+	}
+	return nil
+}
+
+// collectRelations reads and closes rows of relationColumns
+func collectRelations(rows pgx.Rows) ([]models.ConversationRelation, error) {
+	defer rows.Close()
+
+	relations := []models.ConversationRelation{}
+	for rows.Next() {
+		relation, err := scanRelation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan relation: %w", err)
+		}
+		relations = append(relations, *relation)
+	}
+	return relations, rows.Err()
+}
+
+// scanRelation reads a row of relationColumns
+func scanRelation(row pgx.Row) (*models.ConversationRelation, error) {
+	var relation models.ConversationRelation
+	err := row.Scan(
+		&relation.ID, &relation.UserID, &relation.SourceID, &relation.TargetID,
+		&relation.Type, &relation.Note, &relation.CreatedAt, &relation.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &relation, nil
+}
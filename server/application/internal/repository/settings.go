@@ -22,29 +22,28 @@ func NewSettingsRepository(pool *pgxpool.Pool, schema string) *SettingsRepositor
 	}
 }
 
-func (r *SettingsRepository) Get(ctx context.Context) (*models.Settings, error) {
+func (r *SettingsRepository) Get(ctx context.Context, userID int) (*models.Settings, error) {
 	query := fmt.Sprintf(`
-		SELECT id, storage_mode, backend_url, api_key, disable_local_cache,
+		SELECT id, storage_mode, backend_url, api_key_hint, disable_local_cache,
 		       beast_enabled_per_domain, selective_mode_enabled,
-		       dev_mode_enabled, xpaths_by_domain, created_at, updated_at
+		       dev_mode_enabled, xpaths_by_domain, version, created_at, updated_at
 		FROM "%s".settings
-		WHERE id = 1
+		WHERE user_id = $1
 	`, r.schema)
 
 	var settings models.Settings
 	var beastEnabledJSON []byte
 	var xpathsJSON []byte
 
-	err := r.pool.QueryRow(ctx, query).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, userID).Scan(
 		&settings.ID, &settings.StorageMode, &settings.BackendURL, &settings.APIKey,
 		&settings.DisableLocalCache, &beastEnabledJSON,
 		&settings.SelectiveModeEnabled, &settings.DevModeEnabled,
-		&xpathsJSON, &settings.CreatedAt, &settings.UpdatedAt,
+		&xpathsJSON, &settings.Version, &settings.CreatedAt, &settings.UpdatedAt,
 	)
 	if err == pgx.ErrNoRows {
-		// Return default settings if none exist
+		// Return default settings if none exist, as version 0
 		return &models.Settings{
-			ID:                   intPtr(1),
 			StorageMode:          "local",
 			BeastEnabledPerDomain: make(map[string]bool),
 			XPathsByDomain:       make(map[string]models.XPathConfig),
@@ -65,7 +64,10 @@ func (r *SettingsRepository) Get(ctx context.Context) (*models.Settings, error)
 	return &settings, nil
 }
 
-func (r *SettingsRepository) Update(ctx context.Context, settings *models.Settings) error {
+// Update stores settings as given. Secrets must already be redacted by the caller.
+// settings.Version must follow the stored version, 0 if there is none yet,
+// otherwise it returns ErrStaleVersion.
+func (r *SettingsRepository) Update(ctx context.Context, userID int, settings *models.Settings) error {
 	beastEnabledJSON, err := json.Marshal(settings.BeastEnabledPerDomain)
 	if err != nil {
 		return fmt.Errorf("failed to marshal beast_enabled_per_domain: %w", err)
@@ -77,38 +79,40 @@ func (r *SettingsRepository) Update(ctx context.Context, settings *models.Settin
 	}
 
 	query := fmt.Sprintf(`
-		INSERT INTO "%s".settings
-		(id, storage_mode, backend_url, api_key, disable_local_cache,
+		INSERT INTO "%s".settings AS existing
+		(user_id, storage_mode, backend_url, api_key_hint, disable_local_cache,
 		 beast_enabled_per_domain, selective_mode_enabled,
-		 dev_mode_enabled, xpaths_by_domain, created_at, updated_at)
-		VALUES (1, $1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
-		ON CONFLICT (id) DO UPDATE SET
+		 dev_mode_enabled, xpaths_by_domain, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
 			storage_mode = EXCLUDED.storage_mode,
 			backend_url = EXCLUDED.backend_url,
-			api_key = EXCLUDED.api_key,
+			api_key_hint = EXCLUDED.api_key_hint,
 			disable_local_cache = EXCLUDED.disable_local_cache,
 			beast_enabled_per_domain = EXCLUDED.beast_enabled_per_domain,
 			selective_mode_enabled = EXCLUDED.selective_mode_enabled,
 			dev_mode_enabled = EXCLUDED.dev_mode_enabled,
 			xpaths_by_domain = EXCLUDED.xpaths_by_domain,
+			version = EXCLUDED.version,
 			updated_at = NOW()
-		RETURNING created_at, updated_at
+		WHERE existing.version = $11
+		RETURNING id, created_at, updated_at
 	`, r.schema)
 
-	err = r.pool.QueryRow(ctx, query,
-		settings.StorageMode, settings.BackendURL, settings.APIKey, settings.DisableLocalCache,
+	var id int
+	err = conn(ctx, r.pool).QueryRow(ctx, query,
+		userID, settings.StorageMode, settings.BackendURL, settings.APIKey, settings.DisableLocalCache,
 		beastEnabledJSON, settings.SelectiveModeEnabled,
-		settings.DevModeEnabled, xpathsJSON,
-	).Scan(&settings.CreatedAt, &settings.UpdatedAt)
+		settings.DevModeEnabled, xpathsJSON, settings.Version, settings.Version-1,
+	).Scan(&id, &settings.CreatedAt, &settings.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return ErrStaleVersion
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update settings: %w", err)
 	}
 
-	settings.ID = intPtr(1)
+	settings.ID = &id
 	return nil
 }
 
-func intPtr(i int) *int {
-	return &i
-}
-
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+// shareLinkColumns are the columns read by scanShareLink, in order
+const shareLinkColumns = `id, user_id, entity_type, entity_id, prefix, token_hash, password_hash,
+		       view_count, last_viewed_at, created_at, expires_at, revoked_at`
+
+type ShareLinkRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewShareLinkRepository(pool *pgxpool.Pool, schema string) *ShareLinkRepository {
+	return &ShareLinkRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+// GetByTokenHash looks up a link by its token hash regardless of owner, for public access
+func (r *ShareLinkRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.ShareLink, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".share_links
+		WHERE token_hash = $1
+	`, shareLinkColumns, r.schema)
+
+	link, err := scanShareLink(conn(ctx, r.pool).QueryRow(ctx, query, tokenHash))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share link by token: %w", err)
+	}
+	return link, nil
+}
+
+// List returns the user's links to one entity, newest first
+func (r *ShareLinkRepository) List(ctx context.Context, userID int, entityType string, entityID int) ([]models.ShareLink, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".share_links
+		WHERE user_id = $1 AND entity_type = $2 AND entity_id = $3
+		ORDER BY created_at DESC
+	`, shareLinkColumns, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, entityType, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		links = append(links, *link)
+	}
+
+	return links, nil
+}
+
+func (r *ShareLinkRepository) Create(ctx context.Context, userID int, link *models.ShareLink) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".share_links
+		(user_id, entity_type, entity_id, prefix, token_hash, password_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, r.schema)
+
+	err := conn(ctx, r.pool).QueryRow(ctx, query,
+		userID, link.EntityType, link.EntityID, link.Prefix, link.TokenHash,
+		link.PasswordHash, link.ExpiresAt,
+	).Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+	link.UserID = userID
+	link.HasPassword = link.PasswordHash != nil
+	return nil
+}
+
+// Revoke marks a link to the entity as revoked. It returns false if the user
+// owns no such active link.
+func (r *ShareLinkRepository) Revoke(ctx context.Context, userID int, entityType string, entityID, id int) (bool, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".share_links
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND entity_type = $3 AND entity_id = $4 AND revoked_at IS NULL
+	`, r.schema)
+
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, id, userID, entityType, entityID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RecordView counts a view of the link and returns the new view count
+func (r *ShareLinkRepository) RecordView(ctx context.Context, id int) (int, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".share_links
+		SET view_count = view_count + 1, last_viewed_at = NOW()
+		WHERE id = $1
+		RETURNING view_count
+	`, r.schema)
+
+	var count int
+	if err := conn(ctx, r.pool).QueryRow(ctx, query, id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to record share link view: %w", err)
+	}
+	return count, nil
+}
+
+func scanShareLink(row pgx.Row) (*models.ShareLink, error) {
+	var link models.ShareLink
+	err := row.Scan(
+		&link.ID, &link.UserID, &link.EntityType, &link.EntityID, &link.Prefix,
+		&link.TokenHash, &link.PasswordHash, &link.ViewCount, &link.LastViewedAt,
+		&link.CreatedAt, &link.ExpiresAt, &link.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	link.HasPassword = link.PasswordHash != nil
+	return &link, nil
+}
@@ -4,54 +4,64 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/encryption"
 )
 
+// snippetColumns are the columns read by scan, in order
+const snippetColumns = `id, user_id, title, content, source_url, source_conversation_id, tags, language,
+		       collection_id, version, created_at, deleted_at, content_ciphertext, data_key, master_key_id`
+
 type SnippetRepository struct {
-	pool   *pgxpool.Pool
-	schema string
+	pool    *pgxpool.Pool
+	schema  string
+	keyring *encryption.Keyring
 }
 
-func NewSnippetRepository(pool *pgxpool.Pool, schema string) *SnippetRepository {
+// NewSnippetRepository creates the repository. Content is encrypted at rest
+// when keyring is non-nil.
+func NewSnippetRepository(pool *pgxpool.Pool, schema string, keyring *encryption.Keyring) *SnippetRepository {
 	return &SnippetRepository{
-		pool:   pool,
-		schema: schema,
+		pool:    pool,
+		schema:  schema,
+		keyring: keyring,
 	}
 }
 
-func (r *SnippetRepository) GetByID(ctx context.Context, id int) (*models.Snippet, error) {
+// GetByID returns a snippet the user owns or can read through a workspace,
+// unless it is in the trash
+func (r *SnippetRepository) GetByID(ctx context.Context, userID, id int) (*models.Snippet, error) {
 	query := fmt.Sprintf(`
-		SELECT id, title, content, source_url, source_conversation_id, tags, language, created_at
+		SELECT %s
 		FROM "%s".snippets
-		WHERE id = $1
-	`, r.schema)
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+	`, snippetColumns, r.schema, itemAccess(r.schema, 2, 3))
 
-	var snippet models.Snippet
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&snippet.ID, &snippet.Title, &snippet.Content, &snippet.SourceURL,
-		&snippet.SourceConversationID, &snippet.Tags, &snippet.Language, &snippet.CreatedAt,
-	)
+	snippet, err := r.scan(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleViewer)))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get snippet by ID: %w", err)
 	}
-	return &snippet, nil
+	return snippet, nil
 }
 
-func (r *SnippetRepository) List(ctx context.Context, filters models.SnippetFilters) ([]models.Snippet, error) {
-	var conditions []string
-	var args []interface{}
-	argPos := 1
+// List returns the snippets the user owns or can read through a workspace,
+// except those in the trash
+func (r *SnippetRepository) List(ctx context.Context, userID int, filters models.SnippetFilters) ([]models.Snippet, error) {
+	conditions := []string{"deleted_at IS NULL", itemAccess(r.schema, 1, 2)}
+	args := []interface{}{userID, models.RolesAllowing(models.RoleViewer)}
+	argPos := 3
 
 	baseQuery := fmt.Sprintf(`
-		SELECT id, title, content, source_url, source_conversation_id, tags, language, created_at
+		SELECT %s
 		FROM "%s".snippets
-	`, r.schema)
+	`, snippetColumns, r.schema)
 
 	if filters.Language != "" {
 		conditions = append(conditions, fmt.Sprintf("language = $%d", argPos))
@@ -71,13 +81,16 @@ func (r *SnippetRepository) List(ctx context.Context, filters models.SnippetFilt
 		argPos++
 	}
 
-	if len(conditions) > 0 {
-		baseQuery += " WHERE " + strings.Join(conditions, " AND ")
+	if filters.CollectionID != nil {
+		conditions = append(conditions, fmt.Sprintf("collection_id = $%d", argPos))
+		args = append(args, *filters.CollectionID)
+		argPos++
 	}
 
+	baseQuery += " WHERE " + strings.Join(conditions, " AND ")
 	baseQuery += " ORDER BY created_at DESC LIMIT 100"
 
-	rows, err := r.pool.Query(ctx, baseQuery, args...)
+	rows, err := conn(ctx, r.pool).Query(ctx, baseQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list snippets: %w", err)
 	}
@@ -85,21 +98,17 @@ func (r *SnippetRepository) List(ctx context.Context, filters models.SnippetFilt
 
 	var snippets []models.Snippet
 	for rows.Next() {
-		var snippet models.Snippet
-		err := rows.Scan(
-			&snippet.ID, &snippet.Title, &snippet.Content, &snippet.SourceURL,
-			&snippet.SourceConversationID, &snippet.Tags, &snippet.Language, &snippet.CreatedAt,
-		)
+		snippet, err := r.scan(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan snippet: %w", err)
 		}
-		snippets = append(snippets, snippet)
+		snippets = append(snippets, *snippet)
 	}
 
 	return snippets, nil
 }
 
-func (r *SnippetRepository) Create(ctx context.Context, snippet *models.Snippet) error {
+func (r *SnippetRepository) Create(ctx context.Context, userID int, snippet *models.Snippet) error {
 	// Use provided date if not zero, otherwise use NULL to trigger DEFAULT (NOW())
 	var createdAt interface{}
 	if snippet.CreatedAt.IsZero() {
@@ -108,47 +117,198 @@ func (r *SnippetRepository) Create(ctx context.Context, snippet *models.Snippet)
 		createdAt = snippet.CreatedAt
 	}
 
+	content, err := sealContent(r.keyring, snippet.Content)
+	if err != nil {
+		return err
+	}
+
 	query := fmt.Sprintf(`
 		INSERT INTO "%s".snippets
-		(title, content, source_url, source_conversation_id, tags, language, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, created_at
+		(user_id, title, content, source_url, source_conversation_id, tags, language, created_at,
+		 content_ciphertext, data_key, master_key_id, collection_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, version, created_at
 	`, r.schema)
 
-	err := r.pool.QueryRow(ctx, query,
-		snippet.Title, snippet.Content, snippet.SourceURL,
+	err = conn(ctx, r.pool).QueryRow(ctx, query,
+		userID, snippet.Title, content.Content, snippet.SourceURL,
 		snippet.SourceConversationID, snippet.Tags, snippet.Language, createdAt,
-	).Scan(&snippet.ID, &snippet.CreatedAt)
+		content.Ciphertext, content.DataKey, content.KeyID, snippet.CollectionID,
+	).Scan(&snippet.ID, &snippet.Version, &snippet.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("failed to create snippet: %w", err)
 	}
+	snippet.OwnerID = userID
 	return nil
 }
 
-func (r *SnippetRepository) Update(ctx context.Context, snippet *models.Snippet) error {
+// Update changes a snippet the user owns or can edit through a workspace.
+// snippet.Version must follow the stored version, otherwise it returns ErrStaleVersion.
+func (r *SnippetRepository) Update(ctx context.Context, userID int, snippet *models.Snippet) error {
+	content, err := sealContent(r.keyring, snippet.Content)
+	if err != nil {
+		return err
+	}
+
 	query := fmt.Sprintf(`
 		UPDATE "%s".snippets
 		SET title = $1, content = $2, source_url = $3, source_conversation_id = $4,
-		    tags = $5, language = $6
-		WHERE id = $7
-	`, r.schema)
+		    tags = $5, language = $6,
+		    content_ciphertext = $9, data_key = $10, master_key_id = $11, collection_id = $12,
+		    version = $14
+		WHERE id = $7 AND version = $15 AND deleted_at IS NULL AND %s
+	`, r.schema, itemAccess(r.schema, 8, 13))
 
-	_, err := r.pool.Exec(ctx, query,
-		snippet.Title, snippet.Content, snippet.SourceURL,
-		snippet.SourceConversationID, snippet.Tags, snippet.Language, snippet.ID,
+	tag, err := conn(ctx, r.pool).Exec(ctx, query,
+		snippet.Title, content.Content, snippet.SourceURL,
+		snippet.SourceConversationID, snippet.Tags, snippet.Language, snippet.ID, userID,
+		content.Ciphertext, content.DataKey, content.KeyID, snippet.CollectionID,
+		models.RolesAllowing(models.RoleEditor), snippet.Version, snippet.Version-1,
 	)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrStaleVersion
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update snippet: %w", err)
 	}
 	return nil
 }
 
-func (r *SnippetRepository) Delete(ctx context.Context, id int) error {
-	query := fmt.Sprintf(`DELETE FROM "%s".snippets WHERE id = $1`, r.schema)
-	_, err := r.pool.Exec(ctx, query, id)
+// ReassignSource makes the snippets taken from conversation fromID, in the
+// trash or not, point to conversation toID instead, and returns them as updated
+func (r *SnippetRepository) ReassignSource(ctx context.Context, fromID, toID int) ([]models.Snippet, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".snippets SET source_conversation_id = $2, version = version + 1
+		WHERE source_conversation_id = $1
+		RETURNING %s
+	`, r.schema, snippetColumns)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, fromID, toID)
 	if err != nil {
-		return fmt.Errorf("failed to delete snippet: %w", err)
+		return nil, fmt.Errorf("failed to reassign snippets: %w", err)
+	}
+	defer rows.Close()
+
+	snippets := []models.Snippet{}
+	for rows.Next() {
+		snippet, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan snippet: %w", err)
+		}
+		snippets = append(snippets, *snippet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to reassign snippets: %w", err)
+	}
+
+	return snippets, nil
+}
+
+// Trash moves a snippet the user owns or can edit through a workspace to the trash
+func (r *SnippetRepository) Trash(ctx context.Context, userID, id int) error {
+	query := fmt.Sprintf(`
+		UPDATE "%s".snippets SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL AND %s
+	`, r.schema, itemAccess(r.schema, 2, 3))
+	_, err := conn(ctx, r.pool).Exec(ctx, query, id, userID, models.RolesAllowing(models.RoleEditor))
+	if err != nil {
+		return fmt.Errorf("failed to trash snippet: %w", err)
 	}
 	return nil
 }
 
+// GetTrashed returns a snippet in the trash that the user owns or can read
+// through a workspace
+func (r *SnippetRepository) GetTrashed(ctx context.Context, userID, id int) (*models.Snippet, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".snippets
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s
+	`, snippetColumns, r.schema, itemAccess(r.schema, 2, 3))
+
+	snippet, err := r.scan(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleViewer)))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed snippet: %w", err)
+	}
+	return snippet, nil
+}
+
+// ListTrashed returns the snippets in the trash that the user owns or can
+// edit through a workspace, most recently deleted first
+func (r *SnippetRepository) ListTrashed(ctx context.Context, userID int) ([]models.Snippet, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".snippets
+		WHERE deleted_at IS NOT NULL AND %s
+		ORDER BY deleted_at DESC
+	`, snippetColumns, r.schema, itemAccess(r.schema, 1, 2))
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, models.RolesAllowing(models.RoleEditor))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trashed snippets: %w", err)
+	}
+	defer rows.Close()
+
+	snippets := []models.Snippet{}
+	for rows.Next() {
+		snippet, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan snippet: %w", err)
+		}
+		snippets = append(snippets, *snippet)
+	}
+
+	return snippets, nil
+}
+
+// Restore takes a snippet the user owns or can edit through a workspace out of
+// the trash and returns it, or nil if there is no such snippet in the trash
+func (r *SnippetRepository) Restore(ctx context.Context, userID, id int) (*models.Snippet, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".snippets SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND %s
+		RETURNING %s
+	`, r.schema, itemAccess(r.schema, 2, 3), snippetColumns)
+
+	snippet, err := r.scan(conn(ctx, r.pool).QueryRow(ctx, query, id, userID, models.RolesAllowing(models.RoleEditor)))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore snippet: %w", err)
+	}
+	return snippet, nil
+}
+
+// Purge deletes the snippets moved to the trash before the given time and
+// returns how many there were
+func (r *SnippetRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM "%s".snippets WHERE deleted_at < $1`, r.schema)
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge snippets: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// scan reads a row of snippetColumns and decrypts its content
+func (r *SnippetRepository) scan(row pgx.Row) (*models.Snippet, error) {
+	var snippet models.Snippet
+	var content sealedContent
+	err := row.Scan(
+		&snippet.ID, &snippet.OwnerID, &snippet.Title, &content.Content, &snippet.SourceURL,
+		&snippet.SourceConversationID, &snippet.Tags, &snippet.Language,
+		&snippet.CollectionID, &snippet.Version, &snippet.CreatedAt, &snippet.DeletedAt,
+		&content.Ciphertext, &content.DataKey, &content.KeyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if snippet.Content, err = content.open(r.keyring); err != nil {
+		return nil, err
+	}
+	return &snippet, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+// StatsRepository aggregates figures over the conversations a user can read
+type StatsRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewStatsRepository(pool *pgxpool.Pool, schema string) *StatsRepository {
+	return &StatsRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+// TokenUsage returns the token counts of the conversations out of the trash
+// that the user owns or can read through a workspace and that match filters,
+// summed by source and month of creation, oldest month first. Conversations
+// whose tokens were never counted are left out.
+func (r *StatsRepository) TokenUsage(ctx context.Context, userID int, filters models.TokenStatsFilters) ([]models.TokenUsage, error) {
+	conditions := []string{"token_count IS NOT NULL", "deleted_at IS NULL", itemAccess(r.schema, 1, 2)}
+	args := []interface{}{userID, models.RolesAllowing(models.RoleViewer)}
+	argPos := 3
+
+	if filters.Source != "" {
+		conditions = append(conditions, fmt.Sprintf("source = $%d", argPos))
+		args = append(args, filters.Source)
+		argPos++
+	}
+
+	if filters.Since != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argPos))
+		args = append(args, *filters.Since)
+		argPos++
+	}
+
+	if filters.Until != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", argPos))
+		args = append(args, *filters.Until)
+		argPos++
+	}
+
+	query := fmt.Sprintf(`
+		WITH counted AS (
+			SELECT source, created_at, token_count,
+			       (SELECT COALESCE(SUM(token_count), 0) FROM "%[1]s".messages
+			        WHERE conversation_id = conv.id AND role <> $%[3]d) AS input_tokens,
+			       (SELECT COALESCE(SUM(token_count), 0) FROM "%[1]s".messages
+			        WHERE conversation_id = conv.id AND role = $%[3]d) AS output_tokens
+			FROM "%[1]s".conversations conv
+			WHERE %[2]s
+		)
+		SELECT source, to_char(date_trunc('month', created_at AT TIME ZONE 'UTC'), 'YYYY-MM') AS month,
+		       COUNT(*), SUM(token_count), SUM(input_tokens)::bigint, SUM(output_tokens)::bigint
+		FROM counted
+		GROUP BY 1, 2
+		ORDER BY 2, 1
+	`, r.schema, strings.Join(conditions, " AND "), argPos)
+	args = append(args, models.MessageRoleAssistant)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum token counts: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []models.TokenUsage{}
+	for rows.Next() {
+		var u models.TokenUsage
+		if err := rows.Scan(&u.Source, &u.Month, &u.Conversations, &u.Tokens, &u.InputTokens, &u.OutputTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan token counts: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// CountUncounted returns the number of conversations out of the trash that the
+// user owns or can read through a workspace and whose tokens were never counted
+func (r *StatsRepository) CountUncounted(ctx context.Context, userID int) (int, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FROM "%s".conversations
+		WHERE token_count IS NULL AND deleted_at IS NULL AND %s
+	`, r.schema, itemAccess(r.schema, 1, 2))
+
+	var count int
+	if err := conn(ctx, r.pool).QueryRow(ctx, query, userID, models.RolesAllowing(models.RoleViewer)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count conversations without token count: %w", err)
+	}
+	return count, nil
+}
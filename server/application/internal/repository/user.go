@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+// ErrUsernameConflict is returned when an external identity would take a username
+// already used by another account
+var ErrUsernameConflict = errors.New("username is already used by another account")
+
+type UserRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewUserRepository(pool *pgxpool.Pool, schema string) *UserRepository {
+	return &UserRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	query := fmt.Sprintf(`
+		SELECT id, username, password_hash, roles, created_at
+		FROM "%s".users
+		WHERE id = $1
+	`, r.schema)
+
+	var user models.User
+	err := r.pool.QueryRow(ctx, query, id).Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Roles, &user.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+	return &user, nil
+}
+
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := fmt.Sprintf(`
+		SELECT id, username, password_hash, roles, created_at
+		FROM "%s".users
+		WHERE username = $1
+	`, r.schema)
+
+	var user models.User
+	err := r.pool.QueryRow(ctx, query, username).Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Roles, &user.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by username: %w", err)
+	}
+	return &user, nil
+}
+
+// GetOrCreate returns the user with the given username, creating it on first use
+func (r *UserRepository) GetOrCreate(ctx context.Context, username string) (*models.User, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".users (username)
+		VALUES ($1)
+		ON CONFLICT (username) DO UPDATE SET username = EXCLUDED.username
+		RETURNING id, username, password_hash, roles, created_at
+	`, r.schema)
+
+	var user models.User
+	err := r.pool.QueryRow(ctx, query, username).Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Roles, &user.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetOrCreateExternal returns the user linked to an identity provider subject,
+// creating it on first sign-in. Roles are replaced on every call so they follow
+// the provider's groups.
+func (r *UserRepository) GetOrCreateExternal(ctx context.Context, issuer, subject, username string, roles []string) (*models.User, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".users (username, oidc_issuer, oidc_subject, roles)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (oidc_issuer, oidc_subject) DO UPDATE SET roles = EXCLUDED.roles
+		RETURNING id, username, password_hash, roles, created_at
+	`, r.schema)
+
+	var user models.User
+	err := r.pool.QueryRow(ctx, query, username, issuer, subject, roles).Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Roles, &user.CreatedAt,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrUsernameConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get or create external user: %w", err)
+	}
+	return &user, nil
+}
+
+// Create inserts a new user. It returns false if the username is already taken.
+func (r *UserRepository) Create(ctx context.Context, user *models.User) (bool, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".users (username, password_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (username) DO NOTHING
+		RETURNING id, roles, created_at
+	`, r.schema)
+
+	err := r.pool.QueryRow(ctx, query, user.Username, user.PasswordHash).Scan(
+		&user.ID, &user.Roles, &user.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create user: %w", err)
+	}
+	return true, nil
+}
+
+func (r *UserRepository) SetPassword(ctx context.Context, id int, passwordHash string) error {
+	query := fmt.Sprintf(`UPDATE "%s".users SET password_hash = $1 WHERE id = $2`, r.schema)
+	_, err := r.pool.Exec(ctx, query, passwordHash, id)
+	if err != nil {
+		return fmt.Errorf("failed to set user password: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+type WorkspaceRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewWorkspaceRepository(pool *pgxpool.Pool, schema string) *WorkspaceRepository {
+	return &WorkspaceRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+// GetByID returns a workspace with the user's role in it, or nil if the user is not a member
+func (r *WorkspaceRepository) GetByID(ctx context.Context, userID, id int) (*models.Workspace, error) {
+	query := fmt.Sprintf(`
+		SELECT w.id, w.name, w.created_by, w.created_at, m.role
+		FROM "%s".workspaces w
+		JOIN "%s".workspace_members m ON m.workspace_id = w.id
+		WHERE w.id = $1 AND m.user_id = $2
+	`, r.schema, r.schema)
+
+	var workspace models.Workspace
+	err := conn(ctx, r.pool).QueryRow(ctx, query, id, userID).Scan(
+		&workspace.ID, &workspace.Name, &workspace.CreatedBy, &workspace.CreatedAt, &workspace.Role,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace by ID: %w", err)
+	}
+	return &workspace, nil
+}
+
+// List returns the workspaces the user is a member of, with their role in each
+func (r *WorkspaceRepository) List(ctx context.Context, userID int) ([]models.Workspace, error) {
+	query := fmt.Sprintf(`
+		SELECT w.id, w.name, w.created_by, w.created_at, m.role
+		FROM "%s".workspaces w
+		JOIN "%s".workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = $1
+		ORDER BY w.name
+	`, r.schema, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaces := []models.Workspace{}
+	for rows.Next() {
+		var workspace models.Workspace
+		err := rows.Scan(&workspace.ID, &workspace.Name, &workspace.CreatedBy, &workspace.CreatedAt, &workspace.Role)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	return workspaces, nil
+}
+
+// Create inserts a workspace created by the user. Its first member is added separately.
+func (r *WorkspaceRepository) Create(ctx context.Context, userID int, workspace *models.Workspace) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".workspaces (name, created_by)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`, r.schema)
+
+	err := conn(ctx, r.pool).QueryRow(ctx, query, workspace.Name, userID).Scan(&workspace.ID, &workspace.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+	workspace.CreatedBy = &userID
+	return nil
+}
+
+func (r *WorkspaceRepository) Update(ctx context.Context, workspace *models.Workspace) error {
+	query := fmt.Sprintf(`UPDATE "%s".workspaces SET name = $1 WHERE id = $2`, r.schema)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, workspace.Name, workspace.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update workspace: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a workspace with its members and invitations.
+// Its collections become private collections of their creators.
+func (r *WorkspaceRepository) Delete(ctx context.Context, id int) error {
+	query := fmt.Sprintf(`DELETE FROM "%s".workspaces WHERE id = $1`, r.schema)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace: %w", err)
+	}
+	return nil
+}
+
+// Lock locks the workspace row until the end of the transaction, so that
+// membership checks and changes do not interleave
+func (r *WorkspaceRepository) Lock(ctx context.Context, id int) error {
+	query := fmt.Sprintf(`SELECT id FROM "%s".workspaces WHERE id = $1 FOR UPDATE`, r.schema)
+	var locked int
+	err := conn(ctx, r.pool).QueryRow(ctx, query, id).Scan(&locked)
+	if err != nil && err != pgx.ErrNoRows {
+		return fmt.Errorf("failed to lock workspace: %w", err)
+	}
+	return nil
+}
+
+// Role returns the user's role in the workspace, or "" if they are not a member
+func (r *WorkspaceRepository) Role(ctx context.Context, workspaceID, userID int) (string, error) {
+	query := fmt.Sprintf(`
+		SELECT role FROM "%s".workspace_members
+		WHERE workspace_id = $1 AND user_id = $2
+	`, r.schema)
+
+	var role string
+	err := conn(ctx, r.pool).QueryRow(ctx, query, workspaceID, userID).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get workspace role: %w", err)
+	}
+	return role, nil
+}
+
+// CollectionRole returns the user's role on a collection: admin for their own
+// private collections, their workspace role for workspace collections, and ""
+// for collections they cannot access, that do not exist or that are in the trash
+func (r *WorkspaceRepository) CollectionRole(ctx context.Context, userID, collectionID int) (string, error) {
+	query := fmt.Sprintf(`
+		SELECT c.user_id, c.workspace_id, m.role
+		FROM "%s".collections c
+		LEFT JOIN "%s".workspace_members m ON m.workspace_id = c.workspace_id AND m.user_id = $2
+		WHERE c.id = $1 AND c.deleted_at IS NULL
+	`, r.schema, r.schema)
+
+	var ownerID int
+	var workspaceID *int
+	var role *string
+	err := conn(ctx, r.pool).QueryRow(ctx, query, collectionID, userID).Scan(&ownerID, &workspaceID, &role)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get collection role: %w", err)
+	}
+
+	switch {
+	case workspaceID == nil && ownerID == userID:
+		return models.RoleAdmin, nil
+	case workspaceID != nil && role != nil:
+		return *role, nil
+	default:
+		return "", nil
+	}
+}
+
+// Members returns the members of a workspace, admins first
+func (r *WorkspaceRepository) Members(ctx context.Context, workspaceID int) ([]models.WorkspaceMember, error) {
+	query := fmt.Sprintf(`
+		SELECT m.workspace_id, m.user_id, u.username, m.role, m.created_at
+		FROM "%s".workspace_members m
+		JOIN "%s".users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1
+		ORDER BY CASE m.role WHEN 'admin' THEN 0 WHEN 'editor' THEN 1 ELSE 2 END, u.username
+	`, r.schema, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.WorkspaceMember{}
+	for rows.Next() {
+		var member models.WorkspaceMember
+		err := rows.Scan(&member.WorkspaceID, &member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// SetMember adds a member to the workspace, or changes their role if they already are one
+func (r *WorkspaceRepository) SetMember(ctx context.Context, workspaceID, userID int, role string) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".workspace_members (workspace_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role
+	`, r.schema)
+
+	_, err := conn(ctx, r.pool).Exec(ctx, query, workspaceID, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to set workspace member: %w", err)
+	}
+	return nil
+}
+
+func (r *WorkspaceRepository) RemoveMember(ctx context.Context, workspaceID, userID int) error {
+	query := fmt.Sprintf(`DELETE FROM "%s".workspace_members WHERE workspace_id = $1 AND user_id = $2`, r.schema)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove workspace member: %w", err)
+	}
+	return nil
+}
+
+// CountAdmins returns the number of admins of the workspace
+func (r *WorkspaceRepository) CountAdmins(ctx context.Context, workspaceID int) (int, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FROM "%s".workspace_members
+		WHERE workspace_id = $1 AND role = $2
+	`, r.schema)
+
+	var count int
+	if err := conn(ctx, r.pool).QueryRow(ctx, query, workspaceID, models.RoleAdmin).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count workspace admins: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+)
+
+// invitationColumns are the columns read by scanInvitation, in order
+const invitationColumns = `id, workspace_id, role, prefix, token_hash, created_by, created_at,
+		       expires_at, accepted_by, accepted_at, revoked_at`
+
+type WorkspaceInvitationRepository struct {
+	pool   *pgxpool.Pool
+	schema string
+}
+
+func NewWorkspaceInvitationRepository(pool *pgxpool.Pool, schema string) *WorkspaceInvitationRepository {
+	return &WorkspaceInvitationRepository{
+		pool:   pool,
+		schema: schema,
+	}
+}
+
+// GetByTokenHash looks up an invitation by its token hash, for redemption by any user
+func (r *WorkspaceInvitationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*models.WorkspaceInvitation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".workspace_invitations
+		WHERE token_hash = $1
+	`, invitationColumns, r.schema)
+
+	invitation, err := scanInvitation(conn(ctx, r.pool).QueryRow(ctx, query, tokenHash))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation by token: %w", err)
+	}
+	return invitation, nil
+}
+
+// List returns the invitations of a workspace, newest first
+func (r *WorkspaceInvitationRepository) List(ctx context.Context, workspaceID int) ([]models.WorkspaceInvitation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM "%s".workspace_invitations
+		WHERE workspace_id = $1
+		ORDER BY created_at DESC
+	`, invitationColumns, r.schema)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []models.WorkspaceInvitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	return invitations, nil
+}
+
+func (r *WorkspaceInvitationRepository) Create(ctx context.Context, userID int, invitation *models.WorkspaceInvitation) error {
+	query := fmt.Sprintf(`
+		INSERT INTO "%s".workspace_invitations
+		(workspace_id, role, prefix, token_hash, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, r.schema)
+
+	err := conn(ctx, r.pool).QueryRow(ctx, query,
+		invitation.WorkspaceID, invitation.Role, invitation.Prefix, invitation.TokenHash,
+		userID, invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+	invitation.CreatedBy = &userID
+	return nil
+}
+
+// Accept marks a pending invitation as redeemed by the user. It returns false
+// if the invitation was redeemed or revoked meanwhile.
+func (r *WorkspaceInvitationRepository) Accept(ctx context.Context, id, userID int) (bool, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".workspace_invitations
+		SET accepted_by = $2, accepted_at = NOW()
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL
+	`, r.schema)
+
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Revoke marks a pending invitation of the workspace as revoked. It returns
+// false if there is no such pending invitation.
+func (r *WorkspaceInvitationRepository) Revoke(ctx context.Context, workspaceID, id int) (bool, error) {
+	query := fmt.Sprintf(`
+		UPDATE "%s".workspace_invitations
+		SET revoked_at = NOW()
+		WHERE id = $1 AND workspace_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+	`, r.schema)
+
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, id, workspaceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func scanInvitation(row pgx.Row) (*models.WorkspaceInvitation, error) {
+	var invitation models.WorkspaceInvitation
+	err := row.Scan(
+		&invitation.ID, &invitation.WorkspaceID, &invitation.Role, &invitation.Prefix,
+		&invitation.TokenHash, &invitation.CreatedBy, &invitation.CreatedAt, &invitation.ExpiresAt,
+		&invitation.AcceptedBy, &invitation.AcceptedAt, &invitation.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
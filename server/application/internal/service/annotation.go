@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/textanchor"
+)
+
+const (
+	defaultAnnotationPageSize = 50
+	maxAnnotationPageSize     = 200
+)
+
+var (
+	// ErrInvalidAnnotation is returned for an annotation of an unknown color
+	ErrInvalidAnnotation = errors.New("unknown annotation color")
+	// ErrInvalidAnchor is returned when an annotation's range is not in the
+	// content, or its quote is neither at its range nor anywhere else
+	ErrInvalidAnchor = errors.New("the range or quote is not in the conversation content")
+)
+
+// AnnotationService manages highlights of conversations. Annotations are
+// private to the user who made them, who needs to be able to read the
+// conversation. They follow the content when it changes (see reanchorAnnotations).
+type AnnotationService struct {
+	pool          *pgxpool.Pool
+	repo          *repository.AnnotationRepository
+	conversations *repository.ConversationRepository
+	audit         *AuditService
+}
+
+func NewAnnotationService(
+	pool *pgxpool.Pool,
+	repo *repository.AnnotationRepository,
+	conversations *repository.ConversationRepository,
+	audit *AuditService,
+) *AnnotationService {
+	return &AnnotationService{
+		pool:          pool,
+		repo:          repo,
+		conversations: conversations,
+		audit:         audit,
+	}
+}
+
+// ListByConversation returns the user's annotations of a conversation in the
+// order of its content, or ErrNotFound if they cannot read it
+func (s *AnnotationService) ListByConversation(ctx context.Context, userID, conversationID int) ([]models.Annotation, error) {
+	if _, err := s.conversation(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByConversation(ctx, userID, conversationID)
+}
+
+// List returns a page of the user's annotations across the conversations
+// they can read, newest first
+func (s *AnnotationService) List(ctx context.Context, userID int, filters models.AnnotationFilters) (*models.AnnotationPage, error) {
+	if filters.Limit <= 0 {
+		filters.Limit = defaultAnnotationPageSize
+	}
+	if filters.Limit > maxAnnotationPageSize {
+		filters.Limit = maxAnnotationPageSize
+	}
+	if filters.Offset < 0 {
+		filters.Offset = 0
+	}
+
+	// Fetch one extra row to know whether another page follows
+	limit := filters.Limit
+	filters.Limit++
+	annotations, err := s.repo.List(ctx, userID, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.AnnotationPage{Annotations: annotations, Limit: limit, Offset: filters.Offset}
+	if len(annotations) > limit {
+		page.Annotations = annotations[:limit]
+		page.HasMore = true
+	}
+	return page, nil
+}
+
+// Get returns an annotation the user made, or ErrNotFound
+func (s *AnnotationService) Get(ctx context.Context, userID, id int) (*models.Annotation, error) {
+	annotation, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if annotation == nil {
+		return nil, ErrNotFound
+	}
+	return annotation, nil
+}
+
+// Create highlights a range of a conversation the user can read. A request
+// with a quote that is not at the given range is anchored at the occurrence
+// of the quote nearest to it, as when the client's copy of the content is
+// out of date.
+func (s *AnnotationService) Create(ctx context.Context, actor models.Actor, conversationID int, req *models.CreateAnnotationRequest) (*models.Annotation, error) {
+	if req.Color == "" {
+		req.Color = models.AnnotationYellow
+	}
+	if !models.IsValidAnnotationColor(req.Color) {
+		return nil, ErrInvalidAnnotation
+	}
+
+	var annotation *models.Annotation
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		conv, err := s.conversation(ctx, actor.UserID, conversationID)
+		if err != nil {
+			return err
+		}
+
+		anchor, ok := textanchor.New(conv.Content, req.StartOffset, req.EndOffset)
+		if req.Quote != "" && (!ok || anchor.Quote != req.Quote) {
+			anchor, ok = textanchor.Find(conv.Content, req.Quote, req.StartOffset)
+		}
+		if !ok {
+			return ErrInvalidAnchor
+		}
+
+		annotation = &models.Annotation{
+			UserID:         actor.UserID,
+			ConversationID: conversationID,
+			Color:          req.Color,
+			Note:           req.Note,
+			Tags:           normalizeTags(req.Tags),
+		}
+		setAnchor(annotation, anchor)
+		if err := s.repo.Create(ctx, annotation); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, annotation.UserID, models.AuditActionCreate, models.EntityAnnotation, *annotation.ID, nil, annotation)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// Update replaces the note and tags of an annotation the user made, and its
+// color unless the request has none
+func (s *AnnotationService) Update(ctx context.Context, actor models.Actor, id int, req *models.UpdateAnnotationRequest) (*models.Annotation, error) {
+	if req.Color != "" && !models.IsValidAnnotationColor(req.Color) {
+		return nil, ErrInvalidAnnotation
+	}
+
+	var annotation *models.Annotation
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.Get(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+
+		next := *existing
+		if req.Color != "" {
+			next.Color = req.Color
+		}
+		next.Note = req.Note
+		next.Tags = normalizeTags(req.Tags)
+		if err := s.repo.Update(ctx, &next); err != nil {
+			return err
+		}
+		annotation = &next
+		return s.audit.Record(ctx, actor, existing.UserID, models.AuditActionUpdate, models.EntityAnnotation, id, existing, annotation)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// Delete removes an annotation the user made
+func (s *AnnotationService) Delete(ctx context.Context, actor models.Actor, id int) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.Get(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, existing.UserID, models.AuditActionDelete, models.EntityAnnotation, id, existing, nil)
+	})
+}
+
+// conversation returns a conversation the user can read, or ErrNotFound
+func (s *AnnotationService) conversation(ctx context.Context, userID, id int) (*models.Conversation, error) {
+	conv, err := s.conversations.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, ErrNotFound
+	}
+	return conv, nil
+}
+
+// reanchorAnnotations finds the annotations of a saved conversation again in
+// its new content. Annotations whose quote is gone are marked orphaned and
+// keep their offsets; they are anchored again if the quote comes back.
+func reanchorAnnotations(ctx context.Context, repo *repository.AnnotationRepository, conv *models.Conversation) error {
+	annotations, err := repo.ListAllByConversation(ctx, *conv.ID)
+	if err != nil {
+		return err
+	}
+	for i := range annotations {
+		annotation := &annotations[i]
+		anchor, ok := textanchor.Locate(conv.Content, textanchor.Anchor{
+			Start:  annotation.StartOffset,
+			End:    annotation.EndOffset,
+			Quote:  annotation.Quote,
+			Prefix: annotation.Prefix,
+			Suffix: annotation.Suffix,
+		})
+		if !ok {
+			if annotation.Orphaned {
+				continue
+			}
+			annotation.Orphaned = true
+		} else {
+			if !annotation.Orphaned && annotation.StartOffset == anchor.Start && annotation.EndOffset == anchor.End &&
+				annotation.Prefix == anchor.Prefix && annotation.Suffix == anchor.Suffix {
+				continue
+			}
+			setAnchor(annotation, anchor)
+		}
+		if err := repo.SetAnchor(ctx, annotation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setAnchor places an annotation at an anchor found in the content
+func setAnchor(annotation *models.Annotation, anchor textanchor.Anchor) {
+	annotation.StartOffset = anchor.Start
+	annotation.EndOffset = anchor.End
+	annotation.Quote = anchor.Quote
+	annotation.Prefix = anchor.Prefix
+	annotation.Suffix = anchor.Suffix
+	annotation.Orphaned = false
+}
+
+// normalizeTags returns tags, or an empty list for none
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
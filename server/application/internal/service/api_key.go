@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
+)
+
+type APIKeyService struct {
+	repo *repository.APIKeyRepository
+}
+
+func NewAPIKeyService(repo *repository.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{repo: repo}
+}
+
+func (s *APIKeyService) List(ctx context.Context, userID int) ([]models.APIKey, error) {
+	return s.repo.List(ctx, userID)
+}
+
+// Create generates a new key. The clear-text key is only returned here.
+func (s *APIKeyService) Create(ctx context.Context, userID int, req *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	// Validate required fields
+	if req.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidScope(scope) {
+			return nil, fmt.Errorf("unknown scope: %s", scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := models.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashAPIKey(key),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.repo.Create(ctx, userID, &apiKey); err != nil {
+		return nil, err
+	}
+
+	return &models.CreateAPIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id int) (bool, error) {
+	return s.repo.Revoke(ctx, userID, id)
+}
@@ -0,0 +1,513 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/blobstore"
+)
+
+// defaultAttachmentContentType is the type of files uploaded without one
+const defaultAttachmentContentType = "application/octet-stream"
+
+// blobGracePeriod is how long an unreferenced blob is kept, so that a blob
+// stored by an upload whose attachment row is not yet committed survives
+const blobGracePeriod = time.Hour
+
+var (
+	// ErrAttachmentTooLarge is returned when a file exceeds the maximum
+	// attachment size, or an upload part goes past the announced size
+	ErrAttachmentTooLarge = blobstore.ErrTooLarge
+	// ErrUploadOffset is returned when an upload part does not start where
+	// the upload stopped
+	ErrUploadOffset = blobstore.ErrOffsetMismatch
+	// ErrInvalidAttachment is returned when an attachment has no file name or
+	// an invalid size
+	ErrInvalidAttachment = errors.New("an attachment needs a filename and a positive size")
+	// ErrNoSuchMessage is returned when attaching a file to a message the
+	// conversation does not have
+	ErrNoSuchMessage = errors.New("the conversation has no message with this ordinal")
+	// ErrAttachmentChecksum is returned when the content of a backed up
+	// attachment does not match its SHA-256
+	ErrAttachmentChecksum = errors.New("attachment content does not match its sha256")
+)
+
+// AttachmentService stores the images and files of conversations. Their
+// content goes to the blob store, their metadata to the database. Whoever can
+// read a conversation can read its attachments; whoever can change it can add
+// and delete them.
+type AttachmentService struct {
+	pool          *pgxpool.Pool
+	repo          *repository.AttachmentRepository
+	conversations *repository.ConversationRepository
+	messages      *repository.MessageRepository
+	workspaces    *WorkspaceService
+	audit         *AuditService
+	store         *blobstore.Store
+	maxSize       int64
+	uploadTTL     time.Duration
+}
+
+func NewAttachmentService(
+	pool *pgxpool.Pool,
+	repo *repository.AttachmentRepository,
+	conversations *repository.ConversationRepository,
+	messages *repository.MessageRepository,
+	workspaces *WorkspaceService,
+	audit *AuditService,
+	store *blobstore.Store,
+	maxSize int64,
+	uploadTTL time.Duration,
+) *AttachmentService {
+	return &AttachmentService{
+		pool:          pool,
+		repo:          repo,
+		conversations: conversations,
+		messages:      messages,
+		workspaces:    workspaces,
+		audit:         audit,
+		store:         store,
+		maxSize:       maxSize,
+		uploadTTL:     uploadTTL,
+	}
+}
+
+// List returns the attachments of a conversation the user can read
+func (s *AttachmentService) List(ctx context.Context, userID, conversationID int) ([]models.Attachment, error) {
+	if _, err := s.readableConversation(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByConversation(ctx, conversationID)
+}
+
+// Get returns an attachment of a conversation the user can read, or ErrNotFound
+func (s *AttachmentService) Get(ctx context.Context, userID, id int) (*models.Attachment, error) {
+	attachment, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if attachment == nil {
+		return nil, ErrNotFound
+	}
+	if _, err := s.readableConversation(ctx, userID, attachment.ConversationID); err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// Open returns an attachment the user can read and its content, which the
+// caller must close
+func (s *AttachmentService) Open(ctx context.Context, userID, id int) (*models.Attachment, *os.File, error) {
+	attachment, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := s.store.Open(attachment.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, f, nil
+}
+
+// Upload attaches the content of r to a conversation the user can change.
+// req.Size is ignored; the file may not exceed the maximum attachment size.
+func (s *AttachmentService) Upload(ctx context.Context, actor models.Actor, conversationID int, req *models.CreateAttachmentUploadRequest, r io.Reader) (*models.Attachment, error) {
+	if err := s.checkRequest(ctx, actor.UserID, conversationID, req, false); err != nil {
+		return nil, err
+	}
+
+	hash, size, err := s.store.Put(r, s.maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &models.Attachment{
+		UserID:         actor.UserID,
+		ConversationID: conversationID,
+		MessageOrdinal: req.MessageOrdinal,
+		Filename:       req.Filename,
+		ContentType:    req.ContentType,
+		Size:           size,
+		SHA256:         hash,
+		SourceURL:      req.SourceURL,
+	}
+	err = repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		return s.create(ctx, actor, attachment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// CreateUpload starts the upload in parts of a file of req.Size bytes to a
+// conversation the user can change. The upload expires if it is not complete
+// within the upload TTL.
+func (s *AttachmentService) CreateUpload(ctx context.Context, actor models.Actor, conversationID int, req *models.CreateAttachmentUploadRequest) (*models.AttachmentUpload, error) {
+	if err := s.checkRequest(ctx, actor.UserID, conversationID, req, true); err != nil {
+		return nil, err
+	}
+
+	upload := &models.AttachmentUpload{
+		UserID:         actor.UserID,
+		ConversationID: conversationID,
+		MessageOrdinal: req.MessageOrdinal,
+		Filename:       req.Filename,
+		ContentType:    req.ContentType,
+		Size:           req.Size,
+		SourceURL:      req.SourceURL,
+		ExpiresAt:      time.Now().Add(s.uploadTTL),
+	}
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		if err := s.repo.CreateUpload(ctx, upload); err != nil {
+			return err
+		}
+		return s.store.CreatePart(*upload.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetUpload returns an unexpired upload the user started, or ErrNotFound
+func (s *AttachmentService) GetUpload(ctx context.Context, userID, id int) (*models.AttachmentUpload, error) {
+	upload, err := s.repo.GetUpload(ctx, userID, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if upload == nil {
+		return nil, ErrNotFound
+	}
+	return upload, nil
+}
+
+// AppendUpload adds the part read from r to an upload the user started. The
+// part must start at offset, the number of bytes received so far, or
+// ErrUploadOffset is returned. A part sent again after a lost response is
+// rejected the same way, and the client resumes from the offset of the
+// upload. With the last part, the upload becomes an attachment.
+func (s *AttachmentService) AppendUpload(ctx context.Context, actor models.Actor, id int, offset int64, r io.Reader) (*models.AttachmentUploadResponse, error) {
+	var response *models.AttachmentUploadResponse
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		upload, err := s.repo.GetUpload(ctx, actor.UserID, id, true)
+		if err != nil {
+			return err
+		}
+		if upload == nil {
+			return ErrNotFound
+		}
+		if offset != upload.Received {
+			return ErrUploadOffset
+		}
+
+		received, err := s.store.AppendPart(id, offset, upload.Size, r)
+		if err != nil {
+			return err
+		}
+		upload.Received = received
+		if err := s.repo.SetUploadReceived(ctx, id, received); err != nil {
+			return err
+		}
+		response = &models.AttachmentUploadResponse{Upload: *upload}
+		if received < upload.Size {
+			return nil
+		}
+
+		// Complete: the conversation may have been deleted or unshared meanwhile
+		if _, err := s.writableConversation(ctx, actor.UserID, upload.ConversationID); err != nil {
+			return err
+		}
+		hash, err := s.store.CommitPart(id)
+		if err != nil {
+			return err
+		}
+		attachment := &models.Attachment{
+			UserID:         actor.UserID,
+			ConversationID: upload.ConversationID,
+			MessageOrdinal: upload.MessageOrdinal,
+			Filename:       upload.Filename,
+			ContentType:    upload.ContentType,
+			Size:           upload.Size,
+			SHA256:         hash,
+			SourceURL:      upload.SourceURL,
+		}
+		if err := s.create(ctx, actor, attachment); err != nil {
+			return err
+		}
+		response.Attachment = attachment
+		return s.repo.DeleteUpload(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// CancelUpload drops an upload the user started
+func (s *AttachmentService) CancelUpload(ctx context.Context, userID, id int) error {
+	upload, err := s.repo.GetUpload(ctx, userID, id, false)
+	if err != nil {
+		return err
+	}
+	if upload == nil {
+		return ErrNotFound
+	}
+	if err := s.repo.DeleteUpload(ctx, id); err != nil {
+		return err
+	}
+	return s.store.RemovePart(id)
+}
+
+// Delete removes an attachment of a conversation the user can change. Its
+// content is left to PurgeBlobs, as a concurrent upload of the same content
+// may be about to refer to it.
+func (s *AttachmentService) Delete(ctx context.Context, actor models.Actor, id int) error {
+	attachment, err := s.Get(ctx, actor.UserID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.writableConversation(ctx, actor.UserID, attachment.ConversationID); err != nil {
+		return err
+	}
+
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, attachment.UserID, models.AuditActionDelete, models.EntityAttachment, id, attachment, nil)
+	})
+}
+
+// PurgeBlobs drops expired uploads, uploads whose conversation is gone, and
+// the blobs no attachment refers to, such as those of purged conversations.
+// It returns the number of blobs removed.
+func (s *AttachmentService) PurgeBlobs(ctx context.Context) (int, error) {
+	expired, err := s.repo.DeleteExpiredUploads(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range expired {
+		if err := s.store.RemovePart(id); err != nil {
+			return 0, err
+		}
+	}
+
+	uploads, err := s.repo.UploadIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	parts, err := s.store.Parts()
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range parts {
+		if !uploads[id] {
+			if err := s.store.RemovePart(id); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	hashes, err := s.store.Hashes(time.Now().Add(-blobGracePeriod))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, hash := range hashes {
+		referenced, err := s.repo.IsReferenced(ctx, hash)
+		if err != nil {
+			return removed, err
+		}
+		if referenced {
+			continue
+		}
+		if err := s.store.Remove(hash); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// ExportBackup returns the attachments of the conversations the user owns with
+// their content, for a backup, as the JSON {"attachments": [...]}. Contents are
+// read from the blob store one at a time as the JSON is read, rather than held
+// in memory; closing the reader stops the export.
+func (s *AttachmentService) ExportBackup(ctx context.Context, userID int) (io.ReadCloser, error) {
+	attachments, err := s.repo.ListForBackup(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(s.writeBackup(w, attachments))
+	}()
+	return r, nil
+}
+
+// writeBackup writes attachments to w as the JSON of ExportBackup, each with
+// its content base64-encoded in data
+func (s *AttachmentService) writeBackup(w io.Writer, attachments []models.BackupAttachment) error {
+	buf := bufio.NewWriter(w)
+	buf.WriteString(`{"attachments":[`)
+	for i, attachment := range attachments {
+		// Data is empty, and left out: it is written first, from the blob store
+		fields, err := json.Marshal(attachment)
+		if err != nil {
+			return fmt.Errorf("failed to marshal attachment: %w", err)
+		}
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(`{"data":"`)
+		if err := s.writeContent(buf, attachment.SHA256); err != nil {
+			return err
+		}
+		buf.WriteString(`",`)
+		buf.Write(fields[1:])
+	}
+	buf.WriteString("]}")
+	return buf.Flush()
+}
+
+// writeContent writes the content with the given hash to w, base64-encoded
+func (s *AttachmentService) writeContent(w io.Writer, hash string) error {
+	f, err := s.store.Open(hash)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := base64.NewEncoder(base64.StdEncoding, w)
+	if _, err := io.Copy(enc, f); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// importBackup restores a backed up attachment of a conversation, with the
+// content read from r. An attachment with the same content and file name
+// already there is kept, and reported as updated.
+func (s *AttachmentService) importBackup(ctx context.Context, actor models.Actor, conv *models.Conversation, item *models.BackupAttachment, r io.Reader) (bool, error) {
+	if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, conv.OwnerID, conv.CollectionID); err != nil {
+		return false, err
+	}
+
+	hash, size, err := s.store.Put(r, s.maxSize)
+	if err != nil {
+		return false, err
+	}
+	if item.SHA256 != "" && item.SHA256 != hash {
+		return false, ErrAttachmentChecksum
+	}
+
+	existing, err := s.repo.ListByConversation(ctx, *conv.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, attachment := range existing {
+		if attachment.SHA256 == hash && attachment.Filename == item.Filename {
+			return true, nil
+		}
+	}
+
+	req := &models.CreateAttachmentUploadRequest{Filename: item.Filename, ContentType: item.ContentType}
+	if err := s.checkRequest(ctx, actor.UserID, *conv.ID, req, false); err != nil {
+		return false, err
+	}
+	attachment := &models.Attachment{
+		UserID:         actor.UserID,
+		ConversationID: *conv.ID,
+		MessageOrdinal: item.MessageOrdinal,
+		Filename:       req.Filename,
+		ContentType:    req.ContentType,
+		Size:           size,
+		SHA256:         hash,
+		SourceURL:      item.SourceURL,
+		CreatedAt:      item.CreatedAt,
+	}
+	return false, repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		return s.create(ctx, actor, attachment)
+	})
+}
+
+// create inserts an attachment and records its creation
+func (s *AttachmentService) create(ctx context.Context, actor models.Actor, attachment *models.Attachment) error {
+	if err := s.repo.Create(ctx, attachment); err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, actor, attachment.UserID, models.AuditActionCreate, models.EntityAttachment, *attachment.ID, nil, attachment)
+}
+
+// checkRequest normalizes the file name and content type of req and checks
+// that the user may attach it to the conversation. withSize requires the
+// announced size to be positive and within the maximum attachment size.
+func (s *AttachmentService) checkRequest(ctx context.Context, userID, conversationID int, req *models.CreateAttachmentUploadRequest, withSize bool) error {
+	req.Filename = strings.TrimSpace(filepath.Base(filepath.Clean("/" + req.Filename)))
+	if req.Filename == "" || req.Filename == "/" || req.Filename == "." {
+		return ErrInvalidAttachment
+	}
+	req.ContentType = strings.TrimSpace(req.ContentType)
+	if req.ContentType == "" {
+		req.ContentType = defaultAttachmentContentType
+	}
+	if withSize {
+		if req.Size <= 0 {
+			return ErrInvalidAttachment
+		}
+		if req.Size > s.maxSize {
+			return ErrAttachmentTooLarge
+		}
+	}
+
+	if _, err := s.writableConversation(ctx, userID, conversationID); err != nil {
+		return err
+	}
+	if req.MessageOrdinal != nil {
+		count, err := s.messages.Count(ctx, conversationID)
+		if err != nil {
+			return err
+		}
+		if *req.MessageOrdinal < 1 || *req.MessageOrdinal > count {
+			return ErrNoSuchMessage
+		}
+	}
+	return nil
+}
+
+// readableConversation returns a conversation the user can read, or ErrNotFound
+func (s *AttachmentService) readableConversation(ctx context.Context, userID, id int) (*models.Conversation, error) {
+	conv, err := s.conversations.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, ErrNotFound
+	}
+	return conv, nil
+}
+
+// writableConversation returns a conversation the user can change, ErrNotFound
+// if they cannot see it, or ErrForbidden if they can only read it
+func (s *AttachmentService) writableConversation(ctx context.Context, userID, id int) (*models.Conversation, error) {
+	conv, err := s.readableConversation(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.workspaces.AuthorizeItemWrite(ctx, userID, conv.OwnerID, conv.CollectionID); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// auditIgnoredFields change on every write and are left out of diffs
+var auditIgnoredFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// auditRedactedFields are secrets, or content that may be encrypted at rest;
+// only the fact that they changed is recorded
+var auditRedactedFields = map[string]bool{
+	"api_key": true,
+	"content": true,
+	// Annotation anchors copy conversation content
+	"quote":  true,
+	"prefix": true,
+	"suffix": true,
+}
+
+const redactedValue = "[redacted]"
+
+type AuditService struct {
+	repo *repository.AuditRepository
+}
+
+func NewAuditService(repo *repository.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+func (s *AuditService) List(ctx context.Context, userID int, filters models.AuditFilters) (*models.AuditEventPage, error) {
+	if filters.Limit <= 0 {
+		filters.Limit = defaultAuditPageSize
+	}
+	if filters.Limit > maxAuditPageSize {
+		filters.Limit = maxAuditPageSize
+	}
+	if filters.Offset < 0 {
+		filters.Offset = 0
+	}
+
+	// Fetch one extra row to know whether another page follows
+	limit := filters.Limit
+	filters.Limit++
+	events, err := s.repo.List(ctx, userID, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.AuditEventPage{Events: events, Limit: limit, Offset: filters.Offset}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.HasMore = true
+	}
+	return page, nil
+}
+
+// Record writes an audit event for a mutation performed by actor on data owned
+// by ownerID, which differs from the actor when a workspace member changes
+// another member's items. before is nil for creations and after is nil for
+// deletions. Call it with the context of the mutation's transaction so both
+// commit or roll back together.
+func (s *AuditService) Record(ctx context.Context, actor models.Actor, ownerID int, action, entityType string, entityID int, before, after interface{}) error {
+	changes, err := auditChanges(before, after)
+	if err != nil {
+		return err
+	}
+
+	event := &models.AuditEvent{
+		UserID:     ownerID,
+		ActorID:    &actor.UserID,
+		APIKeyID:   actor.APIKeyID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    changes,
+	}
+	if actor.IP != "" {
+		event.IP = &actor.IP
+	}
+	return s.repo.Create(ctx, event)
+}
+
+// auditChanges compares the JSON representations of before and after
+// and returns the fields that differ
+func auditChanges(before, after interface{}) (map[string]models.AuditChange, error) {
+	oldFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.AuditChange)
+	for name := range mergeKeys(oldFields, newFields) {
+		if auditIgnoredFields[name] {
+			continue
+		}
+		oldValue, newValue := oldFields[name], newFields[name]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if auditRedactedFields[name] {
+			oldValue, newValue = redact(oldValue), redact(newValue)
+		}
+		changes[name] = models.AuditChange{Old: oldValue, New: newValue}
+	}
+	return changes, nil
+}
+
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audited entity: %w", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal audited entity: %w", err)
+	}
+	return fields, nil
+}
+
+func mergeKeys(a, b map[string]interface{}) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return redactedValue
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
+)
+
+var (
+	// ErrInvalidCredentials is returned for an unknown username or a wrong password
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidRefreshToken is returned for unknown, expired, reused or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrUsernameTaken is returned when registering an existing username
+	ErrUsernameTaken = errors.New("username is already taken")
+)
+
+// dummyPasswordHash is compared against when the user does not exist,
+// so unknown usernames take as long to reject as wrong passwords
+var dummyPasswordHash, _ = auth.HashPassword("dummy-password")
+
+// AuthConfig holds token issuance settings
+type AuthConfig struct {
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	SessionTTL      time.Duration
+}
+
+type AuthService struct {
+	users    *repository.UserRepository
+	sessions *repository.AuthSessionRepository
+	config   AuthConfig
+}
+
+func NewAuthService(users *repository.UserRepository, sessions *repository.AuthSessionRepository, config AuthConfig) *AuthService {
+	return &AuthService{
+		users:    users,
+		sessions: sessions,
+		config:   config,
+	}
+}
+
+func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest) (*models.User, error) {
+	// Validate required fields
+	if req.Username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+	if req.Username == models.DefaultUsername {
+		return nil, ErrUsernameTaken
+	}
+	if len(req.Password) < auth.MinPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", auth.MinPasswordLength)
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{Username: req.Username, PasswordHash: &hash}
+	created, err := s.users.Create(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrUsernameTaken
+	}
+	return user, nil
+}
+
+// Login checks credentials and opens a new token session
+func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest) (*models.TokenResponse, error) {
+	user, scopes, err := s.checkLogin(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.AuthSession{
+		UserID:    user.ID,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(s.config.RefreshTokenTTL),
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(ctx, user, session)
+}
+
+// LoginCookie checks credentials and opens a browser session authenticated by cookie
+func (s *AuthService) LoginCookie(ctx context.Context, req *models.LoginRequest) (*models.CookieSession, error) {
+	user, scopes, err := s.checkLogin(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := auth.GenerateSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	csrfToken, err := auth.GenerateCSRFToken()
+	if err != nil {
+		return nil, err
+	}
+
+	cookieHash := auth.HashToken(token)
+	csrfHash := auth.HashToken(csrfToken)
+	session := &models.AuthSession{
+		UserID:     user.ID,
+		Scopes:     scopes,
+		CookieHash: &cookieHash,
+		CSRFHash:   &csrfHash,
+		ExpiresAt:  time.Now().Add(s.config.SessionTTL),
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return &models.CookieSession{
+		Token:     token,
+		CSRFToken: csrfToken,
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// LogoutCookie revokes the browser session identified by its cookie value
+func (s *AuthService) LogoutCookie(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	session, err := s.sessions.GetByCookieHash(ctx, auth.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return nil
+	}
+	return s.sessions.Revoke(ctx, session.ID)
+}
+
+// Refresh consumes a refresh token and rotates it. Presenting a token that was
+// already used revokes the whole session, since it indicates the token leaked.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*models.TokenResponse, error) {
+	token, session, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.UsedAt != nil {
+		if err := s.sessions.Revoke(ctx, session.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if !time.Now().Before(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	consumed, err := s.sessions.MarkRefreshTokenUsed(ctx, token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		if err := s.sessions.Revoke(ctx, session.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.users.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(ctx, user, session)
+}
+
+// Logout revokes the session the refresh token belongs to
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	_, session, err := s.lookupRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	return s.sessions.Revoke(ctx, session.ID)
+}
+
+// ChangePassword sets the caller's password and revokes all their sessions.
+// The current password is required when one is already set.
+func (s *AuthService) ChangePassword(ctx context.Context, userID int, req *models.ChangePasswordRequest) error {
+	if len(req.NewPassword) < auth.MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", auth.MinPasswordLength)
+	}
+
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrInvalidCredentials
+	}
+	if user.PasswordHash != nil && !auth.CheckPassword(*user.PasswordHash, req.CurrentPassword) {
+		return ErrInvalidCredentials
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.users.SetPassword(ctx, userID, hash); err != nil {
+		return err
+	}
+	return s.sessions.RevokeAllForUser(ctx, userID)
+}
+
+// checkLogin validates the requested scopes and the user's credentials
+func (s *AuthService) checkLogin(ctx context.Context, req *models.LoginRequest) (*models.User, []string, error) {
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{models.ScopeAdmin}
+	}
+	for _, scope := range scopes {
+		if !models.IsValidScope(scope) {
+			return nil, nil, fmt.Errorf("unknown scope: %s", scope)
+		}
+	}
+
+	user, err := s.users.GetByUsername(ctx, req.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || user.PasswordHash == nil {
+		auth.CheckPassword(dummyPasswordHash, req.Password)
+		return nil, nil, ErrInvalidCredentials
+	}
+	if !auth.CheckPassword(*user.PasswordHash, req.Password) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	return user, scopes, nil
+}
+
+// lookupRefreshToken resolves a refresh token and its session, which must be active
+func (s *AuthService) lookupRefreshToken(ctx context.Context, refreshToken string) (*models.RefreshToken, *models.AuthSession, error) {
+	if refreshToken == "" {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	token, err := s.sessions.GetRefreshToken(ctx, auth.HashToken(refreshToken))
+	if err != nil {
+		return nil, nil, err
+	}
+	if token == nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessions.GetByID(ctx, token.SessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session == nil || !session.IsActive(time.Now()) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	return token, session, nil
+}
+
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, session *models.AuthSession) (*models.TokenResponse, error) {
+	accessToken, err := auth.IssueAccessToken(
+		s.config.JWTSecret, user.Username, session.Scopes, session.ID, s.config.AccessTokenTTL,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	// A refresh token never outlives its session
+	if err := s.sessions.CreateRefreshToken(ctx, session.ID, auth.HashToken(refreshToken), session.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.config.AccessTokenTTL.Seconds()),
+	}, nil
+}
@@ -1,116 +1,290 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/sources"
 )
 
 type BackupService struct {
 	pool              *pgxpool.Pool
 	conversationRepo  *repository.ConversationRepository
+	messageRepo       *repository.MessageRepository
+	versionRepo       *repository.ConversationVersionRepository
 	snippetRepo       *repository.SnippetRepository
+	annotationRepo    *repository.AnnotationRepository
 	collectionRepo    *repository.CollectionRepository
 	settingsRepo      *repository.SettingsRepository
+	attachments       *AttachmentService
+	relations         *RelationService
+	audit             *AuditService
+	workspaces        *WorkspaceService
 }
 
 func NewBackupService(
 	pool *pgxpool.Pool,
 	conversationRepo *repository.ConversationRepository,
+	messageRepo *repository.MessageRepository,
+	versionRepo *repository.ConversationVersionRepository,
 	snippetRepo *repository.SnippetRepository,
+	annotationRepo *repository.AnnotationRepository,
 	collectionRepo *repository.CollectionRepository,
 	settingsRepo *repository.SettingsRepository,
+	attachments *AttachmentService,
+	relations *RelationService,
+	audit *AuditService,
+	workspaces *WorkspaceService,
 ) *BackupService {
 	return &BackupService{
 		pool:             pool,
 		conversationRepo: conversationRepo,
+		messageRepo:      messageRepo,
+		versionRepo:      versionRepo,
 		snippetRepo:      snippetRepo,
+		annotationRepo:   annotationRepo,
 		collectionRepo:   collectionRepo,
 		settingsRepo:     settingsRepo,
+		attachments:      attachments,
+		relations:        relations,
+		audit:            audit,
+		workspaces:       workspaces,
 	}
 }
 
-func (s *BackupService) Import(ctx context.Context, backup *models.BackupImportRequest) (*models.BackupImportResponse, error) {
+// Import applies a backup item by item. Each item is written together with its
+// audit event in its own transaction, so a failing item does not undo the others.
+func (s *BackupService) Import(ctx context.Context, actor models.Actor, backup *models.BackupImportRequest) (*models.BackupImportResponse, error) {
 	response := &models.BackupImportResponse{}
+	userID := actor.UserID
 
 	// Import conversations
 	for _, conv := range backup.Conversations {
-		existing, err := s.conversationRepo.GetByCanonicalURL(ctx, conv.CanonicalURL)
-		if err != nil {
-			response.Errors++
-			continue
-		}
-
-		if existing != nil {
-			// Update existing - preserve original creation date
-			conv.ID = existing.ID
-			conv.Version = existing.Version + 1
-			conv.CreatedAt = existing.CreatedAt // Preserve original creation date
-			if err := s.conversationRepo.Update(ctx, &conv); err != nil {
-				response.Errors++
-				continue
+		var updated bool
+		originalURL := conv.CanonicalURL
+		canonicalize(&conv)
+		err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+			existing, err := s.conversationRepo.GetByCanonicalURL(ctx, userID, conv.CanonicalURL, originalURL)
+			if err != nil {
+				return err
 			}
-			response.Updated++
-		} else {
+			if err := s.checkFiling(ctx, userID, &conv.CollectionID); err != nil {
+				return err
+			}
+
+			if existing != nil {
+				// Update existing - preserve original creation date
+				conv.ID = existing.ID
+				conv.CanonicalURL = existing.CanonicalURL // differs when found by an alias
+				conv.Version = existing.Version + 1
+				conv.CreatedAt = existing.CreatedAt // Preserve original creation date
+				if err := s.versionRepo.Create(ctx, existing, conv.Content); err != nil {
+					return err
+				}
+				if err := s.conversationRepo.Update(ctx, userID, &conv); err != nil {
+					return err
+				}
+				if err := syncMessages(ctx, s.messageRepo, &conv); err != nil {
+					return err
+				}
+				if err := reanchorAnnotations(ctx, s.annotationRepo, &conv); err != nil {
+					return err
+				}
+				updated = true
+				return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionUpdate, models.EntityConversation, *conv.ID, existing, &conv)
+			}
+
 			// Create new - dates will be preserved if provided in backup
 			if conv.Version == 0 {
 				conv.Version = 1
 			}
-			if err := s.conversationRepo.Create(ctx, &conv); err != nil {
-				response.Errors++
-				continue
+			if err := s.conversationRepo.Create(ctx, userID, &conv); err != nil {
+				return err
+			}
+			if err := syncMessages(ctx, s.messageRepo, &conv); err != nil {
+				return err
 			}
-			response.Created++
-		}
+			return s.audit.Record(ctx, actor, userID, models.AuditActionCreate, models.EntityConversation, *conv.ID, nil, &conv)
+		})
+		countImport(response, updated, err)
 	}
 
 	// Import collections first (they may be referenced by conversations)
 	for _, collection := range backup.Collections {
-		existing, err := s.collectionRepo.GetByName(ctx, collection.Name)
-		if err != nil {
-			response.Errors++
-			continue
-		}
-
-		if existing != nil {
-			// Update existing collection
-			collection.ID = existing.ID
-			collection.CreatedAt = existing.CreatedAt // Preserve original creation date
-			if err := s.collectionRepo.Update(ctx, &collection); err != nil {
-				response.Errors++
-				continue
+		var updated bool
+		err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+			existing, err := s.collectionRepo.GetByName(ctx, userID, collection.Name)
+			if err != nil {
+				return err
 			}
-			response.Updated++
-		} else {
+
+			// Imported collections stay in their current workspace, new ones are private
+			collection.WorkspaceID = nil
+			if existing != nil {
+				// Update existing collection
+				if err := s.workspaces.AuthorizeCollection(ctx, userID, *existing.ID, models.RoleEditor); err != nil {
+					return err
+				}
+				collection.ID = existing.ID
+				collection.OwnerID = existing.OwnerID
+				collection.WorkspaceID = existing.WorkspaceID
+				collection.CreatedAt = existing.CreatedAt // Preserve original creation date
+				collection.Version = existing.Version + 1
+				if err := s.collectionRepo.Update(ctx, userID, &collection); err != nil {
+					return err
+				}
+				updated = true
+				return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionUpdate, models.EntityCollection, *collection.ID, existing, &collection)
+			}
+
 			// Create new collection (dates will be preserved if provided in backup)
-			if err := s.collectionRepo.Create(ctx, &collection); err != nil {
-				response.Errors++
-				continue
+			if err := s.collectionRepo.Create(ctx, userID, &collection); err != nil {
+				return err
 			}
-			response.Created++
-		}
+			return s.audit.Record(ctx, actor, userID, models.AuditActionCreate, models.EntityCollection, *collection.ID, nil, &collection)
+		})
+		countImport(response, updated, err)
 	}
 
 	// Import snippets (dates will be preserved if provided in backup)
 	for _, snippet := range backup.Snippets {
-		if err := s.snippetRepo.Create(ctx, &snippet); err != nil {
-			response.Errors++
-			continue
-		}
-		response.Created++
+		err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+			if err := s.checkFiling(ctx, userID, &snippet.CollectionID); err != nil {
+				return err
+			}
+			// Conversation IDs differ between databases
+			err := checkSource(ctx, s.conversationRepo, userID, snippet.SourceConversationID)
+			if errors.Is(err, ErrSourceNotReadable) {
+				snippet.SourceConversationID = nil
+			} else if err != nil {
+				return err
+			}
+			if err := s.snippetRepo.Create(ctx, userID, &snippet); err != nil {
+				return err
+			}
+			return s.audit.Record(ctx, actor, userID, models.AuditActionCreate, models.EntitySnippet, *snippet.ID, nil, &snippet)
+		})
+		countImport(response, false, err)
+	}
+
+	// Import attachments into the conversations they belong to, as imported above
+	for _, item := range backup.Attachments {
+		updated, err := s.importAttachment(ctx, actor, &item, bytes.NewReader(item.Data))
+		countImport(response, updated, err)
+	}
+
+	// Import relations between the conversations, as imported above
+	for _, item := range backup.Relations {
+		updated, err := s.importRelation(ctx, actor, &item)
+		countImport(response, updated, err)
 	}
 
 	// Import settings
 	if backup.Settings != nil {
-		if err := s.settingsRepo.Update(ctx, backup.Settings); err != nil {
-			response.Errors++
-		} else {
-			response.Updated++
-		}
+		err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+			existing, err := s.settingsRepo.Get(ctx, userID)
+			if err != nil {
+				return err
+			}
+			protectSecrets(existing, backup.Settings)
+			backup.Settings.Version = existing.Version + 1
+			if err := s.settingsRepo.Update(ctx, userID, backup.Settings); err != nil {
+				return err
+			}
+			if existing.ID == nil {
+				return s.audit.Record(ctx, actor, userID, models.AuditActionCreate, models.EntitySettings, *backup.Settings.ID, nil, backup.Settings)
+			}
+			return s.audit.Record(ctx, actor, userID, models.AuditActionUpdate, models.EntitySettings, *backup.Settings.ID, existing, backup.Settings)
+		})
+		countImport(response, true, err)
 	}
 
 	return response, nil
 }
 
+// ExportAttachments returns the attachments of the user's conversations with
+// their content, to include in a backup, as a stream of JSON (see
+// AttachmentService.ExportBackup). The caller closes it.
+func (s *BackupService) ExportAttachments(ctx context.Context, userID int) (io.ReadCloser, error) {
+	return s.attachments.ExportBackup(ctx, userID)
+}
+
+// ImportAttachment restores one backed up attachment, with the content read
+// from r rather than from item.Data, so that attachments too large to send
+// inline in a backup import can be sent one at a time
+func (s *BackupService) ImportAttachment(ctx context.Context, actor models.Actor, item *models.BackupAttachment, r io.Reader) (*models.BackupImportResponse, error) {
+	updated, err := s.importAttachment(ctx, actor, item, r)
+	if err != nil {
+		return nil, err
+	}
+	response := &models.BackupImportResponse{}
+	countImport(response, updated, nil)
+	return response, nil
+}
+
+// importAttachment restores a backed up attachment into the user's
+// conversation saved from its conversation URL
+func (s *BackupService) importAttachment(ctx context.Context, actor models.Actor, item *models.BackupAttachment, r io.Reader) (bool, error) {
+	conv, err := s.conversationByURL(ctx, actor.UserID, item.ConversationURL)
+	if err != nil {
+		return false, err
+	}
+	return s.attachments.importBackup(ctx, actor, conv, item, r)
+}
+
+// importRelation restores a backed up relation between the user's
+// conversations saved from its source and target URLs
+func (s *BackupService) importRelation(ctx context.Context, actor models.Actor, item *models.BackupRelation) (bool, error) {
+	source, err := s.conversationByURL(ctx, actor.UserID, item.SourceURL)
+	if err != nil {
+		return false, err
+	}
+	target, err := s.conversationByURL(ctx, actor.UserID, item.TargetURL)
+	if err != nil {
+		return false, err
+	}
+	return s.relations.importBackup(ctx, actor, source, target, item)
+}
+
+// conversationByURL returns the user's conversation saved from url, or
+// ErrNotFound
+func (s *BackupService) conversationByURL(ctx context.Context, userID int, url string) (*models.Conversation, error) {
+	canonical, _ := sources.Canonicalize(url)
+	conv, err := s.conversationRepo.GetByCanonicalURL(ctx, userID, canonical, url)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, ErrNotFound
+	}
+	return conv, nil
+}
+
+// checkFiling clears a collection reference the user cannot file items in.
+// Backups made in local mode carry collection IDs of the browser's database,
+// which must not file imported items in someone else's collection.
+func (s *BackupService) checkFiling(ctx context.Context, userID int, collectionID **int) error {
+	err := s.workspaces.AuthorizeFiling(ctx, userID, *collectionID)
+	if errors.Is(err, ErrCollectionNotWritable) {
+		*collectionID = nil
+		return nil
+	}
+	return err
+}
+
+func countImport(response *models.BackupImportResponse, updated bool, err error) {
+	switch {
+	case err != nil:
+		response.Errors++
+	case updated:
+		response.Updated++
+	default:
+		response.Created++
+	}
+}
+
@@ -2,47 +2,158 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/mergepatch"
 )
 
 type CollectionService struct {
-	repo *repository.CollectionRepository
+	pool       *pgxpool.Pool
+	repo       *repository.CollectionRepository
+	audit      *AuditService
+	workspaces *WorkspaceService
 }
 
-func NewCollectionService(repo *repository.CollectionRepository) *CollectionService {
-	return &CollectionService{repo: repo}
+func NewCollectionService(pool *pgxpool.Pool, repo *repository.CollectionRepository, audit *AuditService, workspaces *WorkspaceService) *CollectionService {
+	return &CollectionService{pool: pool, repo: repo, audit: audit, workspaces: workspaces}
 }
 
-func (s *CollectionService) GetByID(ctx context.Context, id int) (*models.Collection, error) {
-	return s.repo.GetByID(ctx, id)
+func (s *CollectionService) GetByID(ctx context.Context, userID, id int) (*models.Collection, error) {
+	return s.repo.GetByID(ctx, userID, id)
 }
 
-func (s *CollectionService) List(ctx context.Context) ([]models.Collection, error) {
-	return s.repo.List(ctx)
+func (s *CollectionService) List(ctx context.Context, userID int) ([]models.Collection, error) {
+	return s.repo.List(ctx, userID)
 }
 
-func (s *CollectionService) Create(ctx context.Context, collection *models.Collection) error {
+// Create creates a collection. Creating it in a workspace requires the editor role.
+func (s *CollectionService) Create(ctx context.Context, actor models.Actor, collection *models.Collection) error {
 	// Validate required fields
 	if collection.Name == "" {
 		return fmt.Errorf("name is required")
 	}
-	return s.repo.Create(ctx, collection)
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		if collection.WorkspaceID != nil {
+			err := s.workspaces.AuthorizeWorkspace(ctx, actor.UserID, *collection.WorkspaceID, models.RoleEditor)
+			if errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("workspace_id does not refer to a workspace you are a member of")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := s.repo.Create(ctx, actor.UserID, collection); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, actor.UserID, models.AuditActionCreate, models.EntityCollection, *collection.ID, nil, collection)
+	})
 }
 
-func (s *CollectionService) Update(ctx context.Context, collection *models.Collection) error {
+// Update replaces a collection, except for its workspace. It returns ErrNotFound
+// if the collection does not exist, ErrForbidden if the user is a viewer of its
+// workspace, and a ConflictError if ifMatch does not match it.
+func (s *CollectionService) Update(ctx context.Context, actor models.Actor, collection *models.Collection, ifMatch models.IfMatch) error {
 	if collection.ID == nil {
 		return fmt.Errorf("id is required for update")
 	}
 	if collection.Name == "" {
 		return fmt.Errorf("name is required")
 	}
-	return s.repo.Update(ctx, collection)
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, *collection.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrNotFound
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		if err := s.workspaces.AuthorizeCollection(ctx, actor.UserID, *collection.ID, models.RoleEditor); err != nil {
+			return err
+		}
+		collection.OwnerID = existing.OwnerID
+		collection.WorkspaceID = existing.WorkspaceID
+		collection.CreatedAt = existing.CreatedAt
+		collection.Version = existing.Version + 1
+		if err := s.repo.Update(ctx, actor.UserID, collection); err != nil {
+			return s.conflict(ctx, actor.UserID, *collection.ID, err)
+		}
+		return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionUpdate, models.EntityCollection, *collection.ID, existing, collection)
+	})
 }
 
-func (s *CollectionService) Delete(ctx context.Context, id int) error {
-	return s.repo.Delete(ctx, id)
+// collectionReadOnlyFields are the members a patch may not change
+var collectionReadOnlyFields = []string{"id", "owner_id", "workspace_id", "version", "created_at", "deleted_at"}
+
+// Patch applies a JSON Merge Patch to a collection and returns the result, with
+// the errors of Update
+func (s *CollectionService) Patch(ctx context.Context, actor models.Actor, id int, patch []byte, ifMatch models.IfMatch) (*models.Collection, error) {
+	var collection models.Collection
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrNotFound
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+
+		if err := mergepatch.Apply(existing, patch, &collection, collectionReadOnlyFields...); err != nil {
+			return err
+		}
+		// Update must apply to the version the patch was applied to
+		return s.Update(ctx, actor, &collection, models.IfMatch{existing.ETag()})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// Delete moves a collection to the trash (see TrashService), leaving its
+// conversations and snippets filed in it. Deleting a missing collection is a
+// no-op. Deleting a workspace collection requires the admin role, otherwise it
+// returns ErrForbidden. It returns a ConflictError if ifMatch does not match the collection.
+func (s *CollectionService) Delete(ctx context.Context, actor models.Actor, id int, ifMatch models.IfMatch) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		if existing == nil {
+			return nil
+		}
+		if err := s.workspaces.AuthorizeCollection(ctx, actor.UserID, id, models.RoleAdmin); err != nil {
+			return err
+		}
+		if err := s.repo.Trash(ctx, actor.UserID, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionDelete, models.EntityCollection, id, existing, nil)
+	})
 }
 
+// conflict turns ErrStaleVersion from an update into a ConflictError with the
+// collection as stored now, and returns other errors as is
+func (s *CollectionService) conflict(ctx context.Context, userID, id int, err error) error {
+	if !errors.Is(err, repository.ErrStaleVersion) {
+		return err
+	}
+	current, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	return &ConflictError{Current: current}
+}
@@ -2,73 +2,349 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/mergepatch"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/sources"
 )
 
 type ConversationService struct {
-	repo *repository.ConversationRepository
+	pool        *pgxpool.Pool
+	repo        *repository.ConversationRepository
+	messages    *repository.MessageRepository
+	versions    *repository.ConversationVersionRepository
+	snippets    *repository.SnippetRepository
+	relations   *repository.RelationRepository
+	annotations *repository.AnnotationRepository
+	audit       *AuditService
+	workspaces  *WorkspaceService
+	guard       ShrinkGuardConfig
 }
 
-func NewConversationService(repo *repository.ConversationRepository) *ConversationService {
-	return &ConversationService{repo: repo}
+func NewConversationService(
+	pool *pgxpool.Pool,
+	repo *repository.ConversationRepository,
+	messages *repository.MessageRepository,
+	versions *repository.ConversationVersionRepository,
+	snippets *repository.SnippetRepository,
+	relations *repository.RelationRepository,
+	annotations *repository.AnnotationRepository,
+	audit *AuditService,
+	workspaces *WorkspaceService,
+	guard ShrinkGuardConfig,
+) *ConversationService {
+	return &ConversationService{
+		pool:        pool,
+		repo:        repo,
+		messages:    messages,
+		versions:    versions,
+		snippets:    snippets,
+		relations:   relations,
+		annotations: annotations,
+		audit:       audit,
+		workspaces:  workspaces,
+		guard:       guard,
+	}
 }
 
-func (s *ConversationService) GetByID(ctx context.Context, id int) (*models.Conversation, error) {
-	return s.repo.GetByID(ctx, id)
+func (s *ConversationService) GetByID(ctx context.Context, userID, id int) (*models.Conversation, error) {
+	return s.repo.GetByID(ctx, userID, id)
 }
 
-func (s *ConversationService) GetByCanonicalURL(ctx context.Context, url string) (*models.Conversation, error) {
-	return s.repo.GetByCanonicalURL(ctx, url)
+// GetByCanonicalURL returns the user's conversation saved from url, in any
+// form the source registry maps to the same canonical URL, or from one of its
+// aliases
+func (s *ConversationService) GetByCanonicalURL(ctx context.Context, userID int, url string) (*models.Conversation, error) {
+	canonical, _ := sources.Canonicalize(url)
+	return s.repo.GetByCanonicalURL(ctx, userID, canonical, url)
 }
 
-func (s *ConversationService) Upsert(ctx context.Context, conv *models.Conversation) error {
+// Upsert creates the conversation or updates the user's conversation with the
+// same canonical URL, merging its content as mergeMode says (see mergeContent).
+// URLs are canonicalized first, and the source is set from the provider
+// serving them when it is known (see sources.Canonicalize).
+// It reports how the content was merged, and returns a ConflictError if ifMatch
+// does not match the existing conversation, or a ShrinkError if the merged
+// content loses more than the shrink guard allows and force is not set.
+func (s *ConversationService) Upsert(ctx context.Context, actor models.Actor, conv *models.Conversation, mergeMode string, force bool, ifMatch models.IfMatch) (*models.MergeReport, error) {
 	// Validate required fields
 	if conv.CanonicalURL == "" {
-		return fmt.Errorf("canonical_url is required")
+		return nil, fmt.Errorf("canonical_url is required")
 	}
 	if conv.Source == "" {
-		return fmt.Errorf("source is required")
+		return nil, fmt.Errorf("source is required")
 	}
 	if conv.Title == "" {
-		return fmt.Errorf("title is required")
+		return nil, fmt.Errorf("title is required")
 	}
 	if conv.Content == "" {
-		return fmt.Errorf("content is required")
+		return nil, fmt.Errorf("content is required")
+	}
+	sentURL := conv.CanonicalURL
+	canonicalize(conv)
+	if mergeMode == "" {
+		mergeMode = models.MergeModeMerge
+	}
+	if mergeMode != models.MergeModeMerge && mergeMode != models.MergeModeReplace {
+		return nil, fmt.Errorf("merge_mode must be %s or %s", models.MergeModeMerge, models.MergeModeReplace)
 	}
 
-	// Check if conversation exists
-	existing, err := s.repo.GetByCanonicalURL(ctx, conv.CanonicalURL)
+	var report *models.MergeReport
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		// Check if conversation exists
+		existing, err := s.repo.GetByCanonicalURL(ctx, actor.UserID, conv.CanonicalURL, sentURL)
+		if err != nil {
+			return fmt.Errorf("failed to check existing conversation: %w", err)
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+
+		// Filing in a collection may share the conversation with a workspace
+		if existing == nil || !sameID(existing.CollectionID, conv.CollectionID) {
+			if err := s.workspaces.AuthorizeFiling(ctx, actor.UserID, conv.CollectionID); err != nil {
+				return err
+			}
+		}
+
+		if existing != nil {
+			// Update existing conversation
+			conv.ID = existing.ID
+			conv.CanonicalURL = existing.CanonicalURL // differs when found by an alias
+			conv.CreatedAt = existing.CreatedAt
+			// Preserve ignore flag if not explicitly set
+			if conv.Ignore == false && existing.Ignore == true {
+				conv.Ignore = existing.Ignore
+			}
+			conv.Content, report = mergeContent(existing.Content, conv.Content, mergeMode)
+			if !force {
+				if err := s.guard.checkShrink(existing.Content, conv.Content); err != nil {
+					return err
+				}
+			}
+			return s.update(ctx, actor, existing, conv)
+		}
+
+		// Create new conversation
+		if conv.Version == 0 {
+			conv.Version = 1
+		}
+		if err := s.repo.Create(ctx, actor.UserID, conv); err != nil {
+			return err
+		}
+		if err := syncMessages(ctx, s.messages, conv); err != nil {
+			return err
+		}
+		report = &models.MergeReport{
+			Result:         models.MergeCreated,
+			IncomingLength: len(conv.Content),
+			Length:         len(conv.Content),
+		}
+		return s.audit.Record(ctx, actor, actor.UserID, models.AuditActionCreate, models.EntityConversation, *conv.ID, nil, conv)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to check existing conversation: %w", err)
+		return nil, err
 	}
+	return report, nil
+}
 
-	if existing != nil {
-		// Update existing conversation
-		conv.ID = existing.ID
-		conv.Version = existing.Version + 1
-		conv.CreatedAt = existing.CreatedAt
-		// Preserve ignore flag if not explicitly set
-		if conv.Ignore == false && existing.Ignore == true {
-			conv.Ignore = existing.Ignore
+// conversationReadOnlyFields are the members a patch may not change
+var conversationReadOnlyFields = []string{"id", "owner_id", "canonical_url", "source", "version", "created_at", "updated_at", "deleted_at", "token_count", "tokenizer", "metadata"}
+
+// Patch applies a JSON Merge Patch to a conversation and returns the result. It
+// returns ErrNotFound if the user cannot read the conversation, ErrForbidden if
+// they can only view it, and a ConflictError if ifMatch does not match it.
+func (s *ConversationService) Patch(ctx context.Context, actor models.Actor, id int, patch []byte, ifMatch models.IfMatch) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrNotFound
 		}
-		return s.repo.Update(ctx, conv)
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, existing.OwnerID, existing.CollectionID); err != nil {
+			return err
+		}
+
+		if err := mergepatch.Apply(existing, patch, &conv, conversationReadOnlyFields...); err != nil {
+			return err
+		}
+		if conv.Title == "" {
+			return fmt.Errorf("title is required")
+		}
+		if conv.Content == "" {
+			return fmt.Errorf("content is required")
+		}
+		if !sameID(existing.CollectionID, conv.CollectionID) {
+			if err := s.workspaces.AuthorizeFiling(ctx, actor.UserID, conv.CollectionID); err != nil {
+				return err
+			}
+		}
+		return s.update(ctx, actor, existing, &conv)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return &conv, nil
+}
 
-	// Create new conversation
-	if conv.Version == 0 {
-		conv.Version = 1
+// update saves next as the new version of the existing conversation, keeping
+// the state it replaces in the version history
+func (s *ConversationService) update(ctx context.Context, actor models.Actor, existing, next *models.Conversation) error {
+	next.Version = existing.Version + 1
+	if err := s.versions.Create(ctx, existing, next.Content); err != nil {
+		return err
+	}
+	if err := s.repo.Update(ctx, actor.UserID, next); err != nil {
+		return s.conflict(ctx, actor.UserID, *next.ID, err)
+	}
+	if err := syncMessages(ctx, s.messages, next); err != nil {
+		return err
+	}
+	if err := reanchorAnnotations(ctx, s.annotations, next); err != nil {
+		return err
 	}
-	return s.repo.Create(ctx, conv)
+	return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionUpdate, models.EntityConversation, *next.ID, existing, next)
 }
 
-func (s *ConversationService) Delete(ctx context.Context, id int) error {
-	return s.repo.Delete(ctx, id)
+// Delete moves a conversation to the trash (see TrashService). Deleting a
+// missing conversation is a no-op. It returns ErrForbidden if the user can only
+// view the conversation, and a ConflictError if ifMatch does not match it.
+func (s *ConversationService) Delete(ctx context.Context, actor models.Actor, id int, ifMatch models.IfMatch) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		if existing == nil {
+			return nil
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, existing.OwnerID, existing.CollectionID); err != nil {
+			return err
+		}
+		if err := s.repo.Trash(ctx, actor.UserID, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionDelete, models.EntityConversation, id, existing, nil)
+	})
+}
+
+// Messages returns the messages of a conversation the user can read, or nil if
+// there is no such conversation. Conversations saved before messages were
+// parsed get their messages on first access.
+func (s *ConversationService) Messages(ctx context.Context, userID, id int, filters models.MessageFilters) (*models.MessageList, error) {
+	var list *models.MessageList
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		conv, err := s.repo.GetByID(ctx, userID, id)
+		if err != nil || conv == nil {
+			return err
+		}
+
+		total, err := s.ensureSegments(ctx, conv)
+		if err != nil {
+			return err
+		}
+
+		messages, err := s.messages.List(ctx, id, filters)
+		if err != nil {
+			return err
+		}
+		if filters.ExcludeReasoning {
+			kept, err := s.messages.ListSegments(ctx, id, models.SegmentFilters{Kinds: answerKinds})
+			if err != nil {
+				return err
+			}
+			messages = stripReasoning(messages, kept)
+		}
+		list = &models.MessageList{ConversationID: id, Total: total, Messages: messages}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// conflict turns ErrStaleVersion from an update into a ConflictError with the
+// conversation as stored now, and returns other errors as is
+func (s *ConversationService) conflict(ctx context.Context, userID, id int, err error) error {
+	if !errors.Is(err, repository.ErrStaleVersion) {
+		return err
+	}
+	current, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	return &ConflictError{Current: current}
 }
 
-func (s *ConversationService) Search(ctx context.Context, filters models.SearchFilters) ([]models.Conversation, error) {
-	return s.repo.Search(ctx, filters)
+// metadataBackfillSize is the number of conversations saved before metadata
+// existed that get it on each search filtering on it
+const metadataBackfillSize = 500
+
+// Search returns the conversations matching filters. When the query or tags
+// match the user's annotations, the matching ones are attached to their
+// conversation to show why it matched.
+func (s *ConversationService) Search(ctx context.Context, userID int, filters models.SearchFilters) ([]models.Conversation, error) {
+	if filters.HasMetadataFilters() {
+		if err := s.backfillMetadata(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	if filters.Query != "" && filters.ExcludeReasoning {
+		if err := s.backfillSegments(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	conversations, err := s.repo.Search(ctx, userID, filters)
+	if err != nil || len(conversations) == 0 {
+		return conversations, err
+	}
+
+	ids := make([]int, len(conversations))
+	for i := range conversations {
+		ids[i] = *conversations[i].ID
+	}
+	annotations, err := s.annotations.ListMatching(ctx, userID, ids, filters.Query, filters.Tags)
+	if err != nil {
+		return nil, err
+	}
+	byConversation := map[int][]models.Annotation{}
+	for _, annotation := range annotations {
+		byConversation[annotation.ConversationID] = append(byConversation[annotation.ConversationID], annotation)
+	}
+	for i := range conversations {
+		conversations[i].Annotations = byConversation[*conversations[i].ID]
+	}
+	return conversations, nil
 }
 
+// backfillMetadata derives the metadata of conversations the user can read
+// that were saved before it existed, so that searches on it find them
+func (s *ConversationService) backfillMetadata(ctx context.Context, userID int) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		unenriched, err := s.repo.ListUnenriched(ctx, userID, metadataBackfillSize)
+		if err != nil {
+			return err
+		}
+		for _, conv := range unenriched {
+			if err := s.repo.SetMetadata(ctx, *conv.ID, conv.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
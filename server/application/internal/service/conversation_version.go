@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/textdiff"
+)
+
+// ErrVersionNotFound is returned when restoring a version the conversation does not have
+var ErrVersionNotFound = errors.New("version not found")
+
+// Versions returns the versions of a conversation the user can read, newest
+// first and starting with the current one, or nil if there is no such conversation
+func (s *ConversationService) Versions(ctx context.Context, userID, id int) ([]models.ConversationVersion, error) {
+	var versions []models.ConversationVersion
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		conv, err := s.repo.GetByID(ctx, userID, id)
+		if err != nil || conv == nil {
+			return err
+		}
+		past, err := s.versions.List(ctx, id)
+		if err != nil {
+			return err
+		}
+		current := currentVersion(conv)
+		current.Content = nil
+		versions = append([]models.ConversationVersion{*current}, past...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Version returns a version of a conversation the user can read with its
+// content, or nil if there is no such conversation or version
+func (s *ConversationService) Version(ctx context.Context, userID, id, version int) (*models.ConversationVersion, error) {
+	var v *models.ConversationVersion
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		conv, err := s.repo.GetByID(ctx, userID, id)
+		if err != nil || conv == nil {
+			return err
+		}
+		v, err = s.version(ctx, conv, version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Diff returns the unified diff of the content of two versions of a conversation
+// the user can read, or nil if there is no such conversation or version.
+// to defaults to the current version, and from to the version before to.
+func (s *ConversationService) Diff(ctx context.Context, userID, id int, fromVersion, toVersion *int) (*models.ConversationDiff, error) {
+	var diff *models.ConversationDiff
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		conv, err := s.repo.GetByID(ctx, userID, id)
+		if err != nil || conv == nil {
+			return err
+		}
+
+		to := conv.Version
+		if toVersion != nil {
+			to = *toVersion
+		}
+		from := to - 1
+		if fromVersion != nil {
+			from = *fromVersion
+		}
+
+		oldVersion, err := s.version(ctx, conv, from)
+		if err != nil || oldVersion == nil {
+			return err
+		}
+		newVersion, err := s.version(ctx, conv, to)
+		if err != nil || newVersion == nil {
+			return err
+		}
+
+		diff = &models.ConversationDiff{
+			ConversationID: id,
+			From:           from,
+			To:             to,
+			Diff: textdiff.Unified(
+				fmt.Sprintf("conversation/%d/v%d", id, from),
+				fmt.Sprintf("conversation/%d/v%d", id, to),
+				*oldVersion.Content, *newVersion.Content,
+			),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// RestoreVersion makes a past version the current state of a conversation, as
+// a new version. The state it replaces is kept as a version like on any save.
+// It returns ErrNotFound if the user cannot read the conversation, ErrForbidden
+// if they can only view it, ErrVersionNotFound if there is no such version, and
+// a ConflictError if ifMatch does not match the conversation.
+func (s *ConversationService) RestoreVersion(ctx context.Context, actor models.Actor, id, version int, ifMatch models.IfMatch) (*models.Conversation, error) {
+	var conv *models.Conversation
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrNotFound
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, existing.OwnerID, existing.CollectionID); err != nil {
+			return err
+		}
+
+		restored, err := s.version(ctx, existing, version)
+		if err != nil {
+			return err
+		}
+		if restored == nil {
+			return ErrVersionNotFound
+		}
+		if restored.Current {
+			conv = existing
+			return nil
+		}
+
+		next := *existing
+		next.Title = restored.Title
+		next.Description = restored.Description
+		next.Tags = restored.Tags
+		next.Content = *restored.Content
+		if err := s.update(ctx, actor, existing, &next); err != nil {
+			return err
+		}
+		conv = &next
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// version returns a version of conv, the current one included, or nil
+func (s *ConversationService) version(ctx context.Context, conv *models.Conversation, version int) (*models.ConversationVersion, error) {
+	if version == conv.Version {
+		return currentVersion(conv), nil
+	}
+	if version > conv.Version {
+		return nil, nil
+	}
+	return s.versions.Get(ctx, conv, version)
+}
+
+// currentVersion describes the current state of conv as a version
+func currentVersion(conv *models.Conversation) *models.ConversationVersion {
+	content := conv.Content
+	return &models.ConversationVersion{
+		ConversationID: *conv.ID,
+		Version:        conv.Version,
+		Title:          conv.Title,
+		Description:    conv.Description,
+		Tags:           conv.Tags,
+		Content:        &content,
+		ContentLength:  len(conv.Content),
+		SavedAt:        conv.UpdatedAt,
+		Current:        true,
+	}
+}
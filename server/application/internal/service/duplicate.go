@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/fingerprint"
+)
+
+// DefaultDuplicateDistance is the largest number of differing fingerprint bits
+// between near-duplicates when the request does not say
+const DefaultDuplicateDistance = 6
+
+// MaxDuplicateDistance bounds the requested distance: past a quarter of the
+// bits, fingerprints match unrelated conversations
+const MaxDuplicateDistance = fingerprint.Bits / 4
+
+// fingerprintBackfillSize is the number of conversations saved before
+// fingerprints existed that get one on each duplicate lookup
+const fingerprintBackfillSize = 500
+
+// ErrMergeIntoItself is returned when merging a conversation into itself
+var ErrMergeIntoItself = errors.New("cannot merge a conversation into itself")
+
+// Duplicates returns the likely duplicates of a conversation the user can
+// read, closest first, or nil if there is no such conversation. Conversations
+// saved from its canonical or share URL always match; others match when their
+// content fingerprint differs in at most maxDistance bits.
+func (s *ConversationService) Duplicates(ctx context.Context, userID, id, maxDistance int) ([]models.DuplicateConversation, error) {
+	var duplicates []models.DuplicateConversation
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		conv, err := s.repo.GetByID(ctx, userID, id)
+		if err != nil || conv == nil {
+			return err
+		}
+
+		unfingerprinted, err := s.repo.ListUnfingerprinted(ctx, userID, fingerprintBackfillSize)
+		if err != nil {
+			return err
+		}
+		for _, other := range unfingerprinted {
+			if err := s.repo.SetFingerprint(ctx, *other.ID, other.Content); err != nil {
+				return err
+			}
+		}
+
+		var stored *int64
+		simhash, hasFingerprint := fingerprint.SimHash(conv.Content)
+		if hasFingerprint {
+			value := int64(simhash)
+			stored = &value
+		}
+		candidates, err := s.repo.Duplicates(ctx, userID, conv, stored, maxDistance)
+		if err != nil {
+			return err
+		}
+
+		duplicates = []models.DuplicateConversation{}
+		for _, candidate := range candidates {
+			duplicate := models.DuplicateConversation{Conversation: candidate, Match: models.DuplicateMatchContent}
+			if sharesURL(conv, &candidate) {
+				duplicate.Match = models.DuplicateMatchURL
+			}
+			if other, ok := fingerprint.SimHash(candidate.Content); ok && hasFingerprint {
+				duplicate.Similarity = fingerprint.Similarity(fingerprint.Distance(simhash, other))
+			}
+			duplicates = append(duplicates, duplicate)
+		}
+		sortDuplicates(duplicates)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
+
+// Merge folds the conversation sourceID into conversation id and moves the
+// source to the trash. The target keeps its content, extended with the source
+// content when one continues the other (see mergeContent), and gains the tags
+// of the source, its collection and share URL if it has none, the snippets
+// taken from it and its relations. The canonical and share URLs of the source
+// become aliases of the target when both have the same owner. It returns ErrNotFound
+// if the user cannot read either conversation, ErrForbidden if they can only
+// view one of them, and a ConflictError if ifMatch does not match the target.
+func (s *ConversationService) Merge(ctx context.Context, actor models.Actor, id, sourceID int, ifMatch models.IfMatch) (*models.SaveConversationResponse, error) {
+	if id == sourceID {
+		return nil, ErrMergeIntoItself
+	}
+
+	var response *models.SaveConversationResponse
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrNotFound
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, existing.OwnerID, existing.CollectionID); err != nil {
+			return err
+		}
+
+		source, err := s.repo.GetByID(ctx, actor.UserID, sourceID)
+		if err != nil {
+			return err
+		}
+		if source == nil {
+			return ErrNotFound
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, source.OwnerID, source.CollectionID); err != nil {
+			return err
+		}
+
+		next := *existing
+		next.Tags = mergeTags(existing.Tags, source.Tags)
+		if next.Description == nil {
+			next.Description = source.Description
+		}
+		if next.ShareURL == nil {
+			next.ShareURL = source.ShareURL
+		}
+		if next.CollectionID == nil && source.CollectionID != nil {
+			if err := s.workspaces.AuthorizeFiling(ctx, actor.UserID, source.CollectionID); err != nil {
+				return err
+			}
+			next.CollectionID = source.CollectionID
+		}
+
+		// A source diverging from the target, such as a fork, does not replace it
+		content, report := mergeContent(existing.Content, source.Content, models.MergeModeMerge)
+		if report.Result == models.MergeReplaced {
+			content = existing.Content
+			report.Result = models.MergeConflict
+			report.Length = len(content)
+		}
+		next.Content = content
+
+		if err := s.update(ctx, actor, existing, &next); err != nil {
+			return err
+		}
+		// update leaves the URLs as they are
+		if existing.ShareURL == nil && next.ShareURL != nil {
+			if err := s.repo.SetURLs(ctx, &next); err != nil {
+				return err
+			}
+		}
+		if err := s.moveSnippets(ctx, actor, sourceID, id); err != nil {
+			return err
+		}
+		if err := s.moveRelations(ctx, actor, sourceID, id); err != nil {
+			return err
+		}
+		if err := s.repo.Trash(ctx, actor.UserID, sourceID); err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, actor, source.OwnerID, models.AuditActionDelete, models.EntityConversation, sourceID, source, nil); err != nil {
+			return err
+		}
+		// Saving the source again updates the conversation it was merged into
+		if source.OwnerID == existing.OwnerID {
+			urls := []string{source.CanonicalURL}
+			if source.ShareURL != nil {
+				urls = append(urls, *source.ShareURL)
+			}
+			for _, url := range urls {
+				if err := s.repo.AddAlias(ctx, source.OwnerID, url, id); err != nil {
+					return err
+				}
+			}
+		}
+
+		response = &models.SaveConversationResponse{Conversation: next, Merge: report}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// moveSnippets makes the snippets taken from conversation fromID point to toID
+func (s *ConversationService) moveSnippets(ctx context.Context, actor models.Actor, fromID, toID int) error {
+	snippets, err := s.snippets.ReassignSource(ctx, fromID, toID)
+	if err != nil {
+		return err
+	}
+	for i := range snippets {
+		snippet := &snippets[i]
+		before := *snippet
+		before.SourceConversationID = &fromID
+		before.Version--
+		if err := s.audit.Record(ctx, actor, snippet.OwnerID, models.AuditActionUpdate, models.EntitySnippet, *snippet.ID, &before, snippet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveRelations makes the relations of conversation fromID relate toID
+// instead, dropping those toID already has and those between the two
+func (s *ConversationService) moveRelations(ctx context.Context, actor models.Actor, fromID, toID int) error {
+	relations, err := s.relations.ListByConversation(ctx, fromID)
+	if err != nil {
+		return err
+	}
+	for i := range relations {
+		before := relations[i]
+		relation := &relations[i]
+		if relation.SourceID == fromID {
+			relation.SourceID = toID
+		}
+		if relation.TargetID == fromID {
+			relation.TargetID = toID
+		}
+		normalizeRelation(relation)
+
+		drop := relation.SourceID == relation.TargetID
+		if !drop {
+			existing, err := s.relations.Find(ctx, relation.SourceID, relation.TargetID, relation.Type)
+			if err != nil {
+				return err
+			}
+			drop = existing != nil
+		}
+		if drop {
+			if err := s.relations.Delete(ctx, *relation.ID); err != nil {
+				return err
+			}
+			if err := s.audit.Record(ctx, actor, before.UserID, models.AuditActionDelete, models.EntityRelation, *relation.ID, &before, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.relations.Update(ctx, relation); err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, actor, relation.UserID, models.AuditActionUpdate, models.EntityRelation, *relation.ID, &before, relation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharesURL reports whether two conversations were saved from a common URL
+func sharesURL(a, b *models.Conversation) bool {
+	urls := map[string]bool{a.CanonicalURL: true}
+	if a.ShareURL != nil {
+		urls[*a.ShareURL] = true
+	}
+	return urls[b.CanonicalURL] || (b.ShareURL != nil && urls[*b.ShareURL])
+}
+
+// sortDuplicates puts URL matches first, then the most similar content
+func sortDuplicates(duplicates []models.DuplicateConversation) {
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		a, b := duplicates[i], duplicates[j]
+		if (a.Match == models.DuplicateMatchURL) != (b.Match == models.DuplicateMatchURL) {
+			return a.Match == models.DuplicateMatchURL
+		}
+		return a.Similarity > b.Similarity
+	})
+}
+
+// mergeTags returns the tags of a followed by those of b it lacks
+func mergeTags(a, b []string) []string {
+	seen := make(map[string]bool, len(a))
+	tags := make([]string, 0, len(a)+len(b))
+	for _, tag := range append(append([]string{}, a...), b...) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
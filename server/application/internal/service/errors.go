@@ -0,0 +1,21 @@
+package service
+
+import "errors"
+
+// ErrNotFound is returned when the entity to change does not exist or belongs to another user
+var ErrNotFound = errors.New("not found")
+
+// ErrForbidden is returned when the user can see an entity but their workspace
+// role does not allow the change
+var ErrForbidden = errors.New("forbidden")
+
+// ConflictError is returned when a write does not apply to the current version
+// of an entity, because of an If-Match precondition or a concurrent write.
+// Current is the entity as stored now, a nil pointer if it does not exist.
+type ConflictError struct {
+	Current interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return "version conflict"
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/textdiff"
+)
+
+// minMergeOverlap is the length in bytes of the shortest overlap or common
+// beginning taken as evidence that two captures show the same conversation,
+// so that a repeated short line does not splice unrelated texts
+const minMergeOverlap = 64
+
+// mergeContent combines the stored content of a conversation with newly
+// captured content. In merge mode, a capture of only part of a long thread,
+// such as its visible window, is spliced into the stored content so that no
+// turn is lost:
+//
+//   - a capture contained in the stored content leaves it unchanged;
+//   - a capture starting with the stored content extends it;
+//   - a capture overlapping the end or the beginning of the stored content is
+//     joined to it at the overlap;
+//   - a capture sharing only a beginning with the stored content, as after an
+//     edited or regenerated message, replaces it;
+//   - any other capture is a conflict and the stored content is kept.
+func mergeContent(stored, incoming, mode string) (string, *models.MergeReport) {
+	report := &models.MergeReport{
+		StoredLength:   len(stored),
+		IncomingLength: len(incoming),
+	}
+	merged := stored
+
+	switch {
+	case mode == models.MergeModeReplace:
+		report.Result = models.MergeReplaced
+		merged = incoming
+	case strings.Contains(stored, incoming):
+		report.Result = models.MergeUnchanged
+		report.Overlap = len(incoming)
+	case strings.HasPrefix(incoming, stored):
+		report.Result = models.MergeAppended
+		report.Overlap = len(stored)
+		merged = incoming
+	case strings.Contains(incoming, stored):
+		report.Result = models.MergeMerged
+		report.Overlap = len(stored)
+		merged = incoming
+	default:
+		// Overlap at the end of the stored content (a later window), or at
+		// its beginning (older turns loaded above it); keep the longer one
+		after := textdiff.Overlap(stored, incoming)
+		before := textdiff.Overlap(incoming, stored)
+		common := textdiff.CommonPrefix(stored, incoming)
+		switch {
+		case after >= minMergeOverlap && after >= before:
+			report.Result = models.MergeMerged
+			report.Overlap = after
+			merged = stored + incoming[after:]
+		case before >= minMergeOverlap:
+			report.Result = models.MergeMerged
+			report.Overlap = before
+			merged = incoming + stored[before:]
+		case common >= minMergeOverlap:
+			report.Result = models.MergeReplaced
+			report.Overlap = common
+			merged = incoming
+		default:
+			report.Result = models.MergeConflict
+		}
+	}
+
+	report.Length = len(merged)
+	return merged, report
+}
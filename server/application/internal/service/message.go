@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/segments"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/transcript"
+)
+
+// parseMessages splits conversation content into messages, and the messages
+// into segments with the rules of source. Messages of the user and the system
+// are a single answer segment: only the model reasons and calls tools.
+func parseMessages(source, content string) []models.Message {
+	parsed := transcript.Parse(content)
+	messages := make([]models.Message, 0, len(parsed))
+	for _, p := range parsed {
+		msg := models.Message{Role: p.Role, Content: p.Content}
+		if p.Model != "" {
+			model := p.Model
+			msg.Model = &model
+		}
+		if p.Role == transcript.RoleUser || p.Role == transcript.RoleSystem {
+			msg.Segments = []models.MessageSegment{{Kind: models.SegmentKindAnswer, Content: p.Content}}
+		} else {
+			for _, s := range segments.Split(source, p.Content) {
+				msg.Segments = append(msg.Segments, models.MessageSegment{Kind: s.Kind, Content: s.Text})
+			}
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// stripReasoning replaces the content of messages with their answers and
+// citations, and drops the messages that have none
+func stripReasoning(messages []models.Message, kept []models.MessageSegment) []models.Message {
+	parts := map[int][]string{}
+	for _, seg := range kept {
+		parts[seg.MessageID] = append(parts[seg.MessageID], seg.Content)
+	}
+	stripped := []models.Message{}
+	for _, msg := range messages {
+		if msg.ID == nil || len(parts[*msg.ID]) == 0 {
+			continue
+		}
+		msg.Content = strings.Join(parts[*msg.ID], "\n\n")
+		stripped = append(stripped, msg)
+	}
+	return stripped
+}
+
+// syncMessages rebuilds the messages of a saved conversation from its content
+func syncMessages(ctx context.Context, repo *repository.MessageRepository, conv *models.Conversation) error {
+	return repo.Replace(ctx, *conv.ID, conv.Source, parseMessages(conv.Source, conv.Content))
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+)
+
+// DefaultGraphDepth is the number of relations followed from the root of a
+// graph when the request does not say
+const DefaultGraphDepth = 2
+
+// MaxGraphDepth bounds the requested graph depth
+const MaxGraphDepth = 5
+
+// maxGraphNodes bounds the number of conversations of a graph
+const maxGraphNodes = 200
+
+var (
+	// ErrInvalidRelation is returned for a relation of an unknown type, or
+	// from a conversation to itself
+	ErrInvalidRelation = errors.New("a relation needs a known type and two different conversations")
+	// ErrRelationExists is returned when the conversations already have the relation
+	ErrRelationExists = errors.New("the conversations already have this relation")
+)
+
+// RelationService manages typed relations between conversations. A relation
+// is visible to whoever can read both of its conversations, and can be changed
+// by whoever can change either of them.
+type RelationService struct {
+	pool          *pgxpool.Pool
+	repo          *repository.RelationRepository
+	conversations *repository.ConversationRepository
+	audit         *AuditService
+	workspaces    *WorkspaceService
+}
+
+func NewRelationService(
+	pool *pgxpool.Pool,
+	repo *repository.RelationRepository,
+	conversations *repository.ConversationRepository,
+	audit *AuditService,
+	workspaces *WorkspaceService,
+) *RelationService {
+	return &RelationService{
+		pool:          pool,
+		repo:          repo,
+		conversations: conversations,
+		audit:         audit,
+		workspaces:    workspaces,
+	}
+}
+
+// List returns the relations of a conversation to the conversations the user
+// can read, or ErrNotFound if they cannot read it
+func (s *RelationService) List(ctx context.Context, userID, conversationID int) ([]models.ConversationRelation, error) {
+	if _, err := s.conversation(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByConversations(ctx, userID, []int{conversationID})
+}
+
+// Get returns a relation between conversations the user can read, or ErrNotFound
+func (s *RelationService) Get(ctx context.Context, userID, id int) (*models.ConversationRelation, error) {
+	relation, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if relation == nil {
+		return nil, ErrNotFound
+	}
+	for _, conversationID := range []int{relation.SourceID, relation.TargetID} {
+		if _, err := s.conversation(ctx, userID, conversationID); err != nil {
+			return nil, err
+		}
+	}
+	return relation, nil
+}
+
+// Create relates a conversation the user can change to another one they can
+// read. It returns ErrNotFound if they cannot read either, ErrForbidden if
+// they can only view the first one, and ErrRelationExists if the relation exists.
+func (s *RelationService) Create(ctx context.Context, actor models.Actor, conversationID int, req *models.CreateRelationRequest) (*models.ConversationRelation, error) {
+	if !models.IsValidRelationType(req.Type) || req.TargetID == conversationID {
+		return nil, ErrInvalidRelation
+	}
+
+	relation := &models.ConversationRelation{
+		UserID:   actor.UserID,
+		SourceID: conversationID,
+		TargetID: req.TargetID,
+		Type:     req.Type,
+		Note:     req.Note,
+	}
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		source, err := s.conversation(ctx, actor.UserID, conversationID)
+		if err != nil {
+			return err
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, source.OwnerID, source.CollectionID); err != nil {
+			return err
+		}
+		if _, err := s.conversation(ctx, actor.UserID, req.TargetID); err != nil {
+			return err
+		}
+		return s.create(ctx, actor, relation)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return relation, nil
+}
+
+// Update changes the type and note of a relation. A relation made symmetric
+// is stored with the lower conversation ID as source.
+func (s *RelationService) Update(ctx context.Context, actor models.Actor, id int, req *models.UpdateRelationRequest) (*models.ConversationRelation, error) {
+	if !models.IsValidRelationType(req.Type) {
+		return nil, ErrInvalidRelation
+	}
+
+	var relation *models.ConversationRelation
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.Get(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if err := s.authorizeWrite(ctx, actor.UserID, existing); err != nil {
+			return err
+		}
+
+		next := *existing
+		next.Type = req.Type
+		next.Note = req.Note
+		normalizeRelation(&next)
+		if err := s.repo.Update(ctx, &next); err != nil {
+			if errors.Is(err, repository.ErrDuplicate) {
+				return ErrRelationExists
+			}
+			return err
+		}
+		relation = &next
+		return s.audit.Record(ctx, actor, existing.UserID, models.AuditActionUpdate, models.EntityRelation, id, existing, relation)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return relation, nil
+}
+
+// Delete removes a relation
+func (s *RelationService) Delete(ctx context.Context, actor models.Actor, id int) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.Get(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if err := s.authorizeWrite(ctx, actor.UserID, existing); err != nil {
+			return err
+		}
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, existing.UserID, models.AuditActionDelete, models.EntityRelation, id, existing, nil)
+	})
+}
+
+// Graph returns the conversations the user can read within depth relations of
+// a conversation, and the relations between them, or ErrNotFound if they
+// cannot read the conversation. Nodes are ordered by depth, edges by age.
+func (s *RelationService) Graph(ctx context.Context, userID, id, depth int) (*models.ConversationGraph, error) {
+	if _, err := s.conversation(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	graph := &models.ConversationGraph{RootID: id}
+	depths := map[int]int{id: 0}
+	edges := map[int]models.ConversationRelation{}
+	frontier := []int{id}
+	for level := 1; len(frontier) > 0; level++ {
+		relations, err := s.repo.ListByConversations(ctx, userID, frontier)
+		if err != nil {
+			return nil, err
+		}
+		if level > depth {
+			// Past the depth limit, only tell whether anything was left out
+			for _, relation := range relations {
+				if _, ok := depths[relation.SourceID]; !ok {
+					graph.Truncated = true
+				}
+				if _, ok := depths[relation.TargetID]; !ok {
+					graph.Truncated = true
+				}
+			}
+			break
+		}
+
+		frontier = nil
+		for _, relation := range relations {
+			edges[*relation.ID] = relation
+			for _, other := range []int{relation.SourceID, relation.TargetID} {
+				if _, ok := depths[other]; ok {
+					continue
+				}
+				if len(depths) >= maxGraphNodes {
+					graph.Truncated = true
+					continue
+				}
+				depths[other] = level
+				frontier = append(frontier, other)
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(depths))
+	for nodeID := range depths {
+		ids = append(ids, nodeID)
+	}
+	nodes, err := s.repo.Nodes(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range nodes {
+		nodes[i].Depth = depths[nodes[i].ID]
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Depth != nodes[j].Depth {
+			return nodes[i].Depth < nodes[j].Depth
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	graph.Nodes = nodes
+
+	graph.Edges = []models.ConversationRelation{}
+	for _, relation := range edges {
+		_, hasSource := depths[relation.SourceID]
+		_, hasTarget := depths[relation.TargetID]
+		if hasSource && hasTarget {
+			graph.Edges = append(graph.Edges, relation)
+		}
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		return *graph.Edges[i].ID < *graph.Edges[j].ID
+	})
+	return graph, nil
+}
+
+// importBackup restores a backed up relation between two conversations. A
+// relation already there is kept, and reported as updated.
+func (s *RelationService) importBackup(ctx context.Context, actor models.Actor, source, target *models.Conversation, item *models.BackupRelation) (bool, error) {
+	if !models.IsValidRelationType(item.Type) || *source.ID == *target.ID {
+		return false, ErrInvalidRelation
+	}
+
+	relation := &models.ConversationRelation{
+		UserID:    actor.UserID,
+		SourceID:  *source.ID,
+		TargetID:  *target.ID,
+		Type:      item.Type,
+		Note:      item.Note,
+		CreatedAt: item.CreatedAt,
+	}
+	normalizeRelation(relation)
+	var updated bool
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.Find(ctx, relation.SourceID, relation.TargetID, relation.Type)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			updated = true
+			return nil
+		}
+		if err := s.authorizeWrite(ctx, actor.UserID, relation); err != nil {
+			return err
+		}
+		return s.create(ctx, actor, relation)
+	})
+	return updated, err
+}
+
+// create inserts a relation, stored in its normal direction, and records its creation
+func (s *RelationService) create(ctx context.Context, actor models.Actor, relation *models.ConversationRelation) error {
+	normalizeRelation(relation)
+	if err := s.repo.Create(ctx, relation); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return ErrRelationExists
+		}
+		return err
+	}
+	return s.audit.Record(ctx, actor, relation.UserID, models.AuditActionCreate, models.EntityRelation, *relation.ID, nil, relation)
+}
+
+// authorizeWrite returns ErrForbidden unless the user may change one of the
+// conversations of a relation
+func (s *RelationService) authorizeWrite(ctx context.Context, userID int, relation *models.ConversationRelation) error {
+	err := ErrForbidden
+	for _, conversationID := range []int{relation.SourceID, relation.TargetID} {
+		conv, getErr := s.conversation(ctx, userID, conversationID)
+		if getErr != nil {
+			return getErr
+		}
+		if err = s.workspaces.AuthorizeItemWrite(ctx, userID, conv.OwnerID, conv.CollectionID); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// conversation returns a conversation the user can read, or ErrNotFound
+func (s *RelationService) conversation(ctx context.Context, userID, id int) (*models.Conversation, error) {
+	conv, err := s.conversations.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, ErrNotFound
+	}
+	return conv, nil
+}
+
+// normalizeRelation stores symmetric relations with the lower conversation ID
+// as source, so that each is stored once
+func normalizeRelation(relation *models.ConversationRelation) {
+	if models.IsSymmetricRelation(relation.Type) && relation.SourceID > relation.TargetID {
+		relation.SourceID, relation.TargetID = relation.TargetID, relation.SourceID
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+)
+
+// segmentBackfillSize is the number of conversations saved before message
+// segments existed that get them on each search leaving reasoning out
+const segmentBackfillSize = 500
+
+// answerKinds are the segment kinds kept when reasoning is left out
+var answerKinds = []string{models.SegmentKindAnswer, models.SegmentKindCitation}
+
+// Segments returns the message segments of a conversation the user can read,
+// or nil if there is no such conversation. Conversations saved before
+// segments existed are segmented on first access.
+func (s *ConversationService) Segments(ctx context.Context, userID, id int, filters models.SegmentFilters) (*models.SegmentList, error) {
+	var list *models.SegmentList
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		conv, err := s.repo.GetByID(ctx, userID, id)
+		if err != nil || conv == nil {
+			return err
+		}
+
+		if _, err := s.ensureSegments(ctx, conv); err != nil {
+			return err
+		}
+
+		segments, err := s.messages.ListSegments(ctx, id, filters)
+		if err != nil {
+			return err
+		}
+		list = &models.SegmentList{ConversationID: id, Segments: segments}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Export returns a conversation the user can read as a Markdown document, or
+// nil if there is no such conversation: its title, URL and creation date, then
+// its messages under a heading naming their speaker. With excludeReasoning,
+// the reasoning traces and tool calls of the messages are left out.
+func (s *ConversationService) Export(ctx context.Context, userID, id int, excludeReasoning bool) (*models.Conversation, string, error) {
+	var conv *models.Conversation
+	var document string
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		var err error
+		conv, err = s.repo.GetByID(ctx, userID, id)
+		if err != nil || conv == nil {
+			return err
+		}
+
+		if _, err := s.ensureSegments(ctx, conv); err != nil {
+			return err
+		}
+
+		messages, err := s.messages.List(ctx, id, models.MessageFilters{})
+		if err != nil {
+			return err
+		}
+		if excludeReasoning {
+			kept, err := s.messages.ListSegments(ctx, id, models.SegmentFilters{Kinds: answerKinds})
+			if err != nil {
+				return err
+			}
+			messages = stripReasoning(messages, kept)
+		}
+		document = exportMarkdown(conv, messages)
+		return nil
+	})
+	if err != nil || conv == nil {
+		return nil, "", err
+	}
+	return conv, document, nil
+}
+
+// exportMarkdown writes a conversation and its messages as Markdown. Headings
+// are speaker markers that messages are parsed from (see pkg/transcript), so
+// an exported conversation saved again keeps its messages.
+func exportMarkdown(conv *models.Conversation, messages []models.Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", conv.Title)
+	if conv.CanonicalURL != "" {
+		fmt.Fprintf(&b, "%s\n\n", conv.CanonicalURL)
+	}
+	fmt.Fprintf(&b, "Saved from %s on %s\n", conv.Source, conv.CreatedAt.UTC().Format("2006-01-02 15:04 UTC"))
+
+	for _, msg := range messages {
+		b.WriteString("\n")
+		if msg.Role != models.MessageRoleUnknown {
+			heading := strings.ToUpper(msg.Role[:1]) + msg.Role[1:]
+			if msg.Model != nil {
+				heading += " (" + *msg.Model + ")"
+			}
+			fmt.Fprintf(&b, "## %s\n\n", heading)
+		}
+		fmt.Fprintf(&b, "%s\n", msg.Content)
+	}
+	return b.String()
+}
+
+// ensureSegments splits the content of a conversation into messages and
+// segments if it was saved before they existed, and returns its number of
+// messages
+func (s *ConversationService) ensureSegments(ctx context.Context, conv *models.Conversation) (int, error) {
+	total, err := s.messages.Count(ctx, *conv.ID)
+	if err != nil || conv.Content == "" {
+		return total, err
+	}
+	if total > 0 {
+		segmented, err := s.messages.CountSegments(ctx, *conv.ID)
+		if err != nil || segmented > 0 {
+			return total, err
+		}
+	}
+	if err := syncMessages(ctx, s.messages, conv); err != nil {
+		return 0, err
+	}
+	return s.messages.Count(ctx, *conv.ID)
+}
+
+// backfillSegments splits into segments the messages of conversations the
+// user can read that were saved before segments existed, so that searches
+// leaving reasoning out find them
+func (s *ConversationService) backfillSegments(ctx context.Context, userID int) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		unsegmented, err := s.repo.ListUnsegmented(ctx, userID, segmentBackfillSize)
+		if err != nil {
+			return err
+		}
+		for i := range unsegmented {
+			if err := syncMessages(ctx, s.messages, &unsegmented[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
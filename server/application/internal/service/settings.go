@@ -2,24 +2,106 @@ package service
 
 import (
 	"context"
+	"errors"
+	"strings"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/mergepatch"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
 )
 
 type SettingsService struct {
-	repo *repository.SettingsRepository
+	pool  *pgxpool.Pool
+	repo  *repository.SettingsRepository
+	audit *AuditService
 }
 
-func NewSettingsService(repo *repository.SettingsRepository) *SettingsService {
-	return &SettingsService{repo: repo}
+func NewSettingsService(pool *pgxpool.Pool, repo *repository.SettingsRepository, audit *AuditService) *SettingsService {
+	return &SettingsService{pool: pool, repo: repo, audit: audit}
 }
 
-func (s *SettingsService) Get(ctx context.Context) (*models.Settings, error) {
-	return s.repo.Get(ctx)
+func (s *SettingsService) Get(ctx context.Context, userID int) (*models.Settings, error) {
+	return s.repo.Get(ctx, userID)
 }
 
-func (s *SettingsService) Update(ctx context.Context, settings *models.Settings) error {
-	return s.repo.Update(ctx, settings)
+// Update replaces the user's settings. It returns a ConflictError if ifMatch
+// does not match the current settings, which are version 0 until first saved.
+func (s *SettingsService) Update(ctx context.Context, actor models.Actor, settings *models.Settings, ifMatch models.IfMatch) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.Get(ctx, actor.UserID)
+		if err != nil {
+			return err
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		protectSecrets(existing, settings)
+		settings.Version = existing.Version + 1
+		if err := s.repo.Update(ctx, actor.UserID, settings); err != nil {
+			if errors.Is(err, repository.ErrStaleVersion) {
+				current, err := s.repo.Get(ctx, actor.UserID)
+				if err != nil {
+					return err
+				}
+				return &ConflictError{Current: current}
+			}
+			return err
+		}
+
+		// Get returns unsaved defaults when the user has no settings row yet
+		if existing.ID == nil {
+			return s.audit.Record(ctx, actor, actor.UserID, models.AuditActionCreate, models.EntitySettings, *settings.ID, nil, settings)
+		}
+		return s.audit.Record(ctx, actor, actor.UserID, models.AuditActionUpdate, models.EntitySettings, *settings.ID, existing, settings)
+	})
+}
+
+// settingsReadOnlyFields are the members a patch may not change
+var settingsReadOnlyFields = []string{"id", "version", "created_at", "updated_at"}
+
+// Patch applies a JSON Merge Patch to the user's settings and returns the
+// result, with the errors of Update. A null api_key clears the stored key.
+func (s *SettingsService) Patch(ctx context.Context, actor models.Actor, patch []byte, ifMatch models.IfMatch) (*models.Settings, error) {
+	var settings models.Settings
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.Get(ctx, actor.UserID)
+		if err != nil {
+			return err
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+
+		if err := mergepatch.Apply(existing, patch, &settings, settingsReadOnlyFields...); err != nil {
+			return err
+		}
+		// The redacted key of existing is kept unless the patch removed it
+		if settings.APIKey == nil && existing.APIKey != nil {
+			cleared := ""
+			settings.APIKey = &cleared
+		}
+		// Update must apply to the version the patch was applied to
+		return s.Update(ctx, actor, &settings, models.IfMatch{existing.ETag()})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
 }
 
+// protectSecrets replaces the API key of incoming with its redacted form.
+// An omitted key or an echoed redacted value keeps the stored secret; an empty
+// string clears it.
+func protectSecrets(existing, incoming *models.Settings) {
+	switch {
+	case incoming.APIKey == nil || auth.IsRedacted(*incoming.APIKey):
+		incoming.APIKey = existing.APIKey
+	case strings.TrimSpace(*incoming.APIKey) == "":
+		incoming.APIKey = nil
+	default:
+		hint := auth.RedactSecret(*incoming.APIKey)
+		incoming.APIKey = &hint
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
+)
+
+var (
+	// ErrShareNotFound is returned for unknown, expired or revoked share tokens,
+	// and when the shared item no longer exists
+	ErrShareNotFound = errors.New("share link not found")
+	// ErrSharePasswordRequired is returned when a protected link is opened without a password
+	ErrSharePasswordRequired = errors.New("password required")
+	// ErrSharePasswordInvalid is returned when a protected link is opened with a wrong password
+	ErrSharePasswordInvalid = errors.New("invalid password")
+)
+
+type ShareService struct {
+	links         *repository.ShareLinkRepository
+	conversations *repository.ConversationRepository
+	snippets      *repository.SnippetRepository
+	workspaces    *WorkspaceService
+}
+
+func NewShareService(
+	links *repository.ShareLinkRepository,
+	conversations *repository.ConversationRepository,
+	snippets *repository.SnippetRepository,
+	workspaces *WorkspaceService,
+) *ShareService {
+	return &ShareService{
+		links:         links,
+		conversations: conversations,
+		snippets:      snippets,
+		workspaces:    workspaces,
+	}
+}
+
+func (s *ShareService) List(ctx context.Context, userID int, entityType string, entityID int) ([]models.ShareLink, error) {
+	return s.links.List(ctx, userID, entityType, entityID)
+}
+
+// Create shares a conversation or snippet the user can edit. The clear-text token
+// is only returned here. It returns ErrNotFound if the item does not exist, and
+// ErrForbidden if the user can only view it.
+func (s *ShareService) Create(ctx context.Context, userID int, entityType string, entityID int, req *models.CreateShareLinkRequest) (*models.CreateShareLinkResponse, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	if err := s.authorize(ctx, userID, entityType, entityID); err != nil {
+		return nil, err
+	}
+
+	token, prefix, err := auth.GenerateShareToken()
+	if err != nil {
+		return nil, err
+	}
+
+	link := models.ShareLink{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Prefix:     prefix,
+		TokenHash:  auth.HashToken(token),
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if req.Password != nil {
+		if len(*req.Password) < auth.MinPasswordLength {
+			return nil, fmt.Errorf("password must be at least %d characters", auth.MinPasswordLength)
+		}
+		hash, err := auth.HashPassword(*req.Password)
+		if err != nil {
+			return nil, err
+		}
+		link.PasswordHash = &hash
+	}
+
+	if err := s.links.Create(ctx, userID, &link); err != nil {
+		return nil, err
+	}
+
+	return &models.CreateShareLinkResponse{ShareLink: link, Token: token, Path: "/s/" + token}, nil
+}
+
+func (s *ShareService) Revoke(ctx context.Context, userID int, entityType string, entityID, id int) (bool, error) {
+	return s.links.Revoke(ctx, userID, entityType, entityID, id)
+}
+
+// View resolves a share token to the shared item and counts the view.
+// password is only checked for protected links.
+func (s *ShareService) View(ctx context.Context, token, password string) (*models.SharedItem, error) {
+	link, err := s.links.GetByTokenHash(ctx, auth.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if link == nil || !link.IsActive(time.Now()) {
+		return nil, ErrShareNotFound
+	}
+
+	if link.PasswordHash != nil {
+		if password == "" {
+			return nil, ErrSharePasswordRequired
+		}
+		if !auth.CheckPassword(*link.PasswordHash, password) {
+			return nil, ErrSharePasswordInvalid
+		}
+	}
+
+	item, err := s.sharedItem(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrShareNotFound
+	}
+
+	if item.ViewCount, err = s.links.RecordView(ctx, *link.ID); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// authorize returns ErrNotFound if the user cannot see the item, and
+// ErrForbidden if they cannot edit it
+func (s *ShareService) authorize(ctx context.Context, userID int, entityType string, entityID int) error {
+	switch entityType {
+	case models.EntityConversation:
+		conv, err := s.conversations.GetByID(ctx, userID, entityID)
+		if err != nil {
+			return err
+		}
+		if conv == nil {
+			return ErrNotFound
+		}
+		return s.workspaces.AuthorizeItemWrite(ctx, userID, conv.OwnerID, conv.CollectionID)
+	case models.EntitySnippet:
+		snippet, err := s.snippets.GetByID(ctx, userID, entityID)
+		if err != nil {
+			return err
+		}
+		if snippet == nil {
+			return ErrNotFound
+		}
+		return s.workspaces.AuthorizeItemWrite(ctx, userID, snippet.OwnerID, snippet.CollectionID)
+	default:
+		return fmt.Errorf("entity type %s cannot be shared", entityType)
+	}
+}
+
+// sharedItem loads the item a link points to, or nil if it was deleted
+func (s *ShareService) sharedItem(ctx context.Context, link *models.ShareLink) (*models.SharedItem, error) {
+	switch link.EntityType {
+	case models.EntityConversation:
+		conv, err := s.conversations.GetByID(ctx, link.UserID, link.EntityID)
+		if err != nil || conv == nil {
+			return nil, err
+		}
+		return &models.SharedItem{
+			EntityType: link.EntityType,
+			Title:      conv.Title,
+			Source:     conv.Source,
+			Tags:       conv.Tags,
+			Content:    conv.Content,
+			CreatedAt:  conv.CreatedAt,
+			UpdatedAt:  conv.UpdatedAt,
+		}, nil
+	case models.EntitySnippet:
+		snippet, err := s.snippets.GetByID(ctx, link.UserID, link.EntityID)
+		if err != nil || snippet == nil {
+			return nil, err
+		}
+		item := &models.SharedItem{
+			EntityType: link.EntityType,
+			Title:      snippet.Title,
+			Tags:       snippet.Tags,
+			Content:    snippet.Content,
+			CreatedAt:  snippet.CreatedAt,
+			UpdatedAt:  snippet.CreatedAt,
+		}
+		if snippet.Language != nil {
+			item.Language = *snippet.Language
+		}
+		return item, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/transcript"
+)
+
+// ShrinkGuardConfig holds the limits on how much a save may shrink the stored
+// content of a conversation before it is rejected with a ShrinkError
+type ShrinkGuardConfig struct {
+	Enabled bool
+	// MaxDropRatio is the largest share of the stored content, between 0 and 1,
+	// that a save may remove
+	MaxDropRatio float64
+	// MinDropBytes is the number of bytes a save may always remove, so that
+	// short conversations can be edited freely
+	MinDropBytes int
+	// CheckTurns rejects saves with fewer speaker turns than the stored content
+	CheckTurns bool
+}
+
+// Shrink guard reasons
+const (
+	ShrinkReasonSize  = "size"
+	ShrinkReasonTurns = "turns"
+)
+
+// ShrinkError is returned when a save would lose more of the stored content
+// than the shrink guard allows, as when a broken extractor captures only a
+// fragment of the page. Saving again with force set overrides the guard.
+type ShrinkError struct {
+	Reason         string
+	StoredLength   int
+	Length         int
+	StoredMessages int
+	Messages       int
+}
+
+func (e *ShrinkError) Error() string {
+	if e.Reason == ShrinkReasonTurns {
+		return fmt.Sprintf("content would drop from %d to %d messages", e.StoredMessages, e.Messages)
+	}
+	return fmt.Sprintf("content would shrink from %d to %d bytes", e.StoredLength, e.Length)
+}
+
+// checkShrink returns a ShrinkError if replacing stored with content loses
+// more than the guard allows
+func (g ShrinkGuardConfig) checkShrink(stored, content string) error {
+	if !g.Enabled {
+		return nil
+	}
+
+	drop := len(stored) - len(content)
+	if drop > g.MinDropBytes && float64(drop) > g.MaxDropRatio*float64(len(stored)) {
+		return g.shrinkError(ShrinkReasonSize, stored, content)
+	}
+
+	if g.CheckTurns && drop > 0 {
+		storedTurns := countTurns(stored)
+		// Content without speaker markers has no turns to compare
+		if storedTurns >= 2 && countTurns(content) < storedTurns {
+			return g.shrinkError(ShrinkReasonTurns, stored, content)
+		}
+	}
+	return nil
+}
+
+func (g ShrinkGuardConfig) shrinkError(reason, stored, content string) *ShrinkError {
+	return &ShrinkError{
+		Reason:         reason,
+		StoredLength:   len(stored),
+		Length:         len(content),
+		StoredMessages: countTurns(stored),
+		Messages:       countTurns(content),
+	}
+}
+
+// countTurns returns the number of messages of content with a known speaker
+func countTurns(content string) int {
+	turns := 0
+	for _, msg := range transcript.Parse(content) {
+		if msg.Role != transcript.RoleUnknown {
+			turns++
+		}
+	}
+	return turns
+}
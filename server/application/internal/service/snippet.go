@@ -2,29 +2,40 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
 	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/mergepatch"
 )
 
+// ErrSourceNotReadable is returned when a snippet is taken from a
+// conversation the user cannot read
+var ErrSourceNotReadable = errors.New("source_conversation_id does not refer to a conversation you can read")
+
 type SnippetService struct {
-	repo *repository.SnippetRepository
+	pool          *pgxpool.Pool
+	repo          *repository.SnippetRepository
+	conversations *repository.ConversationRepository
+	audit         *AuditService
+	workspaces    *WorkspaceService
 }
 
-func NewSnippetService(repo *repository.SnippetRepository) *SnippetService {
-	return &SnippetService{repo: repo}
+func NewSnippetService(pool *pgxpool.Pool, repo *repository.SnippetRepository, conversations *repository.ConversationRepository, audit *AuditService, workspaces *WorkspaceService) *SnippetService {
+	return &SnippetService{pool: pool, repo: repo, conversations: conversations, audit: audit, workspaces: workspaces}
 }
 
-func (s *SnippetService) GetByID(ctx context.Context, id int) (*models.Snippet, error) {
-	return s.repo.GetByID(ctx, id)
+func (s *SnippetService) GetByID(ctx context.Context, userID, id int) (*models.Snippet, error) {
+	return s.repo.GetByID(ctx, userID, id)
 }
 
-func (s *SnippetService) List(ctx context.Context, filters models.SnippetFilters) ([]models.Snippet, error) {
-	return s.repo.List(ctx, filters)
+func (s *SnippetService) List(ctx context.Context, userID int, filters models.SnippetFilters) ([]models.Snippet, error) {
+	return s.repo.List(ctx, userID, filters)
 }
 
-func (s *SnippetService) Create(ctx context.Context, snippet *models.Snippet) error {
+func (s *SnippetService) Create(ctx context.Context, actor models.Actor, snippet *models.Snippet) error {
 	// Validate required fields
 	if snippet.Title == "" {
 		return fmt.Errorf("title is required")
@@ -32,17 +43,148 @@ func (s *SnippetService) Create(ctx context.Context, snippet *models.Snippet) er
 	if snippet.Content == "" {
 		return fmt.Errorf("content is required")
 	}
-	return s.repo.Create(ctx, snippet)
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		if err := s.workspaces.AuthorizeFiling(ctx, actor.UserID, snippet.CollectionID); err != nil {
+			return err
+		}
+		if err := checkSource(ctx, s.conversations, actor.UserID, snippet.SourceConversationID); err != nil {
+			return err
+		}
+		if err := s.repo.Create(ctx, actor.UserID, snippet); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, actor.UserID, models.AuditActionCreate, models.EntitySnippet, *snippet.ID, nil, snippet)
+	})
 }
 
-func (s *SnippetService) Update(ctx context.Context, snippet *models.Snippet) error {
+// Update replaces a snippet. It returns ErrNotFound if the snippet does not exist,
+// ErrForbidden if the user can only view it, and a ConflictError if ifMatch
+// does not match it.
+func (s *SnippetService) Update(ctx context.Context, actor models.Actor, snippet *models.Snippet, ifMatch models.IfMatch) error {
 	if snippet.ID == nil {
 		return fmt.Errorf("id is required for update")
 	}
-	return s.repo.Update(ctx, snippet)
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, *snippet.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrNotFound
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, existing.OwnerID, existing.CollectionID); err != nil {
+			return err
+		}
+		if !sameID(existing.CollectionID, snippet.CollectionID) {
+			if err := s.workspaces.AuthorizeFiling(ctx, actor.UserID, snippet.CollectionID); err != nil {
+				return err
+			}
+		}
+		if !sameID(existing.SourceConversationID, snippet.SourceConversationID) {
+			if err := checkSource(ctx, s.conversations, actor.UserID, snippet.SourceConversationID); err != nil {
+				return err
+			}
+		}
+		snippet.OwnerID = existing.OwnerID
+		snippet.CreatedAt = existing.CreatedAt
+		snippet.Version = existing.Version + 1
+		if err := s.repo.Update(ctx, actor.UserID, snippet); err != nil {
+			return s.conflict(ctx, actor.UserID, *snippet.ID, err)
+		}
+		return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionUpdate, models.EntitySnippet, *snippet.ID, existing, snippet)
+	})
+}
+
+// snippetReadOnlyFields are the members a patch may not change
+var snippetReadOnlyFields = []string{"id", "owner_id", "version", "created_at", "deleted_at"}
+
+// Patch applies a JSON Merge Patch to a snippet and returns the result, with
+// the errors of Update
+func (s *SnippetService) Patch(ctx context.Context, actor models.Actor, id int, patch []byte, ifMatch models.IfMatch) (*models.Snippet, error) {
+	var snippet models.Snippet
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrNotFound
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+
+		if err := mergepatch.Apply(existing, patch, &snippet, snippetReadOnlyFields...); err != nil {
+			return err
+		}
+		if snippet.Title == "" {
+			return fmt.Errorf("title is required")
+		}
+		if snippet.Content == "" {
+			return fmt.Errorf("content is required")
+		}
+		// Update must apply to the version the patch was applied to
+		return s.Update(ctx, actor, &snippet, models.IfMatch{existing.ETag()})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &snippet, nil
+}
+
+// Delete moves a snippet to the trash (see TrashService). Deleting a missing
+// snippet is a no-op. It returns ErrForbidden if the user can only view the
+// snippet, and a ConflictError if ifMatch does not match it.
+func (s *SnippetService) Delete(ctx context.Context, actor models.Actor, id int, ifMatch models.IfMatch) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.repo.GetByID(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if !ifMatch.Matches(existing.ETag()) {
+			return &ConflictError{Current: existing}
+		}
+		if existing == nil {
+			return nil
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, existing.OwnerID, existing.CollectionID); err != nil {
+			return err
+		}
+		if err := s.repo.Trash(ctx, actor.UserID, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionDelete, models.EntitySnippet, id, existing, nil)
+	})
 }
 
-func (s *SnippetService) Delete(ctx context.Context, id int) error {
-	return s.repo.Delete(ctx, id)
+// conflict turns ErrStaleVersion from an update into a ConflictError with the
+// snippet as stored now, and returns other errors as is
+// checkSource returns ErrSourceNotReadable unless the user can read the
+// conversation sourceID, when set
+func checkSource(ctx context.Context, conversations *repository.ConversationRepository, userID int, sourceID *int) error {
+	if sourceID == nil {
+		return nil
+	}
+	conv, err := conversations.GetByID(ctx, userID, *sourceID)
+	if err != nil {
+		return err
+	}
+	if conv == nil {
+		return ErrSourceNotReadable
+	}
+	return nil
 }
 
+func (s *SnippetService) conflict(ctx context.Context, userID, id int, err error) error {
+	if !errors.Is(err, repository.ErrStaleVersion) {
+		return err
+	}
+	current, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	return &ConflictError{Current: current}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/sources"
+)
+
+// CanonicalizeResult counts what CanonicalizeURLs changed
+type CanonicalizeResult struct {
+	// Rewritten conversations got a new canonical URL, share URL or source
+	Rewritten int
+	// Merged conversations had the canonical URL of another conversation of
+	// their owner and were folded into it
+	Merged int
+}
+
+// canonicalize rewrites the URLs of conv to their canonical form (see
+// sources.Canonicalize), and sets its source when a known provider serves it
+func canonicalize(conv *models.Conversation) {
+	var source *sources.Source
+	conv.CanonicalURL, source = sources.Canonicalize(conv.CanonicalURL)
+	if source != nil {
+		conv.Source = source.ID
+	}
+	if conv.ShareURL != nil {
+		shareURL, _ := sources.Canonicalize(*conv.ShareURL)
+		conv.ShareURL = &shareURL
+	}
+}
+
+// CanonicalizeURLs rewrites the URLs of the conversations saved before the
+// source registry, or before a change of its rules, to their canonical form.
+// The former canonical URL becomes an alias of the conversation. A
+// conversation whose new URL is already taken by another conversation of its
+// owner is merged into that one (see Merge). Conversations are read batchSize
+// at a time, and each is changed in its own transaction, so the job can run
+// while the server is serving requests and be run again if interrupted.
+func (s *ConversationService) CanonicalizeURLs(ctx context.Context, batchSize int) (*CanonicalizeResult, error) {
+	result := &CanonicalizeResult{}
+	afterID := 0
+	for {
+		batch, err := s.repo.ListAfter(ctx, afterID, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+
+		for i := range batch {
+			conv := &batch[i]
+			afterID = *conv.ID
+			changed, merged, err := s.canonicalizeStored(ctx, conv)
+			if err != nil {
+				return result, err
+			}
+			switch {
+			case merged:
+				result.Merged++
+			case changed:
+				result.Rewritten++
+			}
+		}
+	}
+}
+
+// canonicalizeStored canonicalizes the URLs of a stored conversation. It
+// reports whether they changed, and whether the conversation was merged into
+// another one because of it.
+func (s *ConversationService) canonicalizeStored(ctx context.Context, existing *models.Conversation) (changed, merged bool, err error) {
+	next := *existing
+	canonicalize(&next)
+	if next.CanonicalURL == existing.CanonicalURL && next.Source == existing.Source &&
+		stringValue(next.ShareURL) == stringValue(existing.ShareURL) {
+		return false, false, nil
+	}
+
+	// The job acts on behalf of the owner of each conversation
+	actor := models.Actor{UserID: existing.OwnerID}
+	err = repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		if existing.DeletedAt == nil {
+			holder, err := s.repo.GetByCanonicalURL(ctx, existing.OwnerID, next.CanonicalURL)
+			if err != nil {
+				return err
+			}
+			if holder != nil && *holder.ID != *existing.ID {
+				merged = true
+				_, err := s.Merge(ctx, actor, *holder.ID, *existing.ID, nil)
+				return err
+			}
+		}
+
+		if err := s.repo.SetURLs(ctx, &next); err != nil {
+			return err
+		}
+		if next.CanonicalURL != existing.CanonicalURL {
+			if err := s.repo.AddAlias(ctx, existing.OwnerID, existing.CanonicalURL, *existing.ID); err != nil {
+				return err
+			}
+		}
+		return s.audit.Record(ctx, actor, existing.OwnerID, models.AuditActionUpdate, models.EntityConversation, *existing.ID, existing, &next)
+	})
+	if err != nil {
+		return false, false, err
+	}
+	return true, merged, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/pricing"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/tokenizer"
+)
+
+// tokenBackfillSize is the number of conversations saved before token counts
+// existed that get counted on each token statistics request
+const tokenBackfillSize = 500
+
+// StatsService computes statistics over the conversations a user can read
+type StatsService struct {
+	pool          *pgxpool.Pool
+	repo          *repository.StatsRepository
+	conversations *repository.ConversationRepository
+	messages      *repository.MessageRepository
+	tokenizers    *tokenizer.Registry
+	prices        *pricing.Table
+}
+
+func NewStatsService(
+	pool *pgxpool.Pool,
+	repo *repository.StatsRepository,
+	conversations *repository.ConversationRepository,
+	messages *repository.MessageRepository,
+	tokenizers *tokenizer.Registry,
+	prices *pricing.Table,
+) *StatsService {
+	return &StatsService{
+		pool:          pool,
+		repo:          repo,
+		conversations: conversations,
+		messages:      messages,
+		tokenizers:    tokenizers,
+		prices:        prices,
+	}
+}
+
+// Tokens sums the tokens of the conversations the user can read, in total, by
+// source, by month and by source and month. Conversations saved before token
+// counts existed are counted first, a batch per request. Costs are estimated
+// when there is a price table; a group mixing sources only sums the cost of
+// those with a price.
+func (s *StatsService) Tokens(ctx context.Context, userID int, filters models.TokenStatsFilters) (*models.TokenStats, error) {
+	if err := s.backfillTokenCounts(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.repo.TokenUsage(ctx, userID, filters)
+	if err != nil {
+		return nil, err
+	}
+	uncounted, err := s.repo.CountUncounted(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.TokenStats{
+		BySource:      []models.TokenUsage{},
+		ByMonth:       []models.TokenUsage{},
+		BySourceMonth: rows,
+		Uncounted:     uncounted,
+		Tokenizers:    s.tokenizers.Mapping(),
+	}
+	if s.prices != nil {
+		currency := s.prices.Currency
+		stats.Currency = &currency
+	}
+
+	bySource := map[string]*models.TokenUsage{}
+	byMonth := map[string]*models.TokenUsage{}
+	for i := range rows {
+		row := &rows[i]
+		if price, ok := s.prices.ForSource(row.Source); ok {
+			cost := price.Cost(row.InputTokens, row.OutputTokens)
+			row.EstimatedCost = &cost
+		}
+
+		source, ok := bySource[row.Source]
+		if !ok {
+			source = &models.TokenUsage{Source: row.Source}
+			bySource[row.Source] = source
+		}
+		month, ok := byMonth[row.Month]
+		if !ok {
+			month = &models.TokenUsage{Month: row.Month}
+			byMonth[row.Month] = month
+		}
+		for _, usage := range []*models.TokenUsage{&stats.Total, source, month} {
+			addTokenUsage(usage, row)
+		}
+	}
+
+	for _, usage := range bySource {
+		stats.BySource = append(stats.BySource, *usage)
+	}
+	sort.Slice(stats.BySource, func(i, j int) bool { return stats.BySource[i].Source < stats.BySource[j].Source })
+	for _, usage := range byMonth {
+		stats.ByMonth = append(stats.ByMonth, *usage)
+	}
+	sort.Slice(stats.ByMonth, func(i, j int) bool { return stats.ByMonth[i].Month < stats.ByMonth[j].Month })
+
+	return stats, nil
+}
+
+// backfillTokenCounts counts the tokens of a batch of the user's conversations
+// saved before token counts existed, and of their messages
+func (s *StatsService) backfillTokenCounts(ctx context.Context, userID int) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		uncounted, err := s.conversations.ListUncounted(ctx, userID, tokenBackfillSize)
+		if err != nil {
+			return err
+		}
+		for i := range uncounted {
+			conv := &uncounted[i]
+			if err := s.conversations.SetTokenCount(ctx, conv); err != nil {
+				return err
+			}
+			if err := syncMessages(ctx, s.messages, conv); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addTokenUsage adds the counts and estimated cost of row to usage
+func addTokenUsage(usage *models.TokenUsage, row *models.TokenUsage) {
+	usage.Conversations += row.Conversations
+	usage.Tokens += row.Tokens
+	usage.InputTokens += row.InputTokens
+	usage.OutputTokens += row.OutputTokens
+	if row.EstimatedCost != nil {
+		cost := *row.EstimatedCost
+		if usage.EstimatedCost != nil {
+			cost += *usage.EstimatedCost
+		}
+		usage.EstimatedCost = &cost
+	}
+}
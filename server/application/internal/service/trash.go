@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+)
+
+// ErrRestoreConflict is returned when restoring a conversation whose canonical
+// URL, or a collection whose name, has been used by a new one meanwhile
+var ErrRestoreConflict = errors.New("a newer item with the same canonical_url or name exists")
+
+// TrashService manages deleted conversations, snippets and collections. They
+// keep their relationships while in the trash, so a restored conversation is
+// still the source of the snippets taken from it, and a restored collection
+// still holds the items filed in it. After the retention period, Purge deletes them.
+type TrashService struct {
+	pool          *pgxpool.Pool
+	conversations *repository.ConversationRepository
+	snippets      *repository.SnippetRepository
+	collections   *repository.CollectionRepository
+	audit         *AuditService
+	workspaces    *WorkspaceService
+	retention     time.Duration
+}
+
+func NewTrashService(
+	pool *pgxpool.Pool,
+	conversations *repository.ConversationRepository,
+	snippets *repository.SnippetRepository,
+	collections *repository.CollectionRepository,
+	audit *AuditService,
+	workspaces *WorkspaceService,
+	retention time.Duration,
+) *TrashService {
+	return &TrashService{
+		pool:          pool,
+		conversations: conversations,
+		snippets:      snippets,
+		collections:   collections,
+		audit:         audit,
+		workspaces:    workspaces,
+		retention:     retention,
+	}
+}
+
+// List returns what the user may restore from the trash, for the given
+// entity types only
+func (s *TrashService) List(ctx context.Context, userID int, entityTypes []string) (*models.Trash, error) {
+	trash := &models.Trash{}
+	for _, entityType := range entityTypes {
+		var err error
+		switch entityType {
+		case models.EntityConversation:
+			trash.Conversations, err = s.conversations.ListTrashed(ctx, userID)
+		case models.EntitySnippet:
+			trash.Snippets, err = s.snippets.ListTrashed(ctx, userID)
+		case models.EntityCollection:
+			trash.Collections, err = s.collections.ListTrashed(ctx, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return trash, nil
+}
+
+// RestoreConversation takes a conversation out of the trash. It returns
+// ErrNotFound if the user has no such conversation in the trash, ErrForbidden
+// if they can only view it, and ErrRestoreConflict if a conversation has been
+// saved from its canonical URL since.
+func (s *TrashService) RestoreConversation(ctx context.Context, actor models.Actor, id int) (*models.Conversation, error) {
+	var conv *models.Conversation
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		trashed, err := s.conversations.GetTrashed(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if trashed == nil {
+			return ErrNotFound
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, trashed.OwnerID, trashed.CollectionID); err != nil {
+			return err
+		}
+
+		conv, err = s.conversations.Restore(ctx, actor.UserID, id)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return ErrRestoreConflict
+		}
+		if err != nil {
+			return err
+		}
+		if conv == nil {
+			return ErrNotFound
+		}
+		return s.audit.Record(ctx, actor, trashed.OwnerID, models.AuditActionRestore, models.EntityConversation, id, trashed, conv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// RestoreSnippet takes a snippet out of the trash. It returns ErrNotFound if
+// the user has no such snippet in the trash, and ErrForbidden if they can only
+// view it.
+func (s *TrashService) RestoreSnippet(ctx context.Context, actor models.Actor, id int) (*models.Snippet, error) {
+	var snippet *models.Snippet
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		trashed, err := s.snippets.GetTrashed(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if trashed == nil {
+			return ErrNotFound
+		}
+		if err := s.workspaces.AuthorizeItemWrite(ctx, actor.UserID, trashed.OwnerID, trashed.CollectionID); err != nil {
+			return err
+		}
+
+		snippet, err = s.snippets.Restore(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if snippet == nil {
+			return ErrNotFound
+		}
+		return s.audit.Record(ctx, actor, trashed.OwnerID, models.AuditActionRestore, models.EntitySnippet, id, trashed, snippet)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snippet, nil
+}
+
+// RestoreCollection takes a collection out of the trash. It returns
+// ErrNotFound if the user has no such collection in the trash, ErrForbidden
+// unless they are an admin of its workspace, and ErrRestoreConflict if its
+// creator has made a collection with the same name since.
+func (s *TrashService) RestoreCollection(ctx context.Context, actor models.Actor, id int) (*models.Collection, error) {
+	var collection *models.Collection
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		trashed, err := s.collections.GetTrashed(ctx, actor.UserID, id)
+		if err != nil {
+			return err
+		}
+		if trashed == nil {
+			return ErrNotFound
+		}
+		if trashed.WorkspaceID != nil {
+			if err := s.workspaces.AuthorizeWorkspace(ctx, actor.UserID, *trashed.WorkspaceID, models.RoleAdmin); err != nil {
+				return err
+			}
+		}
+
+		collection, err = s.collections.Restore(ctx, actor.UserID, id)
+		if errors.Is(err, repository.ErrDuplicate) {
+			return ErrRestoreConflict
+		}
+		if err != nil {
+			return err
+		}
+		if collection == nil {
+			return ErrNotFound
+		}
+		return s.audit.Record(ctx, actor, trashed.OwnerID, models.AuditActionRestore, models.EntityCollection, id, trashed, collection)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// Purge deletes for good what has been in the trash for longer than the
+// retention period, and returns how many items there were. Snippets taken
+// from a purged conversation and items filed in a purged collection are kept.
+func (s *TrashService) Purge(ctx context.Context) (int64, error) {
+	before := time.Now().Add(-s.retention)
+
+	var purged int64
+	err := repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		conversations, err := s.conversations.Purge(ctx, before)
+		if err != nil {
+			return err
+		}
+		snippets, err := s.snippets.Purge(ctx, before)
+		if err != nil {
+			return err
+		}
+		collections, err := s.collections.Purge(ctx, before)
+		if err != nil {
+			return err
+		}
+		purged = conversations + snippets + collections
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
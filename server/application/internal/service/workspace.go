@@ -0,0 +1,387 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/models"
+	"github.com/mindflight/save-my-chat-llm/server/application/internal/repository"
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/auth"
+)
+
+// defaultInvitationTTL applies to invitations created without expires_at
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrLastAdmin is returned when a change would leave a workspace without admins
+	ErrLastAdmin = errors.New("a workspace needs at least one admin")
+	// ErrCollectionNotWritable is returned when an item is filed in a collection
+	// the user cannot edit
+	ErrCollectionNotWritable = errors.New("collection_id does not refer to a collection you can edit")
+	// ErrInvitationNotFound is returned for unknown, expired, revoked or already redeemed invitations
+	ErrInvitationNotFound = errors.New("invitation not found")
+)
+
+type WorkspaceService struct {
+	pool        *pgxpool.Pool
+	repo        *repository.WorkspaceRepository
+	invitations *repository.WorkspaceInvitationRepository
+	audit       *AuditService
+}
+
+func NewWorkspaceService(
+	pool *pgxpool.Pool,
+	repo *repository.WorkspaceRepository,
+	invitations *repository.WorkspaceInvitationRepository,
+	audit *AuditService,
+) *WorkspaceService {
+	return &WorkspaceService{
+		pool:        pool,
+		repo:        repo,
+		invitations: invitations,
+		audit:       audit,
+	}
+}
+
+func (s *WorkspaceService) List(ctx context.Context, userID int) ([]models.Workspace, error) {
+	return s.repo.List(ctx, userID)
+}
+
+// GetByID returns a workspace the user is a member of, or nil
+func (s *WorkspaceService) GetByID(ctx context.Context, userID, id int) (*models.Workspace, error) {
+	return s.repo.GetByID(ctx, userID, id)
+}
+
+// Create creates a workspace with the user as its admin
+func (s *WorkspaceService) Create(ctx context.Context, actor models.Actor, workspace *models.Workspace) error {
+	if workspace.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		workspace.Role = ""
+		if err := s.repo.Create(ctx, actor.UserID, workspace); err != nil {
+			return err
+		}
+		if err := s.audit.Record(ctx, actor, actor.UserID, models.AuditActionCreate, models.EntityWorkspace, *workspace.ID, nil, workspace); err != nil {
+			return err
+		}
+		workspace.Role = models.RoleAdmin
+		return s.setMember(ctx, actor, *workspace.ID, actor.UserID, models.RoleAdmin)
+	})
+}
+
+// Update renames a workspace. It requires the admin role.
+func (s *WorkspaceService) Update(ctx context.Context, actor models.Actor, workspace *models.Workspace) error {
+	if workspace.ID == nil {
+		return fmt.Errorf("id is required for update")
+	}
+	if workspace.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.authorize(ctx, actor.UserID, *workspace.ID, models.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		workspace.CreatedBy = existing.CreatedBy
+		workspace.CreatedAt = existing.CreatedAt
+		workspace.Role = existing.Role
+		if err := s.repo.Update(ctx, workspace); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, actor.UserID, models.AuditActionUpdate, models.EntityWorkspace, *workspace.ID, existing, workspace)
+	})
+}
+
+// Delete removes a workspace. It requires the admin role; deleting a workspace
+// the user is not a member of is a no-op.
+func (s *WorkspaceService) Delete(ctx context.Context, actor models.Actor, id int) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		existing, err := s.authorize(ctx, actor.UserID, id, models.RoleAdmin)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, actor.UserID, models.AuditActionDelete, models.EntityWorkspace, id, existing, nil)
+	})
+}
+
+// Members lists the members of a workspace the user is a member of
+func (s *WorkspaceService) Members(ctx context.Context, userID, workspaceID int) ([]models.WorkspaceMember, error) {
+	if _, err := s.authorize(ctx, userID, workspaceID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	return s.repo.Members(ctx, workspaceID)
+}
+
+// UpdateMember changes the role of a member. It requires the admin role.
+func (s *WorkspaceService) UpdateMember(ctx context.Context, actor models.Actor, workspaceID, memberID int, role string) error {
+	if !models.IsValidRole(role) {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		if err := s.repo.Lock(ctx, workspaceID); err != nil {
+			return err
+		}
+		if _, err := s.authorize(ctx, actor.UserID, workspaceID, models.RoleAdmin); err != nil {
+			return err
+		}
+		current, err := s.repo.Role(ctx, workspaceID, memberID)
+		if err != nil {
+			return err
+		}
+		if current == "" {
+			return ErrNotFound
+		}
+		if current == models.RoleAdmin && role != models.RoleAdmin {
+			if err := s.checkOtherAdmins(ctx, workspaceID); err != nil {
+				return err
+			}
+		}
+		return s.setMember(ctx, actor, workspaceID, memberID, role)
+	})
+}
+
+// RemoveMember removes a member from a workspace. Admins can remove anyone;
+// every member can leave.
+func (s *WorkspaceService) RemoveMember(ctx context.Context, actor models.Actor, workspaceID, memberID int) error {
+	return repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		if err := s.repo.Lock(ctx, workspaceID); err != nil {
+			return err
+		}
+		required := models.RoleAdmin
+		if memberID == actor.UserID {
+			required = models.RoleViewer
+		}
+		if _, err := s.authorize(ctx, actor.UserID, workspaceID, required); err != nil {
+			return err
+		}
+		current, err := s.repo.Role(ctx, workspaceID, memberID)
+		if err != nil {
+			return err
+		}
+		if current == "" {
+			return ErrNotFound
+		}
+		if current == models.RoleAdmin {
+			if err := s.checkOtherAdmins(ctx, workspaceID); err != nil {
+				return err
+			}
+		}
+		if err := s.repo.RemoveMember(ctx, workspaceID, memberID); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, actor, memberID, models.AuditActionDelete, models.EntityWorkspaceMember, workspaceID,
+			memberRole(memberID, current), nil)
+	})
+}
+
+// Invitations lists the invitations of a workspace. It requires the admin role.
+func (s *WorkspaceService) Invitations(ctx context.Context, userID, workspaceID int) ([]models.WorkspaceInvitation, error) {
+	if _, err := s.authorize(ctx, userID, workspaceID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+	return s.invitations.List(ctx, workspaceID)
+}
+
+// CreateInvitation creates an invitation to join the workspace with a role.
+// It requires the admin role. The clear-text token is only returned here.
+func (s *WorkspaceService) CreateInvitation(ctx context.Context, actor models.Actor, workspaceID int, req *models.CreateInvitationRequest) (*models.CreateInvitationResponse, error) {
+	if req.Role == "" {
+		req.Role = models.RoleViewer
+	}
+	if !models.IsValidRole(req.Role) {
+		return nil, fmt.Errorf("unknown role: %s", req.Role)
+	}
+	if req.ExpiresAt == nil {
+		expiresAt := time.Now().Add(defaultInvitationTTL)
+		req.ExpiresAt = &expiresAt
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	if _, err := s.authorize(ctx, actor.UserID, workspaceID, models.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	token, prefix, err := auth.GenerateInvitationToken()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := models.WorkspaceInvitation{
+		WorkspaceID: workspaceID,
+		Role:        req.Role,
+		Prefix:      prefix,
+		TokenHash:   auth.HashToken(token),
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if err := s.invitations.Create(ctx, actor.UserID, &invitation); err != nil {
+		return nil, err
+	}
+
+	return &models.CreateInvitationResponse{WorkspaceInvitation: invitation, Token: token}, nil
+}
+
+// RevokeInvitation revokes a pending invitation. It requires the admin role and
+// returns false if there is no such pending invitation.
+func (s *WorkspaceService) RevokeInvitation(ctx context.Context, actor models.Actor, workspaceID, id int) (bool, error) {
+	if _, err := s.authorize(ctx, actor.UserID, workspaceID, models.RoleAdmin); err != nil {
+		return false, err
+	}
+	return s.invitations.Revoke(ctx, workspaceID, id)
+}
+
+// AcceptInvitation redeems an invitation token and makes the user a member of
+// its workspace. Members who already have a higher role keep it.
+func (s *WorkspaceService) AcceptInvitation(ctx context.Context, actor models.Actor, token string) (*models.Workspace, error) {
+	invitation, err := s.invitations.GetByTokenHash(ctx, auth.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil || !invitation.IsPending(time.Now()) {
+		return nil, ErrInvitationNotFound
+	}
+
+	err = repository.WithTx(ctx, s.pool, func(ctx context.Context) error {
+		if err := s.repo.Lock(ctx, invitation.WorkspaceID); err != nil {
+			return err
+		}
+		accepted, err := s.invitations.Accept(ctx, *invitation.ID, actor.UserID)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return ErrInvitationNotFound
+		}
+
+		current, err := s.repo.Role(ctx, invitation.WorkspaceID, actor.UserID)
+		if err != nil {
+			return err
+		}
+		if models.RoleAllows(current, invitation.Role) {
+			return nil
+		}
+		return s.setMember(ctx, actor, invitation.WorkspaceID, actor.UserID, invitation.Role)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetByID(ctx, actor.UserID, invitation.WorkspaceID)
+}
+
+// AuthorizeCollection returns ErrForbidden unless the user has at least the
+// required role on a collection. Users are admins of their private collections.
+func (s *WorkspaceService) AuthorizeCollection(ctx context.Context, userID, collectionID int, required string) error {
+	role, err := s.repo.CollectionRole(ctx, userID, collectionID)
+	if err != nil {
+		return err
+	}
+	if !models.RoleAllows(role, required) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeItemWrite returns ErrForbidden unless the user may change a
+// conversation or snippet: they own it, or it is filed in a collection where
+// they are at least an editor
+func (s *WorkspaceService) AuthorizeItemWrite(ctx context.Context, userID, ownerID int, collectionID *int) error {
+	if ownerID == userID {
+		return nil
+	}
+	if collectionID == nil {
+		return ErrForbidden
+	}
+	return s.AuthorizeCollection(ctx, userID, *collectionID, models.RoleEditor)
+}
+
+// AuthorizeFiling returns ErrCollectionNotWritable unless the user may file an
+// item in the collection: one of their private collections, or a workspace
+// collection where they are at least an editor. A nil collection is always allowed.
+func (s *WorkspaceService) AuthorizeFiling(ctx context.Context, userID int, collectionID *int) error {
+	if collectionID == nil {
+		return nil
+	}
+	err := s.AuthorizeCollection(ctx, userID, *collectionID, models.RoleEditor)
+	if errors.Is(err, ErrForbidden) {
+		return ErrCollectionNotWritable
+	}
+	return err
+}
+
+// AuthorizeWorkspace returns ErrNotFound if the user is not a member of the
+// workspace, and ErrForbidden if their role is below required
+func (s *WorkspaceService) AuthorizeWorkspace(ctx context.Context, userID, workspaceID int, required string) error {
+	_, err := s.authorize(ctx, userID, workspaceID, required)
+	return err
+}
+
+func (s *WorkspaceService) authorize(ctx context.Context, userID, workspaceID int, required string) (*models.Workspace, error) {
+	workspace, err := s.repo.GetByID(ctx, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if workspace == nil {
+		return nil, ErrNotFound
+	}
+	if !models.RoleAllows(workspace.Role, required) {
+		return nil, ErrForbidden
+	}
+	return workspace, nil
+}
+
+// checkOtherAdmins returns ErrLastAdmin if the workspace has a single admin.
+// Call it with the workspace locked.
+func (s *WorkspaceService) checkOtherAdmins(ctx context.Context, workspaceID int) error {
+	admins, err := s.repo.CountAdmins(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// setMember adds a member or changes their role, and records it
+func (s *WorkspaceService) setMember(ctx context.Context, actor models.Actor, workspaceID, userID int, role string) error {
+	current, err := s.repo.Role(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetMember(ctx, workspaceID, userID, role); err != nil {
+		return err
+	}
+
+	if current == "" {
+		return s.audit.Record(ctx, actor, userID, models.AuditActionCreate, models.EntityWorkspaceMember, workspaceID,
+			nil, memberRole(userID, role))
+	}
+	return s.audit.Record(ctx, actor, userID, models.AuditActionUpdate, models.EntityWorkspaceMember, workspaceID,
+		memberRole(userID, current), memberRole(userID, role))
+}
+
+// memberRole is the audited state of a membership: the role under a
+// "member:<user ID>" field, so the member appears in the recorded changes
+func memberRole(userID int, role string) map[string]string {
+	return map[string]string{fmt.Sprintf("member:%d", userID): role}
+}
+
+// sameID reports whether two optional IDs are equal
+func sameID(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
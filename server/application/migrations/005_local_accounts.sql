@@ -0,0 +1,30 @@
+-- Local accounts and token issuance
+-- Adds password hashes to users and server-side login sessions. Each session
+-- holds a chain of rotating refresh tokens (stored as hashes); revoking the
+-- session invalidates its refresh tokens and the access tokens issued from it.
+
+ALTER TABLE "mfo-server".users ADD COLUMN IF NOT EXISTS password_hash TEXT;
+
+-- Login sessions (one per successful login)
+CREATE TABLE IF NOT EXISTS "mfo-server".auth_sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_user_id ON "mfo-server".auth_sessions(user_id);
+
+-- Refresh tokens; a token is single-use and replaced on every refresh
+CREATE TABLE IF NOT EXISTS "mfo-server".refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES "mfo-server".auth_sessions(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON "mfo-server".refresh_tokens(session_id);
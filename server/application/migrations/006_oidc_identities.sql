@@ -0,0 +1,10 @@
+-- OIDC identities
+-- Users signing in through an OpenID Connect provider are linked to a local
+-- user by (issuer, subject). Their provider groups are kept as roles.
+
+ALTER TABLE "mfo-server".users ADD COLUMN IF NOT EXISTS oidc_issuer TEXT;
+ALTER TABLE "mfo-server".users ADD COLUMN IF NOT EXISTS oidc_subject TEXT;
+ALTER TABLE "mfo-server".users ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE "mfo-server".users
+    ADD CONSTRAINT users_oidc_identity_key UNIQUE (oidc_issuer, oidc_subject);
@@ -0,0 +1,21 @@
+-- Audit log
+-- One row per mutation of a conversation, snippet, collection or settings row,
+-- written in the same transaction as the mutation. user_id is the owner of the
+-- changed data, actor_id the user who made the change. changes holds the
+-- changed fields as {"field": {"old": ..., "new": ...}}.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    actor_id INTEGER REFERENCES "mfo-server".users(id) ON DELETE SET NULL,
+    api_key_id INTEGER REFERENCES "mfo-server".api_keys(id) ON DELETE SET NULL,
+    ip TEXT,
+    action VARCHAR(32) NOT NULL,
+    entity_type VARCHAR(32) NOT NULL,
+    entity_id INTEGER NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_created ON "mfo-server".audit_events(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_entity ON "mfo-server".audit_events(user_id, entity_type, entity_id);
@@ -0,0 +1,19 @@
+-- Envelope encryption of conversation and snippet content
+-- When encryption is enabled, content is left empty and the encrypted content
+-- is stored in content_ciphertext. data_key is the per-record data key, wrapped
+-- by the master key master_key_id. content_terms is the blind index used to
+-- search encrypted content: keyed hashes of the words it contains.
+-- Rows with a NULL data_key are plaintext.
+
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS content_ciphertext BYTEA;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS data_key BYTEA;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS master_key_id TEXT;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS content_terms TEXT[];
+
+ALTER TABLE "mfo-server".snippets ADD COLUMN IF NOT EXISTS content_ciphertext BYTEA;
+ALTER TABLE "mfo-server".snippets ADD COLUMN IF NOT EXISTS data_key BYTEA;
+ALTER TABLE "mfo-server".snippets ADD COLUMN IF NOT EXISTS master_key_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_conversations_content_terms ON "mfo-server".conversations USING GIN(content_terms);
+CREATE INDEX IF NOT EXISTS idx_conversations_master_key_id ON "mfo-server".conversations(master_key_id);
+CREATE INDEX IF NOT EXISTS idx_snippets_master_key_id ON "mfo-server".snippets(master_key_id);
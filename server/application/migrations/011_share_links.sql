@@ -0,0 +1,20 @@
+-- Public share links
+-- A share link exposes one conversation or snippet read-only to anyone holding
+-- its token. Only the token hash is stored; the optional password is a bcrypt hash.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".share_links (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    entity_type VARCHAR(32) NOT NULL,
+    entity_id INTEGER NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    password_hash TEXT,
+    view_count INTEGER NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_entity ON "mfo-server".share_links(user_id, entity_type, entity_id);
@@ -0,0 +1,21 @@
+-- Messages parsed from conversation content
+-- A conversation's messages are rebuilt from its content every time it is
+-- saved; ordinal is the 1-based position of the message in the conversation.
+-- role is one of user, assistant, system, tool or unknown (no speaker marker).
+-- Content is encrypted at rest like conversation content (see 009).
+
+CREATE TABLE IF NOT EXISTS "mfo-server".messages (
+    id SERIAL PRIMARY KEY,
+    conversation_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    ordinal INTEGER NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('user', 'assistant', 'system', 'tool', 'unknown')),
+    content TEXT NOT NULL DEFAULT '',
+    model TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    content_ciphertext BYTEA,
+    data_key BYTEA,
+    master_key_id TEXT,
+    UNIQUE (conversation_id, ordinal)
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_master_key_id ON "mfo-server".messages(master_key_id);
@@ -0,0 +1,29 @@
+-- Past versions of conversations
+-- Every save of an existing conversation first stores its current state here.
+-- Content is stored as a reverse delta: the content of a version is obtained
+-- from the content of the next newer version (or of the conversation for the
+-- latest one) by keeping its first delta_prefix and last delta_suffix bytes
+-- and putting content in between. Rows with a NULL delta_prefix hold the full
+-- content, which bounds the number of deltas to apply.
+-- Content is encrypted at rest like conversation content (see 009).
+
+CREATE TABLE IF NOT EXISTS "mfo-server".conversation_versions (
+    id SERIAL PRIMARY KEY,
+    conversation_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    tags TEXT[] DEFAULT '{}',
+    content_length INTEGER NOT NULL,
+    saved_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    delta_prefix INTEGER,
+    delta_suffix INTEGER,
+    content TEXT NOT NULL DEFAULT '',
+    content_ciphertext BYTEA,
+    data_key BYTEA,
+    master_key_id TEXT,
+    UNIQUE (conversation_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_versions_master_key_id ON "mfo-server".conversation_versions(master_key_id);
@@ -0,0 +1,7 @@
+-- Versions of snippets, collections and settings
+-- Like conversations.version, version is incremented on every update. It is
+-- the entity tag of the row for conditional requests (If-Match).
+
+ALTER TABLE "mfo-server".snippets ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE "mfo-server".collections ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE "mfo-server".settings ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,16 @@
+-- Conversation URL aliases
+-- Other URLs of a user's conversations: the URLs they were saved from before
+-- their canonical URL was rewritten by the source registry (see
+-- pkg/sources), and the URLs of conversations merged into them. Looking up a
+-- conversation by URL also finds it by its aliases.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".conversation_url_aliases (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    conversation_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_url_aliases_conversation_id ON "mfo-server".conversation_url_aliases(conversation_id);
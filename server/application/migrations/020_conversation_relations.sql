@@ -0,0 +1,21 @@
+-- Conversation relations
+-- Typed links between conversations: a chat continuing another one, forked
+-- from it, answering the same prompt on another provider, or referencing it.
+-- user_id is the user who created the relation. answers_same_prompt goes both
+-- ways and is stored with the lower conversation ID as source_id, so that the
+-- unique constraint holds whichever way it was created.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".conversation_relations (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    source_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    target_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('continues', 'forked_from', 'answers_same_prompt', 'references')),
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (source_id <> target_id),
+    UNIQUE (source_id, target_id, type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_relations_target_id ON "mfo-server".conversation_relations(target_id);
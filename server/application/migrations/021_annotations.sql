@@ -0,0 +1,31 @@
+-- Annotations
+-- Highlights of ranges of a conversation's content, with a color, a note and
+-- tags. start_offset and end_offset count characters of the content. The
+-- highlighted text and the text around it are kept as a JSON anchor in
+-- content (see pkg/textanchor), encrypted like conversation content when
+-- encryption at rest is enabled, to find the range again after the content
+-- changes. orphaned marks annotations whose text is no longer in the content.
+-- Annotations are private to the user who made them.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".annotations (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    conversation_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    content_ciphertext BYTEA,
+    data_key BYTEA,
+    master_key_id TEXT,
+    color TEXT NOT NULL,
+    note TEXT,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    orphaned BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (start_offset >= 0 AND end_offset > start_offset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_annotations_conversation_id ON "mfo-server".annotations(conversation_id);
+CREATE INDEX IF NOT EXISTS idx_annotations_user_id ON "mfo-server".annotations(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_annotations_tags ON "mfo-server".annotations USING GIN(tags);
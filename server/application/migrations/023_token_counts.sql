@@ -0,0 +1,9 @@
+-- Token counts
+-- Number of tokens of the content of each conversation and of each of its
+-- messages, counted on every save with the tokenizer of the conversation's
+-- source (see pkg/tokenizer), whose name is kept in tokenizer. NULL until
+-- counted, for conversations saved before these columns existed.
+
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS token_count INTEGER;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS tokenizer TEXT;
+ALTER TABLE "mfo-server".messages ADD COLUMN IF NOT EXISTS token_count INTEGER;
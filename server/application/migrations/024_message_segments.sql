@@ -0,0 +1,25 @@
+-- Message segments
+-- The parts of each message told apart by the rules of its conversation's
+-- source (see pkg/segments): the answer, reasoning traces, tool calls and
+-- citations. They are rebuilt with the messages every time the conversation
+-- is saved; ordinal is the 1-based position of the segment in its message.
+-- Content is encrypted at rest like message content, with a blind index like
+-- conversation content (see 009) so that searches can leave reasoning out.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".message_segments (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL REFERENCES "mfo-server".messages(id) ON DELETE CASCADE,
+    conversation_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    ordinal INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('answer', 'reasoning', 'tool_call', 'citation')),
+    content TEXT NOT NULL DEFAULT '',
+    content_ciphertext BYTEA,
+    data_key BYTEA,
+    master_key_id TEXT,
+    content_terms TEXT[],
+    UNIQUE (message_id, ordinal)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_segments_conversation_id ON "mfo-server".message_segments(conversation_id, kind);
+CREATE INDEX IF NOT EXISTS idx_message_segments_master_key_id ON "mfo-server".message_segments(master_key_id);
+CREATE INDEX IF NOT EXISTS idx_message_segments_content_terms ON "mfo-server".message_segments USING GIN(content_terms);
@@ -0,0 +1,5 @@
+-- Settings API key hash
+-- The unsalted hash of the settings API key kept by 010 was never read. Only
+-- the redacted hint is kept.
+
+ALTER TABLE "mfo-server".settings DROP COLUMN IF EXISTS api_key_hash;
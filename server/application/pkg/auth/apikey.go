@@ -1,7 +1,71 @@
 package auth
 
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix marks tokens issued by this server so they can be told apart from JWTs
+const APIKeyPrefix = "asv_"
+
+// apiKeyDisplayLength is the number of leading characters kept in clear for display
+const apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
 // ValidateAPIKey validates an API key against a secret
 func ValidateAPIKey(apiKey, secret string) bool {
-	return apiKey != "" && secret != "" && apiKey == secret
+	return apiKey != "" && secret != "" &&
+		subtle.ConstantTimeCompare([]byte(apiKey), []byte(secret)) == 1
+}
+
+// GenerateAPIKey returns a new random API key and its display prefix
+func GenerateAPIKey() (key string, prefix string, err error) {
+	key, err = randomToken(APIKeyPrefix)
+	if err != nil {
+		return "", "", err
+	}
+	return key, key[:apiKeyDisplayLength], nil
+}
+
+// HashAPIKey returns the hash under which an API key is stored
+func HashAPIKey(key string) string {
+	return HashToken(key)
 }
 
+// HashToken returns the hex-encoded SHA-256 hash under which a token is stored.
+// Tokens carry 256 bits of entropy, so a fast hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns prefix followed by 256 random bits, base64url-encoded
+func randomToken(prefix string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// RedactionMark separates the kept ends of a redacted secret
+const RedactionMark = "…"
+
+// RedactSecret returns a display form of a secret that keeps its first three and
+// last four characters, e.g. "sk_…abcd". Short secrets are fully hidden.
+func RedactSecret(secret string) string {
+	runes := []rune(secret)
+	if len(runes) < 12 {
+		return RedactionMark
+	}
+	return string(runes[:3]) + RedactionMark + string(runes[len(runes)-4:])
+}
+
+// IsRedacted reports whether value is a redacted secret rather than a real one
+func IsRedacted(value string) bool {
+	return strings.Contains(value, RedactionMark)
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned when no key in the key set matches a token's kid
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// minJWKSRefreshInterval bounds how often the key set is fetched outside of
+// its refresh interval, after an unknown kid or a failed fetch, so forged
+// tokens or an unreachable provider cannot make the server hammer it
+const minJWKSRefreshInterval = 30 * time.Second
+
+// JWKSCache fetches and caches the public keys of a JSON Web Key Set.
+// Keys are refreshed periodically and whenever a token references an unknown
+// kid, which picks up key rotation at the identity provider. One fetch runs
+// at a time, without holding the lock, and concurrent lookups wait for it.
+type JWKSCache struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	lastErr     error
+	// fetching is closed when the running fetch ends; nil when none runs
+	fetching chan struct{}
+}
+
+// NewJWKSCache creates a key cache for the JWKS at url
+func NewJWKSCache(url string, client *http.Client, refreshInterval time.Duration) *JWKSCache {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKSCache{
+		url:             url,
+		client:          client,
+		refreshInterval: refreshInterval,
+	}
+}
+
+// Key returns the public key for kid. An empty kid matches the only key of a
+// single-key set. Keys are still used past the refresh interval while the key
+// set cannot be fetched.
+func (c *JWKSCache) Key(ctx context.Context, kid string) (interface{}, error) {
+	for {
+		c.mu.Lock()
+		key, ok := c.lookup(kid)
+		if ok && time.Since(c.fetchedAt) <= c.refreshInterval {
+			c.mu.Unlock()
+			return key, nil
+		}
+
+		if wait := c.fetching; wait != nil {
+			c.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if time.Since(c.lastAttempt) < minJWKSRefreshInterval {
+			err := ErrUnknownKey
+			if c.keys == nil {
+				err = c.lastErr
+			}
+			c.mu.Unlock()
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+
+		// Fetch for every waiting lookup, whether or not this one is canceled
+		c.fetching = make(chan struct{})
+		c.lastAttempt = time.Now()
+		c.mu.Unlock()
+		keys, err := c.fetch(context.WithoutCancel(ctx))
+
+		c.mu.Lock()
+		if err == nil {
+			c.keys = keys
+			c.fetchedAt = time.Now()
+		}
+		c.lastErr = err
+		close(c.fetching)
+		c.fetching = nil
+		c.mu.Unlock()
+	}
+}
+
+// lookup finds the key for kid. The caller must hold c.mu.
+func (c *JWKSCache) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// fetch downloads and decodes the key set
+func (c *JWKSCache) fetch(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys of unsupported types rather than rejecting the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// jsonWebKey is the subset of RFC 7517 needed for RSA and EC public keys
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64url value: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// OIDCConfig configures verification of tokens issued by an OpenID Connect provider
+type OIDCConfig struct {
+	// Issuer must match the "iss" claim. Also used for discovery when JWKSURL is empty.
+	Issuer string
+	// Audience must be contained in the "aud" claim
+	Audience string
+	// JWKSURL is where the provider publishes its signing keys
+	JWKSURL string
+	// UsernameClaim names the claim used as local username (falls back to "sub")
+	UsernameClaim string
+	// GroupsClaim names the claim mapped to local roles
+	GroupsClaim string
+	// KeyRefreshInterval is how long fetched keys are trusted before refetching
+	KeyRefreshInterval time.Duration
+	// HTTPClient is used for discovery and JWKS requests (optional)
+	HTTPClient *http.Client
+}
+
+// OIDCIdentity is the verified identity carried by a provider token
+type OIDCIdentity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// OIDCVerifier verifies RS256/ES256 tokens against a provider's JWKS
+type OIDCVerifier struct {
+	config OIDCConfig
+	keys   *JWKSCache
+}
+
+// NewOIDCVerifier creates a verifier. When no JWKS URL is configured it is
+// discovered from the issuer's /.well-known/openid-configuration document.
+func NewOIDCVerifier(ctx context.Context, config OIDCConfig) (*OIDCVerifier, error) {
+	if config.Issuer == "" {
+		return nil, fmt.Errorf("OIDC issuer is required")
+	}
+	if config.Audience == "" {
+		return nil, fmt.Errorf("OIDC audience is required")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.KeyRefreshInterval == 0 {
+		config.KeyRefreshInterval = time.Hour
+	}
+
+	if config.JWKSURL == "" {
+		jwksURL, err := discoverJWKSURL(ctx, config.HTTPClient, config.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		config.JWKSURL = jwksURL
+	}
+
+	return &OIDCVerifier{
+		config: config,
+		keys:   NewJWKSCache(config.JWKSURL, config.HTTPClient, config.KeyRefreshInterval),
+	}, nil
+}
+
+// Verify checks the signature, expiry, issuer and audience of a token. The
+// "exp" and "iat" claims are required, as in OpenID Connect ID tokens; "nbf"
+// is checked when present.
+func (v *OIDCVerifier) Verify(ctx context.Context, tokenString string) (*OIDCIdentity, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "ES256"}))
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	// The parser only checks the time claims a token has
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, errors.New("token has no expiry or is expired")
+	}
+	if !claims.VerifyIssuedAt(now, true) {
+		return nil, errors.New("token has no issue time or is used before it")
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if !claims.VerifyIssuer(v.config.Issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	if !claims.VerifyAudience(v.config.Audience, true) {
+		return nil, errors.New("invalid token audience")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	username, _ := claims[v.config.UsernameClaim].(string)
+	if username == "" {
+		username = subject
+	}
+
+	return &OIDCIdentity{
+		Issuer:   v.config.Issuer,
+		Subject:  subject,
+		Username: username,
+		Groups:   stringsClaim(claims[v.config.GroupsClaim]),
+	}, nil
+}
+
+// IsAsymmetricToken reports whether a token is signed with an algorithm handled
+// by OIDC verification, without verifying it
+func IsAsymmetricToken(tokenString string) bool {
+	alg := TokenAlgorithm(tokenString)
+	return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "ES")
+}
+
+// TokenAlgorithm returns the "alg" header of a JWT without verifying it,
+// or an empty string if tokenString is not a JWT
+func TokenAlgorithm(tokenString string) string {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+	alg, _ := token.Header["alg"].(string)
+	return alg
+}
+
+func discoverJWKSURL(ctx context.Context, client *http.Client, issuer string) (string, error) {
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build discovery request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch OIDC discovery document: unexpected status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", fmt.Errorf("failed to decode OIDC discovery document: %w", err)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("OIDC discovery document has no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
+
+// stringsClaim reads a claim that is either a string array or a single string
+func stringsClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return []string{}
+	}
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testAudience = "ai-saver"
+
+// testProvider is a stand-in identity provider serving a discovery document
+// and a key set that tests can rotate
+type testProvider struct {
+	server  *httptest.Server
+	fetches atomic.Int32
+
+	mu     sync.Mutex
+	keys   []map[string]string
+	status int
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	p := &testProvider{status: http.StatusOK}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   p.server.URL,
+			"jwks_uri": p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.fetches.Add(1)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.status != http.StatusOK {
+			w.WriteHeader(p.status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": p.keys})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// publish replaces the key set with the public keys of signers
+func (p *testProvider) publish(signers ...*testSigner) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = nil
+	for _, s := range signers {
+		p.keys = append(p.keys, s.jwk())
+	}
+}
+
+func (p *testProvider) setStatus(status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = status
+}
+
+func (p *testProvider) verifier(t *testing.T) *OIDCVerifier {
+	v, err := NewOIDCVerifier(context.Background(), OIDCConfig{
+		Issuer:   p.server.URL,
+		Audience: testAudience,
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCVerifier: %v", err)
+	}
+	return v
+}
+
+// claims returns valid claims for a token of the provider
+func (p *testProvider) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":                p.server.URL,
+		"aud":                testAudience,
+		"sub":                "user-1",
+		"preferred_username": "alice",
+		"groups":             []string{"admins"},
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+	}
+}
+
+type testSigner struct {
+	kid    string
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+func newRSASigner(t *testing.T, kid string) *testSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{kid: kid, method: jwt.SigningMethodRS256, key: key}
+}
+
+func newECSigner(t *testing.T, kid string) *testSigner {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{kid: kid, method: jwt.SigningMethodES256, key: key}
+}
+
+func (s *testSigner) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(s.method, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (s *testSigner) jwk() map[string]string {
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{
+			"kty": "RSA", "kid": s.kid, "use": "sig",
+			"n": encode(key.N), "e": encode(big.NewInt(int64(key.E))),
+		}
+	case *ecdsa.PrivateKey:
+		return map[string]string{
+			"kty": "EC", "kid": s.kid, "use": "sig", "crv": "P-256",
+			"x": encode(key.X), "y": encode(key.Y),
+		}
+	}
+	return nil
+}
+
+func TestOIDCVerify(t *testing.T) {
+	provider := newTestProvider(t)
+	rsaSigner := newRSASigner(t, "rsa-1")
+	ecSigner := newECSigner(t, "ec-1")
+	provider.publish(rsaSigner, ecSigner)
+	v := provider.verifier(t)
+
+	for _, signer := range []*testSigner{rsaSigner, ecSigner} {
+		identity, err := v.Verify(context.Background(), signer.sign(t, provider.claims()))
+		if err != nil {
+			t.Fatalf("%s: valid token rejected: %v", signer.kid, err)
+		}
+		if identity.Subject != "user-1" || identity.Username != "alice" ||
+			len(identity.Groups) != 1 || identity.Groups[0] != "admins" {
+			t.Errorf("%s: unexpected identity %+v", signer.kid, identity)
+		}
+	}
+	if n := provider.fetches.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want 1", n)
+	}
+}
+
+func TestOIDCVerifyRejectsInvalidClaims(t *testing.T) {
+	provider := newTestProvider(t)
+	signer := newRSASigner(t, "rsa-1")
+	provider.publish(signer)
+	v := provider.verifier(t)
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-app" }},
+		{"missing exp", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"missing iat", func(c jwt.MapClaims) { delete(c, "iat") }},
+		{"issued in the future", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{"not valid yet", func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() }},
+		{"missing subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := provider.claims()
+			tt.modify(claims)
+			if _, err := v.Verify(context.Background(), signer.sign(t, claims)); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
+
+func TestOIDCVerifyUnknownKey(t *testing.T) {
+	provider := newTestProvider(t)
+	provider.publish(newRSASigner(t, "rsa-1"))
+	v := provider.verifier(t)
+
+	// Same kid, another key: the signature does not verify
+	forged := newRSASigner(t, "rsa-1")
+	if _, err := v.Verify(context.Background(), forged.sign(t, provider.claims())); err == nil {
+		t.Error("token signed with an unpublished key accepted")
+	}
+
+	unknown := newRSASigner(t, "rsa-2")
+	_, err := v.Verify(context.Background(), unknown.sign(t, provider.claims()))
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got %v, want ErrUnknownKey", err)
+	}
+	// Unknown kids within the throttle interval do not refetch
+	for i := 0; i < 3; i++ {
+		v.Verify(context.Background(), unknown.sign(t, provider.claims()))
+	}
+	if n := provider.fetches.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want 1", n)
+	}
+}
+
+func TestOIDCVerifyKeyRotation(t *testing.T) {
+	provider := newTestProvider(t)
+	oldSigner := newRSASigner(t, "rsa-1")
+	provider.publish(oldSigner)
+	v := provider.verifier(t)
+
+	if _, err := v.Verify(context.Background(), oldSigner.sign(t, provider.claims())); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	newSigner := newECSigner(t, "ec-2")
+	provider.publish(newSigner)
+	// Let the next unknown kid refetch without waiting for the throttle
+	v.keys.mu.Lock()
+	v.keys.lastAttempt = time.Now().Add(-minJWKSRefreshInterval)
+	v.keys.mu.Unlock()
+
+	if _, err := v.Verify(context.Background(), newSigner.sign(t, provider.claims())); err != nil {
+		t.Fatalf("token signed with the rotated key rejected: %v", err)
+	}
+	if n := provider.fetches.Load(); n != 2 {
+		t.Errorf("key set fetched %d times, want 2", n)
+	}
+}
+
+func TestJWKSCacheThrottlesFailedFetches(t *testing.T) {
+	provider := newTestProvider(t)
+	signer := newRSASigner(t, "rsa-1")
+	provider.publish(signer)
+	provider.setStatus(http.StatusServiceUnavailable)
+	v := provider.verifier(t)
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(context.Background(), signer.sign(t, provider.claims())); err == nil {
+			t.Fatal("token accepted without a key set")
+		}
+	}
+	if n := provider.fetches.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want 1", n)
+	}
+}
+
+func TestJWKSCacheFetchesOnceForConcurrentLookups(t *testing.T) {
+	provider := newTestProvider(t)
+	signer := newRSASigner(t, "rsa-1")
+	provider.publish(signer)
+	cache := NewJWKSCache(provider.server.URL+"/jwks", nil, time.Hour)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Key(context.Background(), "rsa-1"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Key: %v", err)
+	}
+	if n := provider.fetches.Load(); n != 1 {
+		t.Errorf("key set fetched %d times, want 1", n)
+	}
+}
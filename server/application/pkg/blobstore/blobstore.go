@@ -0,0 +1,238 @@
+// Package blobstore keeps files on the local filesystem, addressed by the
+// SHA-256 of their content, so that a file stored twice takes space once.
+//
+// Blobs live under <dir>/blobs/<first two hex digits>/<hash>. Files being
+// uploaded in several parts are appended to <dir>/uploads/<id> until they are
+// complete, then hashed and moved among the blobs.
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrTooLarge is returned when a file exceeds the size it may have
+	ErrTooLarge = errors.New("file too large")
+	// ErrOffsetMismatch is returned when a part does not start where the
+	// upload stopped
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+)
+
+// Store is a content-addressed store rooted at a directory
+type Store struct {
+	dir string
+}
+
+// New opens the store rooted at dir, creating its directories if needed
+func New(dir string) (*Store, error) {
+	for _, sub := range []string{"blobs", "uploads"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create blob store: %w", err)
+		}
+	}
+	return &Store{dir: dir}, nil
+}
+
+// ValidHash reports whether hash is a hex-encoded SHA-256, and so safe to
+// use in a path
+func ValidHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Path returns the path of the blob with the given hash
+func (s *Store) Path(hash string) string {
+	return filepath.Join(s.dir, "blobs", hash[:2], hash)
+}
+
+// Open opens the blob with the given hash
+func (s *Store) Open(hash string) (*os.File, error) {
+	if !ValidHash(hash) {
+		return nil, fs.ErrNotExist
+	}
+	return os.Open(s.Path(hash))
+}
+
+// Put stores the content of r, at most maxSize bytes, and returns its hash
+// and size
+func (s *Store) Put(r io.Reader, maxSize int64) (hash string, size int64, err error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, "uploads"), "put-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err = io.Copy(tmp, io.LimitReader(r, maxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	if size > maxSize {
+		return "", 0, ErrTooLarge
+	}
+	hash, err = s.commit(tmp.Name())
+	return hash, size, err
+}
+
+// CreatePart starts the upload of a file in parts
+func (s *Store) CreatePart(id int) error {
+	f, err := os.OpenFile(s.partPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+	return f.Close()
+}
+
+// AppendPart appends the content of r to an upload that has received offset
+// bytes so far, without letting it grow past size, and returns the number of
+// bytes received
+func (s *Store) AppendPart(id int, offset, size int64, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(s.partPath(id), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open upload: %w", err)
+	}
+	if info.Size() != offset {
+		// A part interrupted before it was recorded leaves extra bytes; drop them
+		if info.Size() < offset {
+			return 0, ErrOffsetMismatch
+		}
+		if err := f.Truncate(offset); err != nil {
+			return 0, fmt.Errorf("failed to resume upload: %w", err)
+		}
+	}
+
+	written, err := io.Copy(f, io.LimitReader(r, size-offset+1))
+	if err != nil {
+		return 0, fmt.Errorf("failed to write upload: %w", err)
+	}
+	if offset+written > size {
+		if err := f.Truncate(offset); err != nil {
+			return 0, fmt.Errorf("failed to write upload: %w", err)
+		}
+		return 0, ErrTooLarge
+	}
+	return offset + written, nil
+}
+
+// CommitPart moves a complete upload among the blobs and returns its hash
+func (s *Store) CommitPart(id int) (string, error) {
+	return s.commit(s.partPath(id))
+}
+
+// RemovePart drops an upload
+func (s *Store) RemovePart(id int) error {
+	if err := os.Remove(s.partPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload: %w", err)
+	}
+	return nil
+}
+
+// Parts returns the IDs of the uploads in progress
+func (s *Store) Parts() ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "uploads"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	ids := []int{}
+	for _, entry := range entries {
+		// Skip the temporary files of Put
+		if id, err := strconv.Atoi(entry.Name()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Remove deletes the blob with the given hash
+func (s *Store) Remove(hash string) error {
+	if !ValidHash(hash) {
+		return nil
+	}
+	if err := os.Remove(s.Path(hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove blob: %w", err)
+	}
+	return nil
+}
+
+// Hashes returns the hashes of the blobs last stored before the given time.
+// Storing content the store already holds counts as storing it again, so a
+// blob just deduplicated is not taken for an unused one.
+func (s *Store) Hashes(before time.Time) ([]string, error) {
+	hashes := []string{}
+	err := filepath.WalkDir(filepath.Join(s.dir, "blobs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !ValidHash(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(before) {
+			hashes = append(hashes, d.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	return hashes, nil
+}
+
+// commit hashes the file at path and moves it to its blob path, or removes
+// it if the store already holds the same content
+func (s *Store) commit(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob: %w", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to hash blob: %w", err)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	target := s.Path(hash)
+	if _, err := os.Stat(target); err == nil {
+		now := time.Now()
+		if err := os.Chtimes(target, now, now); err != nil {
+			return "", fmt.Errorf("failed to store blob: %w", err)
+		}
+		return hash, os.Remove(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+	if err := os.Rename(path, target); err != nil {
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+	return hash, nil
+}
+
+func (s *Store) partPath(id int) string {
+	return filepath.Join(s.dir, "uploads", strconv.Itoa(id))
+}
@@ -0,0 +1,51 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"unicode"
+)
+
+// minTermLength skips one-letter words, which match nearly every record
+const minTermLength = 2
+
+// blindTermSize is the number of HMAC bytes kept per term
+const blindTermSize = 12
+
+// IndexTerms returns the blind index of text: the keyed hash of every distinct
+// lowercased word. Encrypted content is searched by comparing these hashes,
+// so the database never sees the words themselves.
+func (k *Keyring) IndexTerms(text string) []string {
+	seen := make(map[string]bool)
+	terms := []string{}
+	for _, word := range words(text) {
+		term := k.blindTerm(word)
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func (k *Keyring) blindTerm(word string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(word))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)[:blindTermSize])
+}
+
+// words splits text into the lowercased words used for the blind index
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	result := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if len([]rune(field)) >= minTermLength {
+			result = append(result, field)
+		}
+	}
+	return result
+}
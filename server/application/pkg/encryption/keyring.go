@@ -0,0 +1,202 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IndexKeyID is the reserved key ID of the search index key
+const IndexKeyID = "index"
+
+// KeySize is the size of master, data and index keys (AES-256)
+const KeySize = 32
+
+// ErrUnknownMasterKey is returned when an envelope was sealed with a master key
+// that is not configured anymore
+var ErrUnknownMasterKey = errors.New("unknown master key")
+
+// Envelope is a record encrypted with its own data key. The data key is stored
+// wrapped (encrypted) by the master key KeyID, so rotating the master key only
+// requires re-wrapping data keys, not re-encrypting content.
+type Envelope struct {
+	KeyID      string
+	WrappedKey []byte
+	Ciphertext []byte
+}
+
+// Keyring holds the master keys and the search index key.
+// New data keys are always wrapped by the active (first) master key;
+// the others are only used to unwrap existing data keys.
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+// LoadKeyring reads keys from spec and from the file at path. Both hold
+// "id:base64key" entries, separated by commas or newlines; the first master key
+// is the active one. It returns nil when neither is set, which disables encryption.
+func LoadKeyring(spec, path string) (*Keyring, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		spec = strings.TrimSpace(spec + "\n" + string(data))
+	}
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	return ParseKeyring(spec)
+}
+
+// ParseKeyring parses "id:base64key" entries separated by commas or newlines.
+// Blank lines and lines starting with # are ignored.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string][]byte)}
+
+	entries := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid encryption key entry, expected id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %q: %w", id, err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("encryption key %q must be %d bytes, got %d", id, KeySize, len(key))
+		}
+
+		if id == IndexKeyID {
+			k.indexKey = key
+			continue
+		}
+		if _, exists := k.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate encryption key %q", id)
+		}
+		if k.activeID == "" {
+			k.activeID = id
+		}
+		k.keys[id] = key
+	}
+
+	if k.activeID == "" {
+		return nil, errors.New("no master encryption key configured")
+	}
+	if k.indexKey == nil {
+		return nil, fmt.Errorf("no %q encryption key configured for the search index", IndexKeyID)
+	}
+	return k, nil
+}
+
+// ActiveKeyID returns the ID of the master key new data keys are wrapped with
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// Seal encrypts plaintext with a fresh data key wrapped by the active master key
+func (k *Keyring) Seal(plaintext []byte) (*Envelope, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	ciphertext, err := seal(dataKey, plaintext, nil)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := k.wrap(k.activeID, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{KeyID: k.activeID, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts an envelope
+func (k *Keyring) Open(env *Envelope) ([]byte, error) {
+	dataKey, err := k.unwrap(env.KeyID, env.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, env.Ciphertext, nil)
+}
+
+// Rewrap re-encrypts the data key of env with the active master key, leaving
+// the ciphertext untouched. It returns the new wrapped key.
+func (k *Keyring) Rewrap(env *Envelope) ([]byte, error) {
+	dataKey, err := k.unwrap(env.KeyID, env.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return k.wrap(k.activeID, dataKey)
+}
+
+// The master key ID is bound to the wrapped key as additional data, so a
+// wrapped key cannot be passed off as wrapped by another master key
+func (k *Keyring) wrap(keyID string, dataKey []byte) ([]byte, error) {
+	return seal(k.keys[keyID], dataKey, []byte(keyID))
+}
+
+func (k *Keyring) unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, keyID)
+	}
+	dataKey, err := open(masterKey, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// seal encrypts with AES-256-GCM and prepends the random nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
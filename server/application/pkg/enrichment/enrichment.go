@@ -0,0 +1,288 @@
+// Package enrichment derives metadata from the text of a saved conversation:
+// word and turn counts, natural language, fenced code blocks, the model that
+// answered and the dates of its first and last messages.
+//
+// Everything is read from the text as captured; fields the text does not show,
+// such as dates on pages that hide them, are left empty.
+package enrichment
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/transcript"
+)
+
+// Metadata is what Analyze derives from a conversation
+type Metadata struct {
+	// WordCount counts the words of the messages, code included
+	WordCount int
+	// TurnCount is the number of messages, see transcript.Parse
+	TurnCount int
+	// Language is the ISO 639-1 code of the language of the prose, or empty
+	Language string
+	// CodeBlockCount is the number of fenced code blocks
+	CodeBlockCount int
+	// CodeLanguages are the languages named by the code fences, sorted
+	CodeLanguages []string
+	// Model is the model named most often, in speaker markers first, or empty
+	Model string
+	// FirstMessageAt and LastMessageAt are the earliest and latest message
+	// dates shown in the text, or nil
+	FirstMessageAt *time.Time
+	LastMessageAt  *time.Time
+}
+
+// Analyze returns the metadata of the content of a conversation
+func Analyze(content string) Metadata {
+	messages := transcript.Parse(content)
+
+	var metadata Metadata
+	metadata.TurnCount = len(messages)
+	texts := make([]string, len(messages))
+	for i, message := range messages {
+		texts[i] = message.Content
+		metadata.WordCount += len(strings.Fields(message.Content))
+	}
+	text := strings.Join(texts, "\n\n")
+
+	prose, blocks := splitCode(text)
+	metadata.Language = DetectLanguage(prose)
+	metadata.CodeBlockCount = len(blocks)
+	metadata.CodeLanguages = codeLanguages(blocks)
+	metadata.Model = detectModel(messages, text)
+	metadata.FirstMessageAt, metadata.LastMessageAt = messageDates(content)
+	return metadata
+}
+
+// codeBlock is a fenced code block; info is the text following the opening fence
+type codeBlock struct {
+	info string
+}
+
+// fenceRe matches the opening or closing line of a fenced code block
+var fenceRe = regexp.MustCompile("^\\s{0,3}(`{3,}|~{3,})\\s*([^`]*)$")
+
+// splitCode returns text without its fenced code blocks, and the blocks. A
+// block left open runs to the end of the text.
+func splitCode(text string) (string, []codeBlock) {
+	var prose []string
+	var blocks []codeBlock
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		m := fenceRe.FindStringSubmatch(line)
+		switch {
+		case fence == "" && m != nil:
+			fence = m[1]
+			blocks = append(blocks, codeBlock{info: strings.TrimSpace(m[2])})
+		case fence != "" && m != nil && m[1][0] == fence[0] && len(m[1]) >= len(fence) && strings.TrimSpace(m[2]) == "":
+			fence = ""
+		case fence == "":
+			prose = append(prose, line)
+		}
+	}
+	return strings.Join(prose, "\n"), blocks
+}
+
+// codeLanguageAliases maps the usual short names of languages to one name
+var codeLanguageAliases = map[string]string{
+	"py":         "python",
+	"python3":    "python",
+	"js":         "javascript",
+	"jsx":        "javascript",
+	"node":       "javascript",
+	"ts":         "typescript",
+	"tsx":        "typescript",
+	"sh":         "bash",
+	"shell":      "bash",
+	"zsh":        "bash",
+	"console":    "bash",
+	"golang":     "go",
+	"yml":        "yaml",
+	"c++":        "cpp",
+	"cs":         "csharp",
+	"c#":         "csharp",
+	"rb":         "ruby",
+	"rs":         "rust",
+	"kt":         "kotlin",
+	"ps1":        "powershell",
+	"md":         "markdown",
+	"postgresql": "sql",
+	"psql":       "sql",
+	"html5":      "html",
+	"dockerfile": "docker",
+	"plaintext":  "",
+	"text":       "",
+	"txt":        "",
+}
+
+// codeLanguages returns the distinct languages named by code fences, sorted
+func codeLanguages(blocks []codeBlock) []string {
+	seen := map[string]bool{}
+	languages := []string{}
+	for _, block := range blocks {
+		fields := strings.Fields(strings.ToLower(block.info))
+		if len(fields) == 0 {
+			continue
+		}
+		// Fences may carry attributes, as in ```python {linenos=true}
+		language := strings.Trim(fields[0], "{}.")
+		if alias, ok := codeLanguageAliases[language]; ok {
+			language = alias
+		}
+		if language == "" || seen[language] {
+			continue
+		}
+		seen[language] = true
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// modelRe matches model names of the main providers as they appear in pages
+// and model pickers, such as "GPT-4o", "o3-mini", "Claude 3.5 Sonnet",
+// "claude-sonnet-4", "Gemini 2.5 Pro" or "DeepSeek-R1"
+var modelRe = regexp.MustCompile(`(?i)\b(` +
+	`gpt-?[345](?:\.[015])?(?:o|-turbo|-mini|-nano|-pro)*` +
+	`|o[134]-(?:mini|preview|pro)(?:-high)?` +
+	`|claude[- ](?:(?:[1-4](?:\.[0-9])?[- ])?(?:opus|sonnet|haiku)(?:[- ][1-4](?:[.-][0-9])?)?|instant)` +
+	`|gemini[- ][12](?:\.[05])?[- ](?:pro|flash|ultra)(?:[- ]lite)?` +
+	`|mistral[- ](?:large|medium|small)` +
+	`|deepseek[- ](?:v[23](?:\.[0-9])?|r1|chat|reasoner|coder)` +
+	`|llama[- ]?[234](?:\.[0-9])?` +
+	`|grok[- ][1-4]` +
+	`|qwen[- ]?[23](?:\.[05])?(?:[- ](?:max|plus|turbo))?` +
+	`)\b`)
+
+// spacesRe matches the separators normalized out of model names
+var spacesRe = regexp.MustCompile(`[\s_]+`)
+
+// detectModel returns the model named most often in speaker markers, or else
+// in text, normalized to lowercase with dashes, or empty if none is named
+func detectModel(messages []transcript.Message, text string) string {
+	var names []string
+	for _, message := range messages {
+		if message.Model != "" {
+			names = append(names, message.Model)
+		}
+	}
+	if len(names) == 0 {
+		names = modelRe.FindAllString(text, -1)
+	}
+
+	counts := map[string]int{}
+	best := ""
+	for _, name := range names {
+		name = spacesRe.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-")
+		counts[name]++
+		if counts[name] > counts[best] {
+			best = name
+		}
+	}
+	return best
+}
+
+var (
+	// isoDateRe matches a line holding only a date in ISO 8601 form, with an
+	// optional time and zone, such as "2026-01-06 10:32" or "[2026-01-06T10:32:00Z]"
+	isoDateRe = regexp.MustCompile(`^[\[(*_ ]*(\d{4}-\d{2}-\d{2})(?:[T ](\d{2}:\d{2}(?::\d{2})?)(?:\.\d+)?(Z|[+-]\d{2}:?\d{2})?)?[\])*_ ]*$`)
+	// longDateRe matches a line holding only a date with the month in
+	// letters, with an optional time, such as "January 6, 2026 at 10:32 AM"
+	longDateRe = regexp.MustCompile(`(?i)^[\[(*_ ]*([a-z]{3,9})\.? (\d{1,2}),? (\d{4})(?:,? (?:at )?(\d{1,2}):(\d{2})(?::\d{2})? ?([ap]m)?)?[\])*_ ]*$`)
+)
+
+// messageDates returns the earliest and latest dates written on lines of
+// their own in content, as pages showing message dates do, or nil
+func messageDates(content string) (first, last *time.Time) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 10 || len(line) > 40 {
+			continue
+		}
+		date, ok := parseDateLine(line)
+		if !ok {
+			continue
+		}
+		if first == nil || date.Before(*first) {
+			first = &date
+		}
+		if last == nil || date.After(*last) {
+			last = &date
+		}
+	}
+	return first, last
+}
+
+// parseDateLine parses a line matching isoDateRe or longDateRe. Dates without
+// a zone are taken as UTC.
+func parseDateLine(line string) (time.Time, bool) {
+	if m := isoDateRe.FindStringSubmatch(line); m != nil {
+		value, layout := m[1], "2006-01-02"
+		if m[2] != "" {
+			value += "T" + m[2]
+			layout += "T15:04"
+			if len(m[2]) == 8 {
+				layout += ":05"
+			}
+		}
+		if m[3] != "" {
+			value += strings.Replace(m[3], "Z", "+00:00", 1)
+			if m[3] != "Z" && !strings.Contains(m[3], ":") {
+				value = value[:len(value)-2] + ":" + value[len(value)-2:]
+			}
+			layout += "Z07:00"
+		}
+		date, err := time.Parse(layout, value)
+		return date.UTC(), err == nil
+	}
+
+	if m := longDateRe.FindStringSubmatch(line); m != nil {
+		month, ok := months[strings.ToLower(m[1])]
+		if !ok {
+			return time.Time{}, false
+		}
+		date, err := time.Parse("2006 1 2", m[3]+" "+month+" "+m[2])
+		if err != nil {
+			return time.Time{}, false
+		}
+		if m[4] != "" {
+			hour, minute := atoi(m[4]), atoi(m[5])
+			switch strings.ToLower(m[6]) {
+			case "pm":
+				if hour < 12 {
+					hour += 12
+				}
+			case "am":
+				if hour == 12 {
+					hour = 0
+				}
+			}
+			if hour > 23 || minute > 59 {
+				return time.Time{}, false
+			}
+			date = date.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+		}
+		return date, true
+	}
+	return time.Time{}, false
+}
+
+// months maps English month names and their abbreviations to month numbers
+var months = map[string]string{
+	"jan": "1", "january": "1", "feb": "2", "february": "2", "mar": "3", "march": "3",
+	"apr": "4", "april": "4", "may": "5", "jun": "6", "june": "6",
+	"jul": "7", "july": "7", "aug": "8", "august": "8", "sep": "9", "sept": "9", "september": "9",
+	"oct": "10", "october": "10", "nov": "11", "november": "11", "dec": "12", "december": "12",
+}
+
+// atoi parses a run of digits matched by a regular expression
+func atoi(digits string) int {
+	n := 0
+	for _, d := range digits {
+		n = n*10 + int(d-'0')
+	}
+	return n
+}
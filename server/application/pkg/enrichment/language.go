@@ -0,0 +1,108 @@
+package enrichment
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minLanguageWords is the number of words below which the language of Latin
+// script text is not guessed
+const minLanguageWords = 5
+
+// scripts are the writing systems that name a language on their own, checked
+// in order; Han is only Chinese when there is no kana
+var scripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+}
+
+// stopwords are frequent words of the languages written in Latin script.
+// A word shared by several languages counts for each of them.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "were", "of", "to", "in", "that", "this", "it", "with", "for", "you", "not", "have", "be", "can", "what", "how", "which", "would", "should", "there", "from"},
+	"fr": {"le", "les", "des", "est", "et", "une", "dans", "pour", "pas", "qui", "que", "sur", "avec", "vous", "nous", "sont", "mais", "ce", "cette", "du", "au", "aux", "je", "il", "être", "avez"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "auf", "für", "ich", "sie", "es", "dem", "wie", "auch", "werden", "wird", "oder", "kann", "haben", "sind"},
+	"es": {"el", "los", "las", "y", "es", "una", "por", "para", "con", "del", "que", "se", "lo", "como", "pero", "más", "está", "son", "puede", "también", "usted", "hay", "muy", "este", "esta", "sus"},
+	"it": {"il", "di", "che", "è", "gli", "della", "per", "non", "sono", "una", "con", "anche", "come", "questo", "questa", "nel", "alla", "delle", "più", "può", "essere", "ci", "ma", "perché", "lo", "dei"},
+	"pt": {"o", "os", "as", "e", "é", "um", "uma", "não", "para", "com", "que", "do", "da", "dos", "das", "em", "no", "na", "mais", "você", "está", "são", "pode", "também", "isso", "como"},
+	"nl": {"de", "het", "een", "en", "is", "van", "niet", "dat", "die", "op", "te", "zijn", "met", "voor", "je", "ik", "maar", "ook", "wat", "bij", "kan", "worden", "wordt", "deze", "naar", "er"},
+}
+
+// stopwordLanguages maps each stopword to the languages it belongs to
+var stopwordLanguages = func() map[string][]string {
+	index := map[string][]string{}
+	for language, words := range stopwords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// DetectLanguage returns the ISO 639-1 code of the language text is mostly
+// written in, or empty when it cannot tell. Scripts used by a single language
+// decide when they make up a fifth of the letters; Latin script text is
+// matched against frequent words of English, French, German, Spanish, Italian,
+// Portuguese and Dutch.
+func DetectLanguage(text string) string {
+	letters := 0
+	counts := make([]int, len(scripts))
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for i, script := range scripts {
+			if unicode.Is(script.table, r) {
+				counts[i]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	for i, script := range scripts {
+		if counts[i]*5 >= letters {
+			return script.language
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) < minLanguageWords {
+		return ""
+	}
+	scores := map[string]int{}
+	for _, word := range words {
+		for _, language := range stopwordLanguages[word] {
+			scores[language]++
+		}
+	}
+
+	best, bestScore, second := "", 0, 0
+	for language, score := range scores {
+		if score > bestScore {
+			best, bestScore, second = language, score, bestScore
+		} else if score > second {
+			second = score
+		}
+	}
+	// Too few stopwords, or two languages too close to call
+	if bestScore*20 < len(words) || bestScore == second {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,69 @@
+// Package fingerprint computes SimHash fingerprints of text, so that
+// near-duplicate texts can be found by comparing 64-bit numbers.
+//
+// The text is lowercased and split into words, and every run of ShingleSize
+// consecutive words (a shingle) votes on each bit of the fingerprint with its
+// hash. Texts sharing most of their shingles get fingerprints that differ in
+// few bits, so the Hamming distance between two fingerprints estimates how
+// different the texts are.
+package fingerprint
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// ShingleSize is the number of consecutive words hashed together
+const ShingleSize = 4
+
+// Bits is the size of a fingerprint
+const Bits = 64
+
+// SimHash returns the fingerprint of text. ok is false when text has no words.
+func SimHash(text string) (fingerprint uint64, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0, false
+	}
+
+	// Texts shorter than a shingle are one shingle
+	size := ShingleSize
+	if len(words) < size {
+		size = len(words)
+	}
+
+	var votes [Bits]int
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < Bits; bit++ {
+			if sum&(1<<bit) != 0 {
+				votes[bit]++
+			} else {
+				votes[bit]--
+			}
+		}
+	}
+
+	for bit := 0; bit < Bits; bit++ {
+		if votes[bit] > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint, true
+}
+
+// Distance returns the number of bits that differ between two fingerprints
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Similarity turns a distance into a share between 0 (unrelated) and 1 (same fingerprint)
+func Similarity(distance int) float64 {
+	return 1 - float64(distance)/Bits
+}
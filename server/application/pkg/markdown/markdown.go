@@ -0,0 +1,192 @@
+// Package markdown renders the Markdown subset used in saved conversations to
+// HTML that is safe to serve to anyone. All input is HTML-escaped before any
+// formatting is applied, so raw HTML in the source is always shown as text, and
+// links are limited to http, https and mailto URLs.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRe      = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	fenceRe        = regexp.MustCompile("^\\s*(```|~~~)\\s*([\\w+#.-]*)")
+	ruleRe         = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	unorderedRe    = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedRe      = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	quoteRe        = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	imageRe        = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	linkRe         = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldStarRe     = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	boldUnderRe    = regexp.MustCompile(`__(\S(?:.*?\S)?)__`)
+	italicRe       = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`)
+	strikeRe       = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	allowedSchemes = []string{"http://", "https://", "mailto:"}
+)
+
+// Render converts Markdown to sanitized HTML
+func Render(source string) string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph []string
+	listTag := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			closeList()
+			fence := m[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			if m[2] != "" {
+				out.WriteString(`<pre><code class="language-` + html.EscapeString(m[2]) + `">`)
+			} else {
+				out.WriteString("<pre><code>")
+			}
+			out.WriteString(html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flushParagraph()
+			closeList()
+			continue
+		}
+
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			closeList()
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+			continue
+		}
+
+		if ruleRe.MatchString(line) {
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr>\n")
+			continue
+		}
+
+		if m := unorderedRe.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			openList("ul")
+			out.WriteString("<li>" + inline(m[1]) + "</li>\n")
+			continue
+		}
+
+		if m := orderedRe.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			openList("ol")
+			out.WriteString("<li>" + inline(m[1]) + "</li>\n")
+			continue
+		}
+
+		if m := quoteRe.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			closeList()
+			var quoted []string
+			quoted = append(quoted, inline(m[1]))
+			for i+1 < len(lines) {
+				next := quoteRe.FindStringSubmatch(lines[i+1])
+				if next == nil {
+					break
+				}
+				quoted = append(quoted, inline(next[1]))
+				i++
+			}
+			out.WriteString("<blockquote><p>" + strings.Join(quoted, "<br>\n") + "</p></blockquote>\n")
+			continue
+		}
+
+		closeList()
+		paragraph = append(paragraph, inline(line))
+	}
+
+	flushParagraph()
+	closeList()
+	return out.String()
+}
+
+// inline renders code spans, links and emphasis within a line of text
+func inline(text string) string {
+	// Odd segments between backticks are code spans, rendered verbatim
+	segments := strings.Split(text, "`")
+	if len(segments)%2 == 0 {
+		// Unbalanced backtick: keep the last one as text
+		last := len(segments) - 1
+		segments[last-1] += "`" + segments[last]
+		segments = segments[:last]
+	}
+
+	var out strings.Builder
+	for i, segment := range segments {
+		if i%2 == 1 {
+			out.WriteString("<code>" + html.EscapeString(segment) + "</code>")
+			continue
+		}
+		out.WriteString(formatText(html.EscapeString(segment)))
+	}
+	return out.String()
+}
+
+// formatText applies links and emphasis to already escaped text
+func formatText(escaped string) string {
+	// Images are not loaded from third parties; they become links
+	escaped = imageRe.ReplaceAllStringFunc(escaped, func(match string) string {
+		m := imageRe.FindStringSubmatch(match)
+		label := m[1]
+		if label == "" {
+			label = "image"
+		}
+		return renderLink(label, m[2], match)
+	})
+	escaped = linkRe.ReplaceAllStringFunc(escaped, func(match string) string {
+		m := linkRe.FindStringSubmatch(match)
+		return renderLink(m[1], m[2], match)
+	})
+	escaped = boldStarRe.ReplaceAllString(escaped, "<strong>$1</strong>")
+	escaped = boldUnderRe.ReplaceAllString(escaped, "<strong>$1</strong>")
+	escaped = italicRe.ReplaceAllString(escaped, "<em>$1</em>")
+	escaped = strikeRe.ReplaceAllString(escaped, "<del>$1</del>")
+	return escaped
+}
+
+// renderLink builds an anchor for an escaped label and URL, or returns
+// fallback when the URL scheme is not allowed
+func renderLink(label, url, fallback string) string {
+	lower := strings.ToLower(url)
+	for _, scheme := range allowedSchemes {
+		if strings.HasPrefix(lower, scheme) {
+			return `<a href="` + url + `" rel="nofollow noopener noreferrer">` + label + `</a>`
+		}
+	}
+	return fallback
+}
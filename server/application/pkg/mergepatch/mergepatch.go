@@ -0,0 +1,89 @@
+// Package mergepatch applies JSON Merge Patch documents (RFC 7386) to the JSON
+// form of API resources.
+//
+// A patch is a JSON object holding the members to change: a null member
+// removes the member from the target, an object member is merged recursively,
+// and any other value replaces the target member. Members absent from the
+// patch are left alone.
+package mergepatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotObject is returned for a patch that is not a JSON object. RFC 7386 lets
+// such a patch replace the whole target, which makes no sense for a resource.
+var ErrNotObject = errors.New("patch must be a JSON object")
+
+// Apply applies patch to the JSON encoding of doc and decodes the result into
+// out, which must point to a zero value of doc's type so that removed members
+// end up zero. Members named in readOnly may not appear in the patch.
+func Apply(doc interface{}, patch []byte, out interface{}, readOnly ...string) error {
+	var p interface{}
+	if err := decode(patch, &p); err != nil {
+		return fmt.Errorf("invalid patch: %w", err)
+	}
+	members, ok := p.(map[string]interface{})
+	if !ok {
+		return ErrNotObject
+	}
+	for _, name := range readOnly {
+		if _, ok := members[name]; ok {
+			return fmt.Errorf("%s cannot be changed", name)
+		}
+	}
+
+	target, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode patch target: %w", err)
+	}
+	var t interface{}
+	if err := decode(target, &t); err != nil {
+		return fmt.Errorf("failed to decode patch target: %w", err)
+	}
+
+	merged, err := json.Marshal(merge(t, p))
+	if err != nil {
+		return fmt.Errorf("failed to encode patched document: %w", err)
+	}
+	if err := json.Unmarshal(merged, out); err != nil {
+		return fmt.Errorf("invalid patch: %w", err)
+	}
+	return nil
+}
+
+// merge implements the MergePatch function of RFC 7386
+func merge(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	result, ok := target.(map[string]interface{})
+	if !ok {
+		result = map[string]interface{}{}
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(result, name)
+			continue
+		}
+		result[name] = merge(result[name], value)
+	}
+	return result
+}
+
+// decode parses a JSON document, keeping numbers as written
+func decode(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after JSON document")
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+-- Multi-user tenancy
+-- Adds a users table and an owner (user_id) on conversations, snippets,
+-- collections and settings. Rows created before this migration are assigned
+-- to the "default" user so existing single-user installs keep their data.
+
+-- Users table
+CREATE TABLE IF NOT EXISTS "mfo-server".users (
+    id SERIAL PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+INSERT INTO "mfo-server".users (username) VALUES ('default')
+ON CONFLICT (username) DO NOTHING;
+
+-- Conversations: owner + per-user canonical URL uniqueness
+ALTER TABLE "mfo-server".conversations
+    ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES "mfo-server".users(id) ON DELETE CASCADE;
+UPDATE "mfo-server".conversations
+SET user_id = (SELECT id FROM "mfo-server".users WHERE username = 'default')
+WHERE user_id IS NULL;
+ALTER TABLE "mfo-server".conversations ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE "mfo-server".conversations DROP CONSTRAINT IF EXISTS conversations_canonical_url_key;
+ALTER TABLE "mfo-server".conversations
+    ADD CONSTRAINT conversations_user_canonical_url_key UNIQUE (user_id, canonical_url);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON "mfo-server".conversations(user_id);
+
+-- Snippets: owner
+ALTER TABLE "mfo-server".snippets
+    ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES "mfo-server".users(id) ON DELETE CASCADE;
+UPDATE "mfo-server".snippets
+SET user_id = (SELECT id FROM "mfo-server".users WHERE username = 'default')
+WHERE user_id IS NULL;
+ALTER TABLE "mfo-server".snippets ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_user_id ON "mfo-server".snippets(user_id);
+
+-- Collections: owner + per-user name uniqueness
+ALTER TABLE "mfo-server".collections
+    ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES "mfo-server".users(id) ON DELETE CASCADE;
+UPDATE "mfo-server".collections
+SET user_id = (SELECT id FROM "mfo-server".users WHERE username = 'default')
+WHERE user_id IS NULL;
+ALTER TABLE "mfo-server".collections ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE "mfo-server".collections DROP CONSTRAINT IF EXISTS collections_name_key;
+ALTER TABLE "mfo-server".collections
+    ADD CONSTRAINT collections_user_name_key UNIQUE (user_id, name);
+
+CREATE INDEX IF NOT EXISTS idx_collections_user_id ON "mfo-server".collections(user_id);
+
+-- Settings: one row per user instead of a single global row
+ALTER TABLE "mfo-server".settings DROP CONSTRAINT IF EXISTS single_settings_row;
+
+CREATE SEQUENCE IF NOT EXISTS "mfo-server".settings_id_seq OWNED BY "mfo-server".settings.id;
+SELECT setval(
+    '"mfo-server".settings_id_seq',
+    COALESCE((SELECT MAX(id) FROM "mfo-server".settings), 0) + 1,
+    false
+);
+ALTER TABLE "mfo-server".settings
+    ALTER COLUMN id SET DEFAULT nextval('"mfo-server".settings_id_seq');
+
+ALTER TABLE "mfo-server".settings
+    ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES "mfo-server".users(id) ON DELETE CASCADE;
+UPDATE "mfo-server".settings
+SET user_id = (SELECT id FROM "mfo-server".users WHERE username = 'default')
+WHERE user_id IS NULL;
+ALTER TABLE "mfo-server".settings ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE "mfo-server".settings
+    ADD CONSTRAINT settings_user_id_key UNIQUE (user_id);
@@ -0,0 +1,18 @@
+-- Per-user API keys
+-- Keys are only stored as SHA-256 hashes; the prefix is kept in clear so
+-- users can recognise a key in listings.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".api_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix VARCHAR(32) NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON "mfo-server".api_keys(user_id);
@@ -0,0 +1,6 @@
+-- Browser session cookies
+-- Cookie sessions reuse auth_sessions. The cookie value and the CSRF token
+-- handed to the browser are stored as hashes; both are NULL for token sessions.
+
+ALTER TABLE "mfo-server".auth_sessions ADD COLUMN IF NOT EXISTS cookie_hash TEXT UNIQUE;
+ALTER TABLE "mfo-server".auth_sessions ADD COLUMN IF NOT EXISTS csrf_hash TEXT;
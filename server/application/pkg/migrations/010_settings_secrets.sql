@@ -0,0 +1,27 @@
+-- Settings secrets
+-- The settings API key is only kept as a SHA-256 hash, plus a redacted hint
+-- ("sk_…abcd") shown in responses. Existing keys are converted and the
+-- plaintext column is dropped.
+
+ALTER TABLE "mfo-server".settings ADD COLUMN IF NOT EXISTS api_key_hash TEXT;
+ALTER TABLE "mfo-server".settings ADD COLUMN IF NOT EXISTS api_key_hint TEXT;
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'mfo-server'
+        AND table_name = 'settings'
+        AND column_name = 'api_key'
+    ) THEN
+        UPDATE "mfo-server".settings
+        SET api_key_hash = encode(sha256(convert_to(api_key, 'UTF8')), 'hex'),
+            api_key_hint = CASE
+                WHEN char_length(api_key) >= 12 THEN left(api_key, 3) || '…' || right(api_key, 4)
+                ELSE '…'
+            END
+        WHERE api_key IS NOT NULL AND api_key <> '';
+
+        ALTER TABLE "mfo-server".settings DROP COLUMN api_key;
+    END IF;
+END $$;
@@ -0,0 +1,50 @@
+-- Team workspaces
+-- A workspace groups users with a role (viewer, editor or admin). Collections
+-- can belong to a workspace, and the conversations and snippets filed in them
+-- become visible to its members. Members join by redeeming an invitation token;
+-- only the token hash is stored.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".workspaces (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_by INTEGER REFERENCES "mfo-server".users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "mfo-server".workspace_members (
+    workspace_id INTEGER NOT NULL REFERENCES "mfo-server".workspaces(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON "mfo-server".workspace_members(user_id);
+
+CREATE TABLE IF NOT EXISTS "mfo-server".workspace_invitations (
+    id SERIAL PRIMARY KEY,
+    workspace_id INTEGER NOT NULL REFERENCES "mfo-server".workspaces(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+    prefix VARCHAR(32) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_by INTEGER REFERENCES "mfo-server".users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    accepted_by INTEGER REFERENCES "mfo-server".users(id) ON DELETE SET NULL,
+    accepted_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_invitations_workspace_id ON "mfo-server".workspace_invitations(workspace_id);
+
+-- Collections of a deleted workspace fall back to their creator
+ALTER TABLE "mfo-server".collections
+    ADD COLUMN IF NOT EXISTS workspace_id INTEGER REFERENCES "mfo-server".workspaces(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_collections_workspace_id ON "mfo-server".collections(workspace_id);
+
+-- Snippets can be filed in a collection, like conversations
+ALTER TABLE "mfo-server".snippets
+    ADD COLUMN IF NOT EXISTS collection_id INTEGER REFERENCES "mfo-server".collections(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_collection_id ON "mfo-server".snippets(collection_id);
@@ -0,0 +1,22 @@
+-- Trash
+-- Deleting a conversation, snippet or collection sets deleted_at instead of
+-- removing the row, so it can be restored with its relationships. Rows are
+-- removed for good once they have been in the trash for the retention period.
+-- Canonical URLs and collection names only need to be unique among live rows,
+-- so a trashed conversation does not prevent saving its URL again.
+
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE "mfo-server".snippets ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE "mfo-server".collections ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_conversations_deleted_at ON "mfo-server".conversations(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_snippets_deleted_at ON "mfo-server".snippets(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_collections_deleted_at ON "mfo-server".collections(deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE "mfo-server".conversations DROP CONSTRAINT IF EXISTS conversations_user_canonical_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS conversations_user_canonical_url_key
+    ON "mfo-server".conversations(user_id, canonical_url) WHERE deleted_at IS NULL;
+
+ALTER TABLE "mfo-server".collections DROP CONSTRAINT IF EXISTS collections_user_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS collections_user_name_key
+    ON "mfo-server".collections(user_id, name) WHERE deleted_at IS NULL;
@@ -0,0 +1,8 @@
+-- Content fingerprints
+-- SimHash of the content of each conversation (see pkg/fingerprint), stored as
+-- the signed 64-bit pattern of the unsigned fingerprint. Conversations whose
+-- fingerprints differ in few bits are near-duplicates. NULL until computed, and
+-- for content without words. It is kept in clear text even when content is
+-- encrypted: it tells how alike two conversations are, not what they say.
+
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS content_fingerprint BIGINT;
@@ -0,0 +1,41 @@
+-- Attachments
+-- Images and files of a conversation, optionally tied to one of its messages by
+-- ordinal (message rows are rebuilt on every save). The bytes live in the blob
+-- store on disk, under the SHA-256 of their content, so attachments with the
+-- same content share one blob. user_id is the user who attached the file.
+--
+-- attachment_uploads tracks files uploaded in several parts: received is the
+-- number of bytes stored so far, out of size. A row becomes an attachment when
+-- the last part arrives, and is dropped when it expires unfinished.
+
+CREATE TABLE IF NOT EXISTS "mfo-server".attachments (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    conversation_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    message_ordinal INTEGER,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 TEXT NOT NULL,
+    source_url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_conversation_id ON "mfo-server".attachments(conversation_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_sha256 ON "mfo-server".attachments(sha256);
+
+CREATE TABLE IF NOT EXISTS "mfo-server".attachment_uploads (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "mfo-server".users(id) ON DELETE CASCADE,
+    conversation_id INTEGER NOT NULL REFERENCES "mfo-server".conversations(id) ON DELETE CASCADE,
+    message_ordinal INTEGER,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    received BIGINT NOT NULL DEFAULT 0,
+    source_url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_uploads_expires_at ON "mfo-server".attachment_uploads(expires_at);
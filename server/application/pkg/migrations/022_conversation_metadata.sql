@@ -0,0 +1,21 @@
+-- Conversation metadata
+-- Fields derived from the content of each conversation on every save (see
+-- pkg/enrichment): word and turn counts, the language of the prose, fenced code
+-- blocks and their languages, the model named in the content, and the dates
+-- of the first and last messages when the content shows them. word_count is
+-- NULL until computed, for conversations saved before these columns existed.
+-- They are kept in clear text even when content is encrypted, like titles and
+-- tags, so that searches can filter on them.
+
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS word_count INTEGER;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS turn_count INTEGER;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS language TEXT;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS code_block_count INTEGER;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS code_languages TEXT[];
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS model TEXT;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS first_message_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE "mfo-server".conversations ADD COLUMN IF NOT EXISTS last_message_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_conversations_language ON "mfo-server".conversations(language);
+CREATE INDEX IF NOT EXISTS idx_conversations_model ON "mfo-server".conversations(model);
+CREATE INDEX IF NOT EXISTS idx_conversations_code_languages ON "mfo-server".conversations USING GIN(code_languages);
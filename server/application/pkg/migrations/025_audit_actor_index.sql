@@ -0,0 +1,6 @@
+-- Audit events by actor
+-- Workspace editors and admins change items owned by other members; those
+-- events are filed under the owner (user_id) and listed to the actor as well,
+-- by actor_id.
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_created ON "mfo-server".audit_events(actor_id, created_at DESC);
@@ -0,0 +1,81 @@
+// Package pricing turns token counts into estimated costs with a price table
+// read from a JSON file:
+//
+//	{
+//	  "currency": "USD",
+//	  "default": {"input_per_million": 2.5, "output_per_million": 10},
+//	  "sources": {
+//	    "claude": {"input_per_million": 3, "output_per_million": 15}
+//	  }
+//	}
+//
+// Prices are per million tokens. Input prices apply to what was sent to the
+// model (user, system and tool messages), output prices to its answers.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Price is what a million input and output tokens cost
+type Price struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// Cost returns the cost of input and output tokens
+func (p Price) Cost(input, output int64) float64 {
+	return (float64(input)*p.InputPerMillion + float64(output)*p.OutputPerMillion) / 1e6
+}
+
+// Table holds the price of the tokens of each source
+type Table struct {
+	Currency string           `json:"currency"`
+	Default  *Price           `json:"default,omitempty"`
+	Sources  map[string]Price `json:"sources"`
+}
+
+// Load reads a price table from the JSON file at path. It returns nil when
+// path is empty, which disables cost estimates.
+func Load(path string) (*Table, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("invalid price table: %w", err)
+	}
+	if table.Currency == "" {
+		table.Currency = "USD"
+	}
+	for source, price := range table.Sources {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 {
+			return nil, fmt.Errorf("invalid price table: negative price for %s", source)
+		}
+	}
+	if table.Default != nil && (table.Default.InputPerMillion < 0 || table.Default.OutputPerMillion < 0) {
+		return nil, fmt.Errorf("invalid price table: negative default price")
+	}
+	return &table, nil
+}
+
+// ForSource returns the price of the tokens of source, or false if the table
+// has neither a price for it nor a default one. A nil table has no prices.
+func (t *Table) ForSource(source string) (Price, bool) {
+	if t == nil {
+		return Price{}, false
+	}
+	if price, ok := t.Sources[source]; ok {
+		return price, true
+	}
+	if t.Default != nil {
+		return *t.Default, true
+	}
+	return Price{}, false
+}
@@ -0,0 +1,198 @@
+// Package segments tells the answer of an AI chat message apart from the
+// reasoning trace, tool calls and citations captured with it.
+//
+// Providers that show their reasoning or their web searches leave them in the
+// page text the browser extension saves: Kimi's "Thinking complete" followed
+// by its reasoning and "Fetch URLs / 1 pages" residue, DeepSeek's "Thought
+// for 12 seconds", Perplexity's "60 sources" and source chips. Split finds
+// them with the rules of the message's source, on top of rules shared by all
+// sources, and returns the text as a sequence of typed segments.
+package segments
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Segment kinds
+const (
+	// KindAnswer is the text of the message itself
+	KindAnswer = "answer"
+	// KindReasoning is a reasoning trace, from its header ("Thinking
+	// complete", "Thought for 12 seconds"...) to its end
+	KindReasoning = "reasoning"
+	// KindToolCall is the residue of a tool call, such as a web search with
+	// its number of results
+	KindToolCall = "tool_call"
+	// KindCitation is a list or count of the sources of an answer
+	KindCitation = "citation"
+)
+
+// Segment is a part of the text of a message
+type Segment struct {
+	Kind string
+	Text string
+}
+
+// Rules find the segments of the messages of a source. Patterns match text
+// preceded by the start of a line or a gap of two or more spaces, and mark
+// the segment matched by their first group.
+type Rules struct {
+	// Reasoning match the headers of reasoning traces; a trace runs from its
+	// header to ReasoningEnd or the next tool call or citation
+	Reasoning []*regexp.Regexp
+	// ReasoningEnd matches the end of a reasoning trace, a blank line when nil
+	ReasoningEnd *regexp.Regexp
+	ToolCalls    []*regexp.Regexp
+	Citations    []*regexp.Regexp
+}
+
+// pattern compiles expr so that it only matches at the start of a line or
+// after a gap, as the blocks of a page are separated in captured text
+func pattern(expr string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)(?:^|[ \t]{2,})(` + expr + `)`)
+}
+
+// blankLineRe ends reasoning traces by default
+var blankLineRe = regexp.MustCompile(`\n[ \t]*\n`)
+
+// common are the rules of every source: the reasoning headers of the providers
+var common = Rules{
+	Reasoning: []*regexp.Regexp{
+		pattern(`(?i:thinking complete(?:d)?|thought for \d+(?:\.\d+)?\s*(?:seconds?|s)|reasoned for \d+(?:\.\d+)?\s*(?:seconds?|minutes?|s|m))[ \t]*(?:$|\n|[ \t]{2,})`),
+		pattern(`(?:已深度思考|已思考)[（(]用时\s*\d+\s*秒[)）][ \t]*(?:$|\n)`),
+	},
+}
+
+// sources are the rules of each source, keyed by source ID (see pkg/sources)
+var sources = map[string]Rules{
+	// Kimi captures come flattened: the blocks of the page are only
+	// separated by runs of spaces
+	"kimi": {
+		ReasoningEnd: regexp.MustCompile(`\n[ \t]*\n|[ \t]{2,}`),
+		ToolCalls: []*regexp.Regexp{
+			pattern(`(?:Fetch URLs|Search [^\n]{1,200}?)[ \t]+\d+[ \t]+(?:pages?|results?)(?:[ \t]{2,}[^\n]{1,160}?[ \t]{2,}|[ \t]{2,}[^\n]{1,160}$)?`),
+		},
+	},
+	"deepseek": {
+		ToolCalls: []*regexp.Regexp{
+			pattern(`(?:Found|Read) \d+ web pages?[ \t]*$`),
+			pattern(`已(?:搜索到|阅读)\s*\d+\s*个网页[ \t]*$`),
+		},
+	},
+	"qwen": {
+		ToolCalls: []*regexp.Regexp{
+			pattern(`Searched \d+ (?:web pages?|sources?)[ \t]*$`),
+		},
+	},
+	"perplexity": {
+		Citations: []*regexp.Regexp{
+			pattern(`\d+ sources?[ \t]*$`),
+			// Source chips: the site name, then the number of other sources
+			pattern(`[\p{L}\p{N}._-]{2,40}\n\+\d+(?:\n\x{200b})?[ \t]*$`),
+		},
+	},
+	"grok": {
+		Citations: []*regexp.Regexp{
+			// The answer time, then the number of sources
+			pattern(`(?:\d+(?:\.\d+)?s\n)?\d+ sources?[ \t]*$`),
+		},
+	},
+	"manus": {
+		ToolCalls: []*regexp.Regexp{
+			pattern(`(?:Searching|Browsing|Reading file|Creating file|Editing file|Executing command)\n[^\n]{1,300}(?:\n\d{1,2}:\d{2})?[ \t]*$`),
+		},
+	},
+}
+
+// span is a segment found in the text, by byte offsets
+type span struct {
+	kind       string
+	start, end int
+}
+
+// Split returns the segments of text, a message of a conversation saved from
+// source, in order. The text between reasoning traces, tool calls and
+// citations makes answer segments. Segments are trimmed of surrounding white
+// space, and white space between them is dropped.
+func Split(source, text string) []Segment {
+	rules := sources[source]
+	reasoning := append(append([]*regexp.Regexp{}, common.Reasoning...), rules.Reasoning...)
+	end := rules.ReasoningEnd
+	if end == nil {
+		end = blankLineRe
+	}
+
+	var found []span
+	for _, re := range append(append([]*regexp.Regexp{}, common.ToolCalls...), rules.ToolCalls...) {
+		found = append(found, matches(re, text, KindToolCall)...)
+	}
+	for _, re := range append(append([]*regexp.Regexp{}, common.Citations...), rules.Citations...) {
+		found = append(found, matches(re, text, KindCitation)...)
+	}
+	found = removeOverlaps(found)
+
+	// Reasoning runs past its header to its end, but not into the next tool
+	// call or citation
+	var traces []span
+	for _, re := range reasoning {
+		for _, header := range matches(re, text, KindReasoning) {
+			body := header.end + len(text[header.end:]) - len(strings.TrimLeft(text[header.end:], " \t\n"))
+			stop := len(text)
+			if loc := end.FindStringIndex(text[body:]); loc != nil {
+				stop = body + loc[0]
+			}
+			for _, s := range found {
+				if s.start >= header.end && s.start < stop {
+					stop = s.start
+				}
+			}
+			traces = append(traces, span{kind: KindReasoning, start: header.start, end: stop})
+		}
+	}
+	found = removeOverlaps(append(found, traces...))
+
+	var segments []Segment
+	add := func(kind, part string) {
+		if part = strings.TrimSpace(part); part != "" {
+			segments = append(segments, Segment{Kind: kind, Text: part})
+		}
+	}
+	pos := 0
+	for _, s := range found {
+		add(KindAnswer, text[pos:s.start])
+		add(s.kind, text[s.start:s.end])
+		pos = s.end
+	}
+	add(KindAnswer, text[pos:])
+	return segments
+}
+
+// matches returns the spans of the first group of the matches of re
+func matches(re *regexp.Regexp, text, kind string) []span {
+	var spans []span
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		spans = append(spans, span{kind: kind, start: loc[2], end: loc[3]})
+	}
+	return spans
+}
+
+// removeOverlaps sorts spans and drops those overlapping an earlier one; of
+// spans starting together, the longest is kept
+func removeOverlaps(spans []span) []span {
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+	kept := spans[:0]
+	for _, s := range spans {
+		if len(kept) > 0 && s.start < kept[len(kept)-1].end {
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
@@ -0,0 +1,209 @@
+// Package sources is the registry of the AI chat providers conversations are
+// saved from, and turns the URLs of their pages into canonical URLs.
+//
+// A provider serves the same conversation under several URLs: an older
+// domain (chat.openai.com and chatgpt.com), a path inside a project or custom
+// assistant, query parameters such as the selected model, or a fragment
+// pointing at a message. Canonicalize maps all of them to one URL, so that a
+// conversation is saved once whatever page it was captured from.
+package sources
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Other is the source of conversations saved from a page of no known provider
+const Other = "other"
+
+// Source is a provider of the registry
+type Source struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Domains are the hosts the provider serves its pages from; the first
+	// one is used in canonical URLs
+	Domains []string `json:"domains"`
+	IconURL string   `json:"icon_url"`
+	// ConversationPatterns and SharePatterns match the paths of conversation
+	// pages and of public share pages
+	ConversationPatterns []string `json:"conversation_patterns"`
+	SharePatterns        []string `json:"share_patterns"`
+
+	conversations []pathRule
+	shares        []pathRule
+}
+
+// pathRule rewrites the paths matching pattern to path, a template that may
+// refer to the submatches of pattern as $1, $2...
+type pathRule struct {
+	pattern *regexp.Regexp
+	path    string
+}
+
+func rule(pattern, path string) pathRule {
+	return pathRule{pattern: regexp.MustCompile(pattern), path: path}
+}
+
+// registry lists the known providers, matching the sources of the browser extension
+var registry = []*Source{
+	{
+		ID: "chatgpt", Name: "ChatGPT",
+		Domains: []string{"chatgpt.com", "www.chatgpt.com", "chat.openai.com"},
+		IconURL: "https://chatgpt.com/favicon.ico",
+		// Conversations of custom GPTs and projects live under /g/<id>/
+		conversations: []pathRule{rule(`^(?:/g/[^/]+)?/c/([0-9A-Za-z-]+)`, "/c/$1")},
+		shares:        []pathRule{rule(`^/share/([0-9A-Za-z-]+)`, "/share/$1")},
+	},
+	{
+		ID: "claude", Name: "Claude",
+		Domains:       []string{"claude.ai"},
+		IconURL:       "https://claude.ai/favicon.ico",
+		conversations: []pathRule{rule(`^/chat/([0-9A-Za-z-]+)`, "/chat/$1")},
+		shares:        []pathRule{rule(`^/share/([0-9A-Za-z-]+)`, "/share/$1")},
+	},
+	{
+		ID: "perplexity", Name: "Perplexity",
+		Domains:       []string{"www.perplexity.ai", "perplexity.ai"},
+		IconURL:       "https://www.perplexity.ai/favicon.ico",
+		conversations: []pathRule{rule(`^/search/([^/]+)`, "/search/$1")},
+		shares:        []pathRule{rule(`^/page/([^/]+)`, "/page/$1")},
+	},
+	{
+		ID: "kimi", Name: "Kimi",
+		Domains:       []string{"www.kimi.com", "kimi.com", "kimi.moonshot.cn"},
+		IconURL:       "https://www.kimi.com/favicon.ico",
+		conversations: []pathRule{rule(`^/chat/([0-9A-Za-z-]+)`, "/chat/$1")},
+		shares:        []pathRule{rule(`^/share/([0-9A-Za-z-]+)`, "/share/$1")},
+	},
+	{
+		ID: "mistral", Name: "Le Chat",
+		Domains:       []string{"chat.mistral.ai"},
+		IconURL:       "https://mistral.ai/favicon.ico",
+		conversations: []pathRule{rule(`^/chat/([0-9A-Za-z-]+)`, "/chat/$1")},
+		shares:        []pathRule{rule(`^/share/([0-9A-Za-z-]+)`, "/share/$1")},
+	},
+	{
+		ID: "deepseek", Name: "DeepSeek",
+		Domains:       []string{"chat.deepseek.com"},
+		IconURL:       "https://chat.deepseek.com/favicon.ico",
+		conversations: []pathRule{rule(`^/a/chat/s/([0-9A-Za-z-]+)`, "/a/chat/s/$1")},
+		shares:        []pathRule{rule(`^/share/([0-9A-Za-z-]+)`, "/share/$1")},
+	},
+	{
+		ID: "qwen", Name: "Qwen",
+		Domains:       []string{"chat.qwen.ai"},
+		IconURL:       "https://chat.qwen.ai/favicon.ico",
+		conversations: []pathRule{rule(`^/c/([0-9A-Za-z-]+)`, "/c/$1")},
+		shares:        []pathRule{rule(`^/s/([0-9A-Za-z-]+)`, "/s/$1")},
+	},
+	{
+		ID: "manus", Name: "Manus",
+		Domains:       []string{"manus.im"},
+		IconURL:       "https://manus.im/favicon.ico",
+		conversations: []pathRule{rule(`^/app/([0-9A-Za-z-]+)`, "/app/$1")},
+		shares:        []pathRule{rule(`^/share/([0-9A-Za-z-]+)`, "/share/$1")},
+	},
+	{
+		ID: "grok", Name: "Grok",
+		Domains:       []string{"grok.com"},
+		IconURL:       "https://grok.com/favicon.ico",
+		conversations: []pathRule{rule(`^/(?:project/[^/]+/)?chat/([0-9A-Za-z-]+)`, "/chat/$1")},
+		shares:        []pathRule{rule(`^/share/([0-9A-Za-z_-]+)`, "/share/$1")},
+	},
+}
+
+// byDomain maps every domain of the registry to its source
+var byDomain = map[string]*Source{}
+
+func init() {
+	for _, source := range registry {
+		for _, domain := range source.Domains {
+			byDomain[domain] = source
+		}
+		for _, r := range source.conversations {
+			source.ConversationPatterns = append(source.ConversationPatterns, r.pattern.String())
+		}
+		for _, r := range source.shares {
+			source.SharePatterns = append(source.SharePatterns, r.pattern.String())
+		}
+	}
+}
+
+// trackingParams are query parameters that never select content
+var trackingParams = map[string]bool{
+	"utm_source":   true,
+	"utm_medium":   true,
+	"utm_campaign": true,
+	"utm_term":     true,
+	"utm_content":  true,
+	"ref":          true,
+	"ref_src":      true,
+	"source":       true,
+}
+
+// All returns the providers of the registry
+func All() []*Source {
+	return registry
+}
+
+// Canonicalize returns the canonical form of rawURL and the provider serving
+// it, or nil for pages of no known provider. Conversation and share pages of
+// a provider keep only the provider's first domain and the path naming the
+// conversation. Other URLs lose their fragment, tracking parameters and
+// trailing slash, and keep their other query parameters in sorted order.
+// Text that does not parse as an absolute URL is returned trimmed.
+func Canonicalize(rawURL string) (string, *Source) {
+	trimmed := strings.TrimSpace(rawURL)
+	u, err := url.Parse(trimmed)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return trimmed, nil
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+
+	source := byDomain[u.Hostname()]
+	if source != nil {
+		u.Scheme = "https"
+		u.Host = source.Domains[0]
+		if path, ok := rewritePath(u.Path, source.conversations, source.shares); ok {
+			u.Path = path
+			u.RawPath = ""
+			u.RawQuery = ""
+			return u.String(), source
+		}
+	}
+
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+	u.RawQuery = withoutTracking(u.Query())
+	return u.String(), source
+}
+
+// rewritePath applies the first rule of rules matching path
+func rewritePath(path string, rules ...[]pathRule) (string, bool) {
+	for _, group := range rules {
+		for _, r := range group {
+			if match := r.pattern.FindStringSubmatchIndex(path); match != nil {
+				return string(r.pattern.ExpandString(nil, r.path, path, match)), true
+			}
+		}
+	}
+	return "", false
+}
+
+// withoutTracking returns query without tracking parameters, encoded in key order
+func withoutTracking(query url.Values) string {
+	for key := range query {
+		if trackingParams[key] {
+			query.Del(key)
+		}
+	}
+	return query.Encode()
+}
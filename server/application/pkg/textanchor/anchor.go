@@ -0,0 +1,116 @@
+// Package textanchor anchors ranges of a text by both their position and their
+// content, so that they can be found again after the text changes.
+//
+// Positions count characters (Unicode code points), not bytes. An anchor keeps
+// the quoted text and a little of the text around it; when the text changes,
+// the quote is looked for again, and the context decides between several
+// occurrences.
+package textanchor
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ContextLength is the number of characters kept on each side of a quote
+const ContextLength = 32
+
+// Anchor is the range [Start, End) of a text, with the text it covers and the
+// text just before and after it
+type Anchor struct {
+	Start  int
+	End    int
+	Quote  string
+	Prefix string
+	Suffix string
+}
+
+// New returns the anchor of the range [start, end) of text, or false if the
+// range is empty or out of the text
+func New(text string, start, end int) (Anchor, bool) {
+	runes := []rune(text)
+	if start < 0 || end <= start || end > len(runes) {
+		return Anchor{}, false
+	}
+	return anchorAt(runes, start, end), true
+}
+
+// Find returns the anchor of the first occurrence of quote in text whose
+// position is closest to start, or false if text does not contain it
+func Find(text, quote string, start int) (Anchor, bool) {
+	return Locate(text, Anchor{Start: start, End: start + utf8.RuneCountInString(quote), Quote: quote})
+}
+
+// Locate finds an anchor again in text, possibly changed since the anchor was
+// made. It returns the anchor unchanged if its range still holds the quote.
+// Otherwise it returns the anchor of the occurrence of the quote that best
+// matches its context, then is closest to its former position, or false if
+// text no longer contains the quote.
+func Locate(text string, a Anchor) (Anchor, bool) {
+	if a.Quote == "" {
+		return a, false
+	}
+	runes := []rune(text)
+	if a.Start >= 0 && a.End <= len(runes) && a.Start < a.End && string(runes[a.Start:a.End]) == a.Quote {
+		return anchorAt(runes, a.Start, a.End), true
+	}
+
+	quoteLength := utf8.RuneCountInString(a.Quote)
+	best, bestScore, bestDistance := -1, -1, 0
+	offset, position := 0, 0
+	for {
+		i := strings.Index(text[offset:], a.Quote)
+		if i < 0 {
+			break
+		}
+		position += utf8.RuneCountInString(text[offset : offset+i])
+		offset += i
+
+		score := commonSuffix(text[:offset], a.Prefix) + commonPrefix(text[offset+len(a.Quote):], a.Suffix)
+		distance := position - a.Start
+		if distance < 0 {
+			distance = -distance
+		}
+		if score > bestScore || (score == bestScore && distance < bestDistance) {
+			best, bestScore, bestDistance = position, score, distance
+		}
+
+		// Occurrences may overlap: go on from the next character
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+		position++
+	}
+	if best < 0 {
+		return a, false
+	}
+	return anchorAt(runes, best, best+quoteLength), true
+}
+
+// anchorAt returns the anchor of the range [start, end) of runes
+func anchorAt(runes []rune, start, end int) Anchor {
+	return Anchor{
+		Start:  start,
+		End:    end,
+		Quote:  string(runes[start:end]),
+		Prefix: string(runes[max(start-ContextLength, 0):start]),
+		Suffix: string(runes[end:min(end+ContextLength, len(runes))]),
+	}
+}
+
+// commonPrefix returns the number of bytes a and b start with in common
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// commonSuffix returns the number of bytes a and b end with in common
+func commonSuffix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,59 @@
+// Package textdiff compares texts: compact deltas to store successive versions
+// of a text, and unified diffs to show the changes between two of them.
+package textdiff
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Delta turns a text into another one by replacing everything between a
+// common prefix and a common suffix. It is small when the texts only differ
+// in one place, as when a conversation grows by new messages.
+type Delta struct {
+	// Prefix and Suffix are the lengths in bytes of the common prefix and suffix
+	Prefix int
+	Suffix int
+	// Text replaces the part of the base text between them
+	Text string
+}
+
+// Compute returns the delta turning base into target
+func Compute(base, target string) Delta {
+	prefix := 0
+	for prefix < len(base) && prefix < len(target) && base[prefix] == target[prefix] {
+		prefix++
+	}
+	// Keep the replaced parts valid UTF-8
+	for prefix > 0 && prefix < len(target) && !utf8.RuneStart(target[prefix]) {
+		prefix--
+	}
+
+	suffix := 0
+	for suffix < len(base)-prefix && suffix < len(target)-prefix &&
+		base[len(base)-1-suffix] == target[len(target)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && suffix < len(target)-prefix && !utf8.RuneStart(target[len(target)-suffix]) {
+		suffix--
+	}
+
+	return Delta{
+		Prefix: prefix,
+		Suffix: suffix,
+		Text:   target[prefix : len(target)-suffix],
+	}
+}
+
+// Apply returns the target text of the delta from its base text
+func (d Delta) Apply(base string) (string, error) {
+	if d.Prefix < 0 || d.Suffix < 0 || d.Prefix+d.Suffix > len(base) {
+		return "", fmt.Errorf("delta does not apply to a text of %d bytes", len(base))
+	}
+	return base[:d.Prefix] + d.Text + base[len(base)-d.Suffix:], nil
+}
+
+// Size returns the number of bytes the delta stores
+func (d Delta) Size() int {
+	return len(d.Text)
+}
@@ -0,0 +1,38 @@
+package textdiff
+
+// Overlap returns the length in bytes of the longest suffix of a that is also a
+// prefix of b, found with the Knuth-Morris-Pratt failure function in linear time
+func Overlap(a, b string) int {
+	if a == "" || b == "" {
+		return 0
+	}
+
+	// fail[i] is the length of the longest proper prefix of b[:i+1] that is also its suffix
+	fail := make([]int, len(b))
+	for i, k := 1, 0; i < len(b); i++ {
+		for k > 0 && b[i] != b[k] {
+			k = fail[k-1]
+		}
+		if b[i] == b[k] {
+			k++
+		}
+		fail[i] = k
+	}
+
+	k := 0
+	for i := 0; i < len(a); i++ {
+		for k > 0 && (k == len(b) || a[i] != b[k]) {
+			k = fail[k-1]
+		}
+		if a[i] == b[k] {
+			k++
+		}
+	}
+	return k
+}
+
+// CommonPrefix returns the length in bytes of the longest common prefix of a
+// and b, cut to a whole number of UTF-8 characters
+func CommonPrefix(a, b string) int {
+	return Compute(a, b).Prefix
+}
@@ -0,0 +1,230 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// contextLines is the number of unchanged lines shown around changes
+	contextLines = 3
+	// maxEdits bounds the work of the line diff; texts differing by more
+	// lines are shown as entirely replaced between their common ends
+	maxEdits = 4000
+)
+
+// edit is one line of a diff: op is ' ' for an unchanged line, '-' for a line
+// only in the old text and '+' for a line only in the new text
+type edit struct {
+	op   byte
+	line string
+}
+
+// Unified returns the changes from oldText to newText in unified diff format,
+// with oldName and newName in the file headers. It returns "" if the texts are equal.
+func Unified(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	edits := diffLines(splitLines(oldText), splitLines(newText))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	oldLine, newLine := 1, 1
+	pos := 0
+	for pos < len(edits) {
+		first := pos
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+
+		// Changes separated by few unchanged lines share a hunk
+		last := first
+		for i := first + 1; i < len(edits) && i-last-1 <= 2*contextLines; i++ {
+			if edits[i].op != ' ' {
+				last = i
+			}
+		}
+		from := max(pos, first-contextLines)
+		end := min(last+contextLines+1, len(edits))
+
+		for _, e := range edits[pos:from] {
+			oldLine, newLine = advance(e, oldLine, newLine)
+		}
+		writeHunk(&b, edits[from:end], oldLine, newLine)
+		for _, e := range edits[from:end] {
+			oldLine, newLine = advance(e, oldLine, newLine)
+		}
+		pos = end
+	}
+
+	return b.String()
+}
+
+// writeHunk writes a hunk header and its lines
+func writeHunk(b *strings.Builder, hunk []edit, oldLine, newLine int) {
+	oldCount, newCount := 0, 0
+	for _, e := range hunk {
+		if e.op != '+' {
+			oldCount++
+		}
+		if e.op != '-' {
+			newCount++
+		}
+	}
+	// An empty range is numbered after the line preceding it
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+	fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+
+	for _, e := range hunk {
+		b.WriteByte(e.op)
+		b.WriteString(e.line)
+		if !strings.HasSuffix(e.line, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func advance(e edit, oldLine, newLine int) (int, int) {
+	if e.op != '+' {
+		oldLine++
+	}
+	if e.op != '-' {
+		newLine++
+	}
+	return oldLine, newLine
+}
+
+// splitLines splits text into lines, keeping their line feeds
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edits turning a into b, using Myers' algorithm on the
+// lines between their common prefix and suffix
+func diffLines(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{' ', line})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{' ', line})
+	}
+	return edits
+}
+
+// myers returns a shortest edit script from a to b, or replaces all of a by
+// all of b when it needs more than maxEdits edits
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds v, for diagonals -d-1 to d+1, before round d
+	var trace [][]int
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		edits := make([]edit, 0, n+m)
+		for _, line := range a {
+			edits = append(edits, edit{'-', line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{'+', line})
+		}
+		return edits
+	}
+
+	// Walk the trace back from the end, collecting edits in reverse
+	var reversed []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, edit{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, edit{'+', b[y-1]})
+			} else {
+				reversed = append(reversed, edit{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	edits := make([]edit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
@@ -0,0 +1,126 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxPieceLength bounds the bytes merged at once: merging is quadratic in the
+// length of a piece, and pieces this long (runs of letters in encoded data)
+// are not made of words anyway
+const maxPieceLength = 512
+
+// BPE is a byte-level byte pair encoding tokenizer with a vocabulary in the
+// format of tiktoken files: one base64 token and its rank per line. Lower
+// ranks merge first, as in tiktoken.
+type BPE struct {
+	name  string
+	ranks map[string]int
+
+	mu    sync.Mutex
+	cache map[string]int
+}
+
+// maxCacheSize bounds the number of pieces whose count is cached
+const maxCacheSize = 1 << 16
+
+// NewBPE reads a vocabulary in the tiktoken format. It must have a token for
+// every byte.
+func NewBPE(name string, vocabulary io.Reader) (*BPE, error) {
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(vocabulary)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		encoded, rankStr, ok := strings.Cut(text, " ")
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("tokenizer %s: invalid token on line %d", name, line)
+		}
+		rank, err := strconv.Atoi(strings.TrimSpace(rankStr))
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer %s: invalid rank on line %d", name, line)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("tokenizer %s: %w", name, err)
+	}
+	for b := 0; b < 256; b++ {
+		if _, ok := ranks[string([]byte{byte(b)})]; !ok {
+			return nil, fmt.Errorf("tokenizer %s: no token for byte %d", name, b)
+		}
+	}
+	return &BPE{name: name, ranks: ranks, cache: map[string]int{}}, nil
+}
+
+func (t *BPE) Name() string {
+	return t.name
+}
+
+// Count returns the number of tokens text encodes to
+func (t *BPE) Count(text string) int {
+	count := 0
+	for _, piece := range Split(text) {
+		for len(piece) > maxPieceLength {
+			count += t.countPiece(piece[:maxPieceLength])
+			piece = piece[maxPieceLength:]
+		}
+		count += t.countPiece(piece)
+	}
+	return count
+}
+
+// countPiece returns the number of tokens of a piece, from the cache if it was seen
+func (t *BPE) countPiece(piece string) int {
+	if _, ok := t.ranks[piece]; ok {
+		return 1
+	}
+
+	t.mu.Lock()
+	count, ok := t.cache[piece]
+	t.mu.Unlock()
+	if ok {
+		return count
+	}
+
+	count = t.merge(piece)
+	t.mu.Lock()
+	if len(t.cache) >= maxCacheSize {
+		clear(t.cache)
+	}
+	t.cache[piece] = count
+	t.mu.Unlock()
+	return count
+}
+
+// merge encodes a piece by merging its bytes, then the parts they form, in
+// rank order, and returns the number of parts left
+func (t *BPE) merge(piece string) int {
+	// bounds[i] is the start of the i-th part; the last bound is the end
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := t.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
@@ -0,0 +1,36 @@
+package tokenizer
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// EmbeddedName is the name of the tokenizer built into the binary
+const EmbeddedName = "embedded"
+
+// embeddedVocabulary is a vocabulary of 16384 tokens trained by gen_vocab.go on
+// documentation, man pages, books and Python and Go sources. It is much smaller
+// than the vocabularies of the main providers, so it counts more tokens: about
+// a quarter more for English prose and a tenth more for code, and more again
+// for other languages. Load a provider's vocabulary for exact counts (see Load).
+//
+//go:embed embedded.tiktoken
+var embeddedVocabulary string
+
+var (
+	embeddedOnce sync.Once
+	embedded     *BPE
+)
+
+// Embedded returns the tokenizer built into the binary
+func Embedded() *BPE {
+	embeddedOnce.Do(func() {
+		var err error
+		embedded, err = NewBPE(EmbeddedName, strings.NewReader(embeddedVocabulary))
+		if err != nil {
+			panic(err)
+		}
+	})
+	return embedded
+}
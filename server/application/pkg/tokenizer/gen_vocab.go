@@ -0,0 +1,201 @@
+//go:build ignore
+
+// gen_vocab trains the embedded BPE vocabulary on the text files under the
+// given paths, gzipped or not, and writes it in the tiktoken format:
+//
+//	go run gen_vocab.go -size 16384 -out embedded.tiktoken \
+//		/usr/share/doc /usr/share/man/man1 /usr/lib/python3.11 $(go env GOROOT)/src \
+//		$(go env GOMODCACHE)/github.com/klauspost/compress@v1.18.2/testdata \
+//		$(go env GOMODCACHE)/github.com/andybalholm/brotli@v1.2.0/testdata \
+//		$(go env GOMODCACHE)/golang.org/x/text@v0.30.0/encoding/testdata
+//
+// Training merges the most frequent adjacent pair of tokens within the pieces
+// of Split, counted over the distinct pieces seen at least twice, until the
+// vocabulary has size tokens. Ties go to the pair whose merged bytes sort first.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/heap"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mindflight/save-my-chat-llm/server/application/pkg/tokenizer"
+)
+
+var extensions = map[string]bool{
+	".go": true, ".md": true, ".txt": true, ".html": true, ".py": true, ".js": true,
+	".ts": true, ".json": true, ".yaml": true, ".yml": true, ".sh": true, ".c": true,
+	".h": true, ".sql": true, ".css": true, ".rst": true, "": true,
+}
+
+type pair struct{ a, b int }
+
+type word struct {
+	tokens []int
+	count  int
+}
+
+type candidate struct {
+	pair  pair
+	count int
+	bytes string
+}
+
+type queue []candidate
+
+func (q queue) Len() int { return len(q) }
+func (q queue) Less(i, j int) bool {
+	if q[i].count != q[j].count {
+		return q[i].count > q[j].count
+	}
+	return q[i].bytes < q[j].bytes
+}
+func (q queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x interface{}) { *q = append(*q, x.(candidate)) }
+func (q *queue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// gunzip decompresses gzipped files, such as man pages and changelogs
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func main() {
+	size := flag.Int("size", 8192, "number of tokens of the vocabulary")
+	out := flag.String("out", "embedded.tiktoken", "output file")
+	maxBytes := flag.Int64("max-bytes", 32<<20, "bytes of text read at most under each path")
+	flag.Parse()
+
+	pieces := map[string]int{}
+	var total int64
+	for _, root := range flag.Args() {
+		var read int64
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			ext := filepath.Ext(path)
+			if err != nil || d.IsDir() || read >= *maxBytes || !(extensions[ext] || ext == ".gz") {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err == nil && ext == ".gz" {
+				data, err = gunzip(data)
+			}
+			if err != nil || !utf8.Valid(data) {
+				return nil
+			}
+			read += int64(len(data))
+			for _, piece := range tokenizer.Split(string(data)) {
+				pieces[piece]++
+			}
+			return nil
+		})
+		total += read
+	}
+	log.Printf("read %d bytes, %d distinct pieces", total, len(pieces))
+
+	// tokens[i] holds the bytes of token i; bytes come first
+	var tokens []string
+	for b := 0; b < 256; b++ {
+		tokens = append(tokens, string([]byte{byte(b)}))
+	}
+
+	var words []word
+	for piece, count := range pieces {
+		if count < 2 || len(piece) < 2 {
+			continue
+		}
+		w := word{count: count}
+		for i := 0; i < len(piece); i++ {
+			w.tokens = append(w.tokens, int(piece[i]))
+		}
+		words = append(words, w)
+	}
+
+	counts := map[pair]int{}
+	where := map[pair]map[int]bool{}
+	add := func(p pair, w, n int) {
+		counts[p] += n
+		if where[p] == nil {
+			where[p] = map[int]bool{}
+		}
+		where[p][w] = true
+	}
+	for i, w := range words {
+		for j := 0; j+1 < len(w.tokens); j++ {
+			add(pair{w.tokens[j], w.tokens[j+1]}, i, w.count)
+		}
+	}
+	q := &queue{}
+	for p, n := range counts {
+		heap.Push(q, candidate{p, n, tokens[p.a] + tokens[p.b]})
+	}
+
+	for len(tokens) < *size && q.Len() > 0 {
+		c := heap.Pop(q).(candidate)
+		if counts[c.pair] != c.count || c.count == 0 {
+			continue // stale
+		}
+		id := len(tokens)
+		tokens = append(tokens, c.bytes)
+
+		touched := map[pair]bool{}
+		for w := range where[c.pair] {
+			ws := &words[w]
+			// Remove the pairs of the word, merge, and add them back
+			for j := 0; j+1 < len(ws.tokens); j++ {
+				p := pair{ws.tokens[j], ws.tokens[j+1]}
+				counts[p] -= ws.count
+				touched[p] = true
+			}
+			merged := ws.tokens[:0:0]
+			for j := 0; j < len(ws.tokens); j++ {
+				if j+1 < len(ws.tokens) && ws.tokens[j] == c.pair.a && ws.tokens[j+1] == c.pair.b {
+					merged = append(merged, id)
+					j++
+					continue
+				}
+				merged = append(merged, ws.tokens[j])
+			}
+			ws.tokens = merged
+			for j := 0; j+1 < len(ws.tokens); j++ {
+				p := pair{ws.tokens[j], ws.tokens[j+1]}
+				add(p, w, ws.count)
+				touched[p] = true
+			}
+		}
+		delete(counts, c.pair)
+		delete(where, c.pair)
+		for p := range touched {
+			if n := counts[p]; n > 0 {
+				heap.Push(q, candidate{p, n, tokens[p.a] + tokens[p.b]})
+			}
+		}
+	}
+
+	var b strings.Builder
+	for rank, token := range tokens {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	if err := os.WriteFile(*out, []byte(b.String()), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d tokens to %s", len(tokens), *out)
+}
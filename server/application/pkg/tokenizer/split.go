@@ -0,0 +1,127 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Split cuts text into the pieces that BPE encodes separately, following the
+// pre-tokenization of OpenAI's cl100k_base: English contractions, words with
+// at most one leading non-letter (usually a space), runs of up to three
+// digits, punctuation with an optional leading space and trailing newlines,
+// and whitespace. Whitespace before a word leaves its last space to the word.
+func Split(text string) []string {
+	var pieces []string
+	for i := 0; i < len(text); {
+		n := pieceLength(text[i:])
+		pieces = append(pieces, text[i:i+n])
+		i += n
+	}
+	return pieces
+}
+
+// pieceLength returns the length in bytes of the piece text starts with
+func pieceLength(text string) int {
+	r, size := utf8.DecodeRuneInString(text)
+
+	if r == '\'' {
+		if n := contractionLength(text); n > 0 {
+			return n
+		}
+	}
+
+	// A word, possibly after one character that is not a letter, digit or newline
+	if unicode.IsLetter(r) {
+		return size + runLength(text[size:], unicode.IsLetter)
+	}
+	if !isNewline(r) && !unicode.IsNumber(r) && len(text) > size {
+		if next, _ := utf8.DecodeRuneInString(text[size:]); unicode.IsLetter(next) {
+			return size + runLength(text[size:], unicode.IsLetter)
+		}
+	}
+
+	if unicode.IsNumber(r) {
+		n := size
+		for digits := 1; digits < 3 && n < len(text); digits++ {
+			next, nextSize := utf8.DecodeRuneInString(text[n:])
+			if !unicode.IsNumber(next) {
+				break
+			}
+			n += nextSize
+		}
+		return n
+	}
+
+	// Punctuation, possibly after a space, and the newlines following it
+	start := 0
+	if r == ' ' && len(text) > size {
+		if next, _ := utf8.DecodeRuneInString(text[size:]); isPunctuation(next) {
+			start = size
+		}
+	}
+	if n := runLength(text[start:], isPunctuation); n > 0 {
+		n += start
+		return n + runLength(text[n:], isNewline)
+	}
+
+	// Whitespace: up to and including its last newline if it has one,
+	// otherwise all of it but the space before a non-space
+	n := runLength(text, unicode.IsSpace)
+	lastNewline := -1
+	for i, c := range text[:n] {
+		if isNewline(c) {
+			lastNewline = i
+		}
+	}
+	if lastNewline >= 0 {
+		return lastNewline + 1
+	}
+	if n < len(text) && n > size {
+		_, lastSize := utf8.DecodeLastRuneInString(text[:n])
+		return n - lastSize
+	}
+	return n
+}
+
+// contractionLength returns the length of the English contraction text
+// starts with, such as 's or 'll in any case, or 0
+func contractionLength(text string) int {
+	for _, suffix := range []string{"ll", "re", "ve", "s", "t", "m", "d"} {
+		n := 1 + len(suffix)
+		if len(text) >= n && equalFoldASCII(text[1:n], suffix) {
+			return n
+		}
+	}
+	return 0
+}
+
+// runLength returns the length in bytes of the run of runes matching f text starts with
+func runLength(text string, f func(rune) bool) int {
+	for i, r := range text {
+		if !f(r) {
+			return i
+		}
+	}
+	return len(text)
+}
+
+func isNewline(r rune) bool {
+	return r == '\n' || r == '\r'
+}
+
+func isPunctuation(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func equalFoldASCII(a, b string) bool {
+	for i := 0; i < len(a); i++ {
+		c := a[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != b[i] {
+			return false
+		}
+	}
+	return true
+}
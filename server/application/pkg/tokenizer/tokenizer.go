@@ -0,0 +1,154 @@
+// Package tokenizer counts the tokens of text as language models see them,
+// to tell how much context a saved conversation takes and what it would cost.
+//
+// Tokenizers are pluggable: a Registry maps each conversation source to one of
+// them. A byte pair encoding tokenizer with a compact vocabulary is built in
+// (see Embedded); the vocabularies of the providers, such as OpenAI's
+// cl100k_base and o200k_base tiktoken files, can be loaded for exact counts.
+package tokenizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Tokenizer counts the tokens of text
+type Tokenizer interface {
+	// Name identifies the tokenizer, and is stored with the counts it made
+	Name() string
+	Count(text string) int
+}
+
+// VocabularyExt is the extension of vocabulary files loaded by Load
+const VocabularyExt = ".tiktoken"
+
+// preferred are the vocabularies used for the conversations of a source when
+// they are loaded and the source is not mapped otherwise, in order
+var preferred = map[string][]string{
+	"chatgpt": {"o200k_base", "cl100k_base"},
+	"*":       {"cl100k_base"},
+}
+
+// Registry holds the known tokenizers and the one used for each source
+type Registry struct {
+	tokenizers map[string]Tokenizer
+	sources    map[string]Tokenizer
+	fallback   Tokenizer
+}
+
+// NewRegistry returns a registry with only the embedded tokenizer, used for
+// every source
+func NewRegistry() *Registry {
+	embedded := Embedded()
+	return &Registry{
+		tokenizers: map[string]Tokenizer{embedded.Name(): embedded},
+		sources:    map[string]Tokenizer{},
+		fallback:   embedded,
+	}
+}
+
+// Load returns a registry with the embedded tokenizer and the vocabularies
+// found in dir, named after their files (cl100k_base.tiktoken is
+// "cl100k_base"), and the sources mapped by spec. Spec holds "source=name"
+// entries separated by commas or newlines; the source "*" sets the tokenizer
+// of the sources not listed. Sources not mapped by spec use the preferred
+// vocabulary of their provider if it is loaded, and the embedded one otherwise.
+// Every vocabulary is applied after the pre-tokenization of cl100k_base (see
+// Split), so counts with other vocabularies may differ a little from their
+// provider's.
+func Load(dir, spec string) (*Registry, error) {
+	r := NewRegistry()
+	if dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*"+VocabularyExt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tokenizer vocabularies: %w", err)
+		}
+		for _, path := range paths {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tokenizer vocabulary: %w", err)
+			}
+			bpe, err := NewBPE(strings.TrimSuffix(filepath.Base(path), VocabularyExt), file)
+			file.Close()
+			if err != nil {
+				return nil, err
+			}
+			r.Add(bpe)
+		}
+	}
+
+	for source, names := range preferred {
+		for _, name := range names {
+			if r.Map(source, name) == nil {
+				break
+			}
+		}
+	}
+
+	entries := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		source, name, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tokenizer mapping %q, expected source=tokenizer", entry)
+		}
+		if err := r.Map(strings.TrimSpace(source), strings.TrimSpace(name)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add makes a tokenizer available to Map, replacing any of the same name
+func (r *Registry) Add(t Tokenizer) {
+	r.tokenizers[t.Name()] = t
+}
+
+// Map makes the conversations of source use the tokenizer called name; the
+// source "*" sets the tokenizer of the sources not mapped
+func (r *Registry) Map(source, name string) error {
+	t, ok := r.tokenizers[name]
+	if !ok {
+		return fmt.Errorf("unknown tokenizer %q", name)
+	}
+	if source == "*" {
+		r.fallback = t
+		return nil
+	}
+	r.sources[source] = t
+	return nil
+}
+
+// ForSource returns the tokenizer of the conversations of source
+func (r *Registry) ForSource(source string) Tokenizer {
+	if t, ok := r.sources[source]; ok {
+		return t
+	}
+	return r.fallback
+}
+
+// Mapping returns the name of the tokenizer of each mapped source, with the
+// default one under "*"
+func (r *Registry) Mapping() map[string]string {
+	mapping := map[string]string{"*": r.fallback.Name()}
+	for source, t := range r.sources {
+		mapping[source] = t.Name()
+	}
+	return mapping
+}
+
+// Names returns the names of the known tokenizers, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.tokenizers))
+	for name := range r.tokenizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,173 @@
+// Package transcript splits the text of a saved conversation into messages.
+//
+// The browser extension saves conversations as the page text of each turn,
+// joined by blank lines. Turns are only told apart when the text carries
+// speaker markers, such as the "You said:" and "ChatGPT said:" headings of
+// copied ChatGPT pages, "User:" / "Assistant:" prefixes or "## Assistant"
+// Markdown headings. Text without markers is kept as a single message of
+// unknown role.
+package transcript
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Message roles
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleSystem    = "system"
+	RoleTool      = "tool"
+	// RoleUnknown is used for text whose speaker cannot be told
+	RoleUnknown = "unknown"
+)
+
+// Message is one turn of a conversation
+type Message struct {
+	Role    string
+	Content string
+	// Model is the model named in the speaker marker, such as "gpt-4o" in
+	// "Assistant (gpt-4o):", or empty
+	Model string
+}
+
+// speakers maps lowercased speaker names to roles
+var speakers = map[string]string{
+	"you":        RoleUser,
+	"user":       RoleUser,
+	"human":      RoleUser,
+	"me":         RoleUser,
+	"moi":        RoleUser,
+	"vous":       RoleUser,
+	"assistant":  RoleAssistant,
+	"ai":         RoleAssistant,
+	"chatgpt":    RoleAssistant,
+	"claude":     RoleAssistant,
+	"gemini":     RoleAssistant,
+	"perplexity": RoleAssistant,
+	"kimi":       RoleAssistant,
+	"deepseek":   RoleAssistant,
+	"grok":       RoleAssistant,
+	"mistral":    RoleAssistant,
+	"le chat":    RoleAssistant,
+	"qwen":       RoleAssistant,
+	"copilot":    RoleAssistant,
+	"manus":      RoleAssistant,
+	"system":     RoleSystem,
+	"tool":       RoleTool,
+}
+
+// inlineSpeakers may start a line followed by the message text ("User: hi").
+// Other names are only recognized as a line of their own, to avoid splitting
+// on sentences such as "Claude: a name of French origin".
+var inlineSpeakers = map[string]bool{
+	"user":      true,
+	"human":     true,
+	"assistant": true,
+	"system":    true,
+}
+
+var (
+	// markerRe matches a speaker line: an optional heading or bold markup,
+	// the speaker name, an optional "(model)", and "said" and/or a colon
+	markerRe = regexp.MustCompile(`^(#{1,6}\s*)?(\*\*|__)?\s*([\p{L} .'-]+?)(?:\s*\(([^()]+)\))?\s*(said|a dit)?\s*(:)?\s*(\*\*|__)?\s*(:)?$`)
+	// inlineRe matches a speaker prefix followed by text on the same line
+	inlineRe = regexp.MustCompile(`^(?i:(user|human|assistant|system))(?:\s*\(([^()]+)\))?\s*:\s+(\S.*)$`)
+	// blankLinesRe matches runs of blank lines left by removed noise
+	blankLinesRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// noiseLines are button and status labels captured with the page text
+var noiseLines = map[string]bool{
+	"copy":              true,
+	"copy code":         true,
+	"copied!":           true,
+	"edit":              true,
+	"share":             true,
+	"retry":             true,
+	"regenerate":        true,
+	"read aloud":        true,
+	"good response":     true,
+	"bad response":      true,
+	"thinking complete": true,
+	"show more":         true,
+	"show less":         true,
+}
+
+// Parse splits content into messages. It never returns an empty message; text
+// before the first speaker marker, or all of it if there is none, gets RoleUnknown.
+func Parse(content string) []Message {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var messages []Message
+	current := Message{Role: RoleUnknown}
+	var body []string
+
+	flush := func() {
+		text := clean(body)
+		if text != "" {
+			current.Content = text
+			messages = append(messages, current)
+		}
+		body = nil
+	}
+
+	for _, line := range lines {
+		if role, model, rest, ok := speakerLine(line); ok {
+			flush()
+			current = Message{Role: role, Model: model}
+			if rest != "" {
+				body = append(body, rest)
+			}
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+
+	return messages
+}
+
+// speakerLine reports whether line marks the start of a turn, and returns the
+// role, the model named in the marker and any text following it on the line
+func speakerLine(line string) (role, model, rest string, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || len(trimmed) > 60 {
+		return "", "", "", false
+	}
+
+	if m := inlineRe.FindStringSubmatch(trimmed); m != nil && inlineSpeakers[strings.ToLower(m[1])] {
+		return speakers[strings.ToLower(m[1])], strings.TrimSpace(m[2]), m[3], true
+	}
+
+	m := markerRe.FindStringSubmatch(trimmed)
+	if m == nil {
+		return "", "", "", false
+	}
+	heading, emphasis, name, said, colon := m[1] != "", m[2] != "", m[3], m[5] != "", m[6] != "" || m[8] != ""
+	// A bare name is too ambiguous; it must be decorated like a speaker label
+	if !heading && !emphasis && !said && !colon {
+		return "", "", "", false
+	}
+
+	role, known := speakers[strings.ToLower(strings.TrimSpace(name))]
+	if !known {
+		return "", "", "", false
+	}
+	return role, strings.TrimSpace(m[4]), "", true
+}
+
+// clean drops UI noise lines and surrounding blank lines from a message body
+func clean(lines []string) string {
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if noiseLines[strings.ToLower(strings.TrimSpace(line))] {
+			continue
+		}
+		kept = append(kept, strings.TrimRight(line, " \t"))
+	}
+	text := strings.Join(kept, "\n")
+	text = blankLinesRe.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}